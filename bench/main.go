@@ -30,17 +30,29 @@ func main() {
 }
 
 func sendMockAddBooking() {
-	// Эмуляция POST запроса на /bookings
-	postReqBody := bytes.NewBuffer([]byte(`{"id":"1", "time":"2022-12-31T23:59:59Z"}`)) // Замените на реальные данные
-	resp, err := http.Post("http://web-entry:8080/bookings", "application/json", postReqBody)
-	if err != nil {
-		fmt.Println("Error making POST request:", err)
-		return
-	}
-	defer resp.Body.Close()
+	// Эмуляция POST запроса на /bookings. Повтор идёт с тем же Idempotency-Key,
+	// поэтому второе бронирование не создастся, даже если первый ответ просто не дошёл
+	key := fmt.Sprintf("bench-%d", time.Now().UnixNano())
+	// Бронировать можно только на будущее время
+	bookingTime := time.Now().Add(24 * time.Hour).UTC().Format(time.RFC3339)
+	for attempt := 0; attempt < 2; attempt++ {
+		postReqBody := bytes.NewBufferString(fmt.Sprintf(`{"id":"1", "time":%q}`, bookingTime)) // Замените на реальные данные
+		req, _ := http.NewRequest(http.MethodPost, "http://web-entry:8080/bookings", postReqBody)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Idempotency-Key", key)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			fmt.Println("Error making POST request:", err)
+			continue
+		}
 
-	body, _ := io.ReadAll(resp.Body)
-	fmt.Println("Response to POST /bookings:", string(body))
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		fmt.Println("Response to POST /bookings:", string(body))
+		if resp.StatusCode < http.StatusInternalServerError {
+			return
+		}
+	}
 }
 
 func sendMockGetBooking() {
@@ -8,7 +8,9 @@ import (
 	"github.com/gin-gonic/gin"
 	"log"
 	"otel-jaeger-learn/pkg/logging"
+	"otel-jaeger-learn/pkg/shedding"
 	"otel-jaeger-learn/pkg/tracing"
+	"otel-jaeger-learn/pkg/tracing/httpclient"
 )
 
 func main() {
@@ -25,23 +27,35 @@ func main() {
 	router := gin.Default()
 	// Будет принимать из запроса или создавать новый трейс при каждом запросек
 	tracing.AddOtelMiddleware(router, "bookings")
+	// /metrics и страница /debug/tracing с состоянием экспорта span'ов
+	tracing.AddDebugRoutes(router)
+	// Ограничение одновременных запросов, /metrics и /debug/tracing зарегистрированы раньше и не ограничиваются
+	if err := shedding.AddMiddleware(router, cfg.SheddingCfg); err != nil {
+		log.Fatalf("failed to set up load shedding: %v", err)
+	}
 
 	bookingStorage, err := bookingpg.NewStorage(cfg.PgAddr, cfg.PgDb, cfg.PgUser, cfg.PgPass)
 	if err != nil {
 		log.Panicf("fail to create storage: %v", err)
 	}
 
-	client := tracing.NewOtelHttpClient()
+	// Клиент с трейсингом, таймаутами, повторами и circuit breaker'ом
+	client, err := httpclient.New(cfg.HttpClientCfg)
+	if err != nil {
+		log.Panicf("fail to create http client: %v", err)
+	}
 
-	bookingHandler := handler.NewBookingHnd(client, bookingStorage, cfg)
+	bookingHandler, err := handler.NewBookingHnd(client, bookingStorage, cfg)
+	if err != nil {
+		log.Fatalf("failed to create booking handler: %v", err)
+	}
 
 	// Routes
-	router.POST("/add-booking", func(c *gin.Context) { bookingHandler.AddBooking(c) })
-	router.GET("/get-booking", func(c *gin.Context) { bookingHandler.GetBooking(c) })
+	handler.RegisterRoutes(router, bookingHandler)
 
-	// Start HTTP server
+	// Start HTTP server, по SIGINT/SIGTERM он останавливается и отправляет оставшиеся span'ы
 	addr := fmt.Sprintf(":%s", cfg.HttpPort)
-	if err := router.Run(addr); err != nil {
-		log.Fatalf("failed to start HTTP server: %v", err)
+	if err := tracing.Serve(addr, router); err != nil {
+		log.Fatalf("HTTP server stopped with error: %v", err)
 	}
 }
@@ -4,7 +4,19 @@ import (
 	"github.com/caarlos0/env/v11"
 	"log"
 	"otel-jaeger-learn/pkg/logging"
+	"otel-jaeger-learn/pkg/money"
+	"otel-jaeger-learn/pkg/quote"
+	"otel-jaeger-learn/pkg/shedding"
 	"otel-jaeger-learn/pkg/tracing"
+	"otel-jaeger-learn/pkg/tracing/httpclient"
+	"time"
+)
+
+// Стратегии PRICE_FALLBACK
+const (
+	PriceFallbackCache   = "cache"
+	PriceFallbackDefault = "default"
+	PriceFallbackReject  = "reject"
 )
 
 type Config struct {
@@ -14,8 +26,25 @@ type Config struct {
 	PgAddr         string `env:"PG_ADDR" envDefault:"localhost:5432"`
 	PgDb           string `env:"PG_DB" envDefault:"postgres"`
 	CalcPricesAddr string `env:"CALC_PRICES_ADDR,required"`
-	LoggingCfg     logging.Config
-	TracingCfg     tracing.Config
+	// Что делать, если price-calcs недоступен: по порядку пробуются cache (последняя цена водителя)
+	// и default (DefaultPrice); если ни одна не сработала или задано reject - бронирование отклоняется
+	PriceFallback []string `env:"PRICE_FALLBACK" envDefault:"cache"`
+	// Сумма с валютой, например "1000 RUB"
+	DefaultPrice  money.Money   `env:"DEFAULT_PRICE" envDefault:"1000 RUB"`
+	PriceCacheTTL time.Duration `env:"PRICE_CACHE_TTL" envDefault:"1h"`
+	// Сколько хранится ответ на POST /add-booking с заголовком Idempotency-Key
+	IdempotencyTTL time.Duration `env:"IDEMPOTENCY_TTL" envDefault:"24h"`
+	// Сколько ключ занят выполняющимся запросом: если ответ не сохранён за это время (например, сервис упал
+	// посреди запроса), ключ может занять повтор. Должно быть больше времени обработки запроса
+	IdempotencyLease time.Duration `env:"IDEMPOTENCY_LEASE" envDefault:"1m"`
+	// Сколько времени водителя занимает бронирование, если в запросе не задано duration_minutes
+	SlotDuration time.Duration `env:"BOOKING_SLOT_DURATION" envDefault:"1h"`
+	// Ключ проверки подписанных предложений цены, тот же, что у price-calcs
+	QuoteCfg      quote.Config
+	LoggingCfg    logging.Config
+	TracingCfg    tracing.Config
+	HttpClientCfg httpclient.Config
+	SheddingCfg   shedding.Config
 }
 
 func LoadConfig() Config {
@@ -24,5 +53,15 @@ func LoadConfig() Config {
 	if err != nil {
 		log.Panicf("failed to load env config: %v", err)
 	}
+	for _, fallback := range cfg.PriceFallback {
+		switch fallback {
+		case PriceFallbackCache, PriceFallbackDefault, PriceFallbackReject:
+		default:
+			log.Panicf("unknown PRICE_FALLBACK strategy %q", fallback)
+		}
+	}
+	if cfg.IdempotencyLease <= 0 {
+		log.Panicf("IDEMPOTENCY_LEASE must be positive")
+	}
 	return cfg
 }
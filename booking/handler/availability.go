@@ -0,0 +1,53 @@
+package handler
+
+import (
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"net/http"
+	"otel-jaeger-learn/pkg/tracing"
+	"time"
+)
+
+// maxAvailabilityRange - самый длинный промежуток, за который можно запросить свободное время водителя
+const maxAvailabilityRange = 31 * 24 * time.Hour
+
+type slotResponse struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+// DriverAvailability отдаёт свободные промежутки водителя между from и to (RFC3339)
+func (b *BookingHnd) DriverAvailability(c *gin.Context) {
+	ctx := c.Request.Context()
+	tracing.TraceLogger(ctx).Debug("DriverAvailability()")
+	spanCtx, span := tracing.NewSpan(ctx, "Handler.DriverAvailability")
+	defer span.End()
+
+	driverId := c.Param("driver")
+	from, errFrom := time.Parse(time.RFC3339, c.Query("from"))
+	to, errTo := time.Parse(time.RFC3339, c.Query("to"))
+	if errFrom != nil || errTo != nil || !from.Before(to) || to.Sub(from) > maxAvailabilityRange {
+		c.JSON(http.StatusBadRequest, tracing.ErrorBody(ctx,
+			"from and to must be RFC3339 times, from before to, at most "+maxAvailabilityRange.String()+" apart"))
+		return
+	}
+
+	free, err := b.db.DriverAvailability(spanCtx, driverId, from.UTC(), to.UTC())
+	if err != nil {
+		span.AddError("db.DriverAvailability returns error", err)
+		tracing.TraceLogger(ctx).ErrorErr("db.DriverAvailability returns error", err)
+		c.JSON(tracing.ErrorStatus(ctx, http.StatusInternalServerError), tracing.ErrorBody(ctx, "db.DriverAvailability returns error"))
+		return
+	}
+
+	resp := make([]slotResponse, 0, len(free))
+	for _, slot := range free {
+		resp = append(resp, slotResponse{Start: slot.Start, End: slot.End})
+	}
+	trace.SpanFromContext(spanCtx).SetAttributes(
+		attribute.String("driver.id", driverId),
+		attribute.Int("driver.free_slots", len(resp)),
+	)
+	c.JSON(http.StatusOK, gin.H{"driver_id": driverId, "free": resp})
+}
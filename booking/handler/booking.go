@@ -3,108 +3,215 @@ package handler
 import (
 	"booking/config"
 	"booking/storage/bookingpg"
-	"bytes"
 	"context"
-	"encoding/json"
-	"fmt"
+	"errors"
 	"github.com/gin-gonic/gin"
-	"io"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"log/slog"
 	"net/http"
-	"otel-jaeger-learn/pkg/logging"
+	"otel-jaeger-learn/pkg/money"
+	"otel-jaeger-learn/pkg/quote"
 	"otel-jaeger-learn/pkg/tracing"
+	"otel-jaeger-learn/pkg/tracing/httpclient"
+	"strconv"
 	"time"
 )
 
 type Booking struct {
-	Time  time.Time `json:"time"`
-	Price float64   `json:"price"`
+	ID             int         `json:"id"`
+	Time           time.Time   `json:"time"`
+	Price          money.Money `json:"price"`
+	OriginalPrice  money.Money `json:"original_price"`
+	Rate           float64     `json:"rate"`
+	PriceEstimated bool        `json:"price_estimated"`
+	Status         string      `json:"status"`
+	Version        int         `json:"version"`
+	DriverID       string      `json:"driver_id,omitempty"`
+	QuoteID        string      `json:"quote_id,omitempty"`
+}
+
+// addBookingRequest - тело POST /add-booking, web-entry уже проверил поля
+type addBookingRequest struct {
+	Time time.Time `json:"time" binding:"required"`
+	// Водитель, время которого занимает бронирование; если не задан, его выбирает price-calcs
+	DriverID        string `json:"driver_id"`
+	DurationMinutes int    `json:"duration_minutes"`
+	// Токен предложения из GET /booking-quote: цена берётся из него, а не запрашивается заново
+	QuoteToken string `json:"quote_token"`
+	// Валюта цены (ISO 4217); если не задана - валюта водителя
+	Currency string `json:"currency"`
+}
+
+func newBooking(b bookingpg.Booking) Booking {
+	return Booking{ID: b.ID, Time: b.Time, Price: b.Price, OriginalPrice: b.OriginalPrice, Rate: b.Rate, PriceEstimated: b.PriceEstimated, Status: b.Status, Version: b.Version, DriverID: b.DriverID, QuoteID: b.QuoteID}
+}
+
+// Storage - хранилище бронирований, с которым работает хендлер (bookingpg.Storage или фейк в тестах)
+type Storage interface {
+	AddBooking(ctx context.Context, booking bookingpg.Booking) (int, error)
+	GetBookingById(ctx context.Context, id int) (*bookingpg.Booking, error)
+	ListBookings(ctx context.Context, q bookingpg.ListQuery) ([]bookingpg.Booking, error)
+	UpdateBooking(ctx context.Context, id int, upd bookingpg.BookingUpdate) (bookingpg.UpdateResult, error)
+	ClaimIdempotencyKey(ctx context.Context, key, requestHash string, retention, lease time.Duration) (*bookingpg.IdempotentResponse, error)
+	SaveIdempotentResponse(ctx context.Context, key string, resp bookingpg.IdempotentResponse) error
+	ReleaseIdempotencyKey(ctx context.Context, key string) error
+	DriverAvailability(ctx context.Context, driverId string, from, to time.Time) ([]bookingpg.Slot, error)
 }
 
 type BookingHnd struct {
-	client *http.Client
-	db     *bookingpg.Storage
+	client *httpclient.Client
+	db     Storage
 	cfg    config.Config
+	prices *priceCache
+	quotes *quote.Signer
 }
 
-func NewBookingHnd(client *http.Client, db *bookingpg.Storage, cfg config.Config) *BookingHnd {
-	return &BookingHnd{client: client, db: db, cfg: cfg}
+func NewBookingHnd(client *httpclient.Client, db Storage, cfg config.Config) (*BookingHnd, error) {
+	quotes, err := quote.NewSigner(cfg.QuoteCfg.Key)
+	if err != nil {
+		return nil, err
+	}
+	return &BookingHnd{client: client, db: db, cfg: cfg, prices: newPriceCache(cfg.PriceCacheTTL), quotes: quotes}, nil
 }
 
 func (b *BookingHnd) AddBooking(c *gin.Context) {
 	ctx := c.Request.Context()
-	logging.Debug("BookingHnd.AddBooking()")
+	tracing.TraceLogger(ctx).Debug("BookingHnd.AddBooking()")
 
 	spanCtx, span := tracing.NewSpan(ctx, "Handler.AddBooking")
 	defer span.End() // Обязательно, иначе будет висеть в памяти
 
-	// Запрашиваем цену для бронирования у сервиса расчёта цен
-	resp, err := b.sendRequest(ctx, http.MethodGet, fmt.Sprintf("%s/booking-price", b.cfg.CalcPricesAddr), nil)
-	if err != nil {
-		// Добавляем в трейс ошибку отправки запроса
-		span.AddError("error sending request to price calc service", err)
-
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+	var req addBookingRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		span.AddError("error in ShouldBindJSON", err)
+		c.JSON(http.StatusBadRequest, tracing.ErrorBody(ctx, err.Error()))
 		return
 	}
-	defer resp.Body.Close()
+	// Колонки TIMESTAMP без часового пояса, поэтому время хранится в UTC.
+	// Заодно одно и то же время с разным смещением - один и тот же запрос для Idempotency-Key
+	req.Time = req.Time.UTC()
+
+	// С заголовком Idempotency-Key повтор запроса вернёт тот же ответ, а не создаст второе бронирование
+	b.idempotent(c, spanCtx, &span, req, func() (int, any) {
+		return b.addBooking(c, spanCtx, &span, req)
+	})
+}
 
-	type PriceResponse struct {
-		Price float64 `json:"price"`
-	}
+// addBooking создаёт бронирование и возвращает статус и тело ответа
+func (b *BookingHnd) addBooking(c *gin.Context, spanCtx context.Context, span *tracing.Span, req addBookingRequest) (int, any) {
+	ctx := c.Request.Context()
 
-	// Чтение тела ответа
-	body, err := io.ReadAll(resp.Body)
+	// Цена из подписанного предложения, если его нет - запрашиваем у сервиса расчёта цен, а если он недоступен -
+	// берём из кэша или по умолчанию (PRICE_FALLBACK). Если водитель не задан, его выбирает price-calcs
+	var (
+		priced    priceResponse
+		estimated bool
+		q         quote.Quote
+		err       error
+	)
+	if req.QuoteToken != "" {
+		q, err = b.verifyQuote(spanCtx, req.QuoteToken, req.DriverID, req.Time, req.Currency)
+		if err != nil {
+			span.AddError("invalid quote", err)
+			return http.StatusUnprocessableEntity, tracing.ErrorBody(ctx, err.Error())
+		}
+		priced = priceResponse{Price: q.Price, OriginalPrice: q.OriginalPrice, Rate: q.Rate, DriverID: q.DriverID}
+		// У предложений, выданных до появления конвертации, курса нет
+		if q.Rate <= 0 {
+			priced = unconverted(q.Price, q.DriverID)
+		}
+	} else {
+		priced, estimated, err = b.bookingPrice(spanCtx, req.DriverID, req.Time, req.Currency)
+	}
+	if errors.Is(err, ErrUnknownDriver) {
+		span.AddError("unknown driver", err)
+		return http.StatusUnprocessableEntity, tracing.ErrorBody(ctx, err.Error())
+	}
+	if errors.Is(err, ErrInvalidPriceRequest) {
+		span.AddError("invalid price request", err)
+		return http.StatusUnprocessableEntity, tracing.ErrorBody(ctx, err.Error())
+	}
 	if err != nil {
-		// Добавляем в трейс ошибку чтения
-		span.AddError("error reading response body", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		// Добавляем в трейс ошибку получения цены
+		span.AddError("error getting booking price", err)
+
+		return tracing.ErrorStatus(ctx, http.StatusServiceUnavailable), tracing.ErrorBody(ctx, "booking price is unavailable")
 	}
 
-	// Десериализация JSON
-	var priceResponse PriceResponse
-	err = json.Unmarshal(body, &priceResponse)
-	if err != nil {
-		// Добавляем в трейс ошибку десериализации
-		span.AddError("error unmarshalling response body", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "bad request"})
+	booking := bookingpg.Booking{
+		Price:          priced.Price,
+		OriginalPrice:  priced.OriginalPrice,
+		Rate:           priced.Rate,
+		Time:           req.Time,
+		PriceEstimated: estimated,
+		Status:         bookingpg.StatusPending,
+		DriverID:       priced.DriverID,
+		QuoteID:        q.ID,
+	}
+	// Водитель неизвестен, только если price-calcs недоступен и водитель не был задан
+	if booking.DriverID != "" {
+		duration := b.cfg.SlotDuration
+		if req.DurationMinutes > 0 {
+			duration = time.Duration(req.DurationMinutes) * time.Minute
+		}
+		booking.Slot = &bookingpg.Slot{DriverID: booking.DriverID, Start: req.Time, End: req.Time.Add(duration)}
 	}
 
-	// Добавляем бронирование в базу данных
-	_, err = b.db.AddBooking(spanCtx, float64(priceResponse.Price), time.Now())
+	// Добавляем бронирование в базу данных, время водителя резервируется в той же транзакции
+	id, err := b.db.AddBooking(spanCtx, booking)
+	if errors.Is(err, bookingpg.ErrSlotConflict) {
+		span.AddError("driver slot conflict", err)
+		return http.StatusConflict, tracing.ErrorBody(ctx, bookingpg.ErrSlotConflict.Error())
+	}
 	if err != nil {
 		// Добавляем в трейс ошибку добавления в базу данных
 		span.AddError("db.AddBooking returns error", err)
-		logging.ErrorErr("db.AddBooking returns error", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"message": "db.AddBooking returns error"})
-	} else {
-		// Если успешно, добавляем новое событие "Booking added" в трейс
-		span.AddEvent("Booking added") // Новое событие в этот span
-		c.JSON(http.StatusOK, gin.H{"message": "Booking added successfully"})
+		tracing.TraceLogger(ctx).ErrorErr("db.AddBooking returns error", err)
+		return tracing.ErrorStatus(ctx, http.StatusInternalServerError), tracing.ErrorBody(ctx, "db.AddBooking returns error")
 	}
+
+	// Если успешно, добавляем новое событие "Booking added" в трейс
+	span.AddEvent("Booking added", // Новое событие в этот span
+		slog.Int("booking.id", id),
+		slog.String("booking.status.to", bookingpg.StatusPending))
+	if slot := booking.Slot; slot != nil {
+		span.AddEvent("driver slot reserved",
+			slog.String("driver.id", slot.DriverID),
+			slog.String("slot.start", slot.Start.Format(time.RFC3339)),
+			slog.String("slot.end", slot.End.Format(time.RFC3339)))
+	}
+	return http.StatusOK, gin.H{"message": "Booking added successfully", "id": id, "driver_id": booking.DriverID, "price_estimated": estimated}
 }
 
 func (b *BookingHnd) GetBooking(c *gin.Context) {
-	logging.Debug("GetBooking()")
-	spanCtx, span := tracing.NewSpan(c.Request.Context(), "GetBooking")
-	defer spanCtx.Done()
+	ctx := c.Request.Context()
+	tracing.TraceLogger(ctx).Debug("GetBooking()")
+	spanCtx, span := tracing.NewSpan(ctx, "Handler.GetBooking")
+	defer span.End()
 
-	booking := Booking{
-		Time:  time.Now().Add(-24 * time.Hour),
-		Price: 200.0,
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		span.AddError("invalid booking id", err)
+		c.JSON(http.StatusBadRequest, tracing.ErrorBody(ctx, "invalid booking id"))
+		return
 	}
+	trace.SpanFromContext(spanCtx).SetAttributes(attribute.Int("booking.id", id))
 
-	span.AddEvent("Booking retrieved")
-	c.JSON(http.StatusOK, booking)
-}
-
-func (b *BookingHnd) sendRequest(ctx context.Context, method, url string, body []byte) (*http.Response, error) {
-	// Обязательно создаем запрос с контекстом в котором уже есть трейс
-	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewBuffer(body))
+	// Запрос в базу идёт с контекстом span'а, поэтому span запроса к БД будет его дочерним
+	booking, err := b.db.GetBookingById(spanCtx, id)
+	if errors.Is(err, bookingpg.ErrBookingNotFound) {
+		span.AddEvent("booking not found")
+		c.JSON(http.StatusNotFound, tracing.ErrorBody(ctx, "booking not found"))
+		return
+	}
 	if err != nil {
-		return nil, err
+		span.AddError("db.GetBookingById returns error", err)
+		tracing.TraceLogger(ctx).ErrorErr("db.GetBookingById returns error", err)
+		c.JSON(tracing.ErrorStatus(ctx, http.StatusInternalServerError), tracing.ErrorBody(ctx, "db.GetBookingById returns error"))
+		return
 	}
-	req.Header.Set("Content-Type", "application/json")
 
-	// Используем созданный через otelhttp клиент для отправки запроса, он добавит трейс в заголовки
-	return b.client.Do(req)
+	span.AddEvent("Booking retrieved")
+	c.JSON(http.StatusOK, newBooking(*booking))
 }
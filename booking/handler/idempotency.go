@@ -0,0 +1,90 @@
+package handler
+
+import (
+	"booking/storage/bookingpg"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"net/http"
+	"otel-jaeger-learn/pkg/tracing"
+)
+
+const (
+	// IdempotencyKeyHeader - ключ идемпотентности запроса, его передаёт клиент через web-entry
+	IdempotencyKeyHeader = "Idempotency-Key"
+	// IdempotentReplayedHeader выставляется в ответе, если он взят из сохранённых
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+)
+
+// idempotent выполняет handle один раз на ключ из заголовка Idempotency-Key. Запросы сравниваются по разобранному
+// телу request, поэтому порядок полей, пробелы и неизвестные хендлеру поля не важны. Повтор того же запроса
+// получает сохранённый ответ, другой запрос или повтор, пока первый выполняется (не дольше IDEMPOTENCY_LEASE) - 409.
+// Сохраняются только успешные ответы, после ошибки запрос с тем же ключом можно повторить
+func (b *BookingHnd) idempotent(c *gin.Context, spanCtx context.Context, span *tracing.Span, request any, handle func() (int, any)) {
+	ctx := c.Request.Context()
+	key := c.GetHeader(IdempotencyKeyHeader)
+	if key == "" {
+		c.JSON(handle())
+		return
+	}
+	trace.SpanFromContext(spanCtx).SetAttributes(attribute.String("booking.idempotency_key", key))
+
+	normalized, err := json.Marshal(request)
+	if err != nil {
+		span.AddError("error marshalling request", err)
+		c.JSON(http.StatusInternalServerError, tracing.ErrorBody(ctx, "error marshalling request"))
+		return
+	}
+	hash := sha256.Sum256(normalized)
+
+	saved, err := b.db.ClaimIdempotencyKey(spanCtx, key, hex.EncodeToString(hash[:]), b.cfg.IdempotencyTTL, b.cfg.IdempotencyLease)
+	switch {
+	case errors.Is(err, bookingpg.ErrIdempotencyConflict):
+		span.AddError("idempotency key rejected", err)
+		c.JSON(http.StatusConflict, tracing.ErrorBody(ctx, err.Error()))
+		return
+	case errors.Is(err, bookingpg.ErrIdempotencyInProgress):
+		// Retry-After - конфликт временный: web-entry повторит запрос, например после таймаута попытки,
+		// и получит ответ первого запроса, когда тот сохранится
+		span.AddError("idempotency key rejected", err)
+		c.Header("Retry-After", "1")
+		c.JSON(http.StatusConflict, tracing.ErrorBody(ctx, err.Error()))
+		return
+	case err != nil:
+		span.AddError("db.ClaimIdempotencyKey returns error", err)
+		tracing.TraceLogger(ctx).ErrorErr("db.ClaimIdempotencyKey returns error", err)
+		c.JSON(tracing.ErrorStatus(ctx, http.StatusInternalServerError), tracing.ErrorBody(ctx, "db.ClaimIdempotencyKey returns error"))
+		return
+	case saved != nil:
+		span.AddEvent("idempotent request replayed")
+		c.Header(IdempotentReplayedHeader, "true")
+		c.Data(saved.Status, gin.MIMEJSON, saved.Body)
+		return
+	}
+
+	status, resp := handle()
+	data, err := json.Marshal(resp)
+	if err != nil {
+		span.AddError("error marshalling response", err)
+		status = http.StatusInternalServerError
+		data, _ = json.Marshal(tracing.ErrorBody(ctx, "error marshalling response"))
+	}
+
+	// Ключ нужно сохранить или освободить, даже если дедлайн запроса уже истёк
+	dbCtx := context.WithoutCancel(spanCtx)
+	if status >= 200 && status < 300 {
+		err = b.db.SaveIdempotentResponse(dbCtx, key, bookingpg.IdempotentResponse{Status: status, Body: data})
+	} else {
+		err = b.db.ReleaseIdempotencyKey(dbCtx, key)
+	}
+	if err != nil {
+		span.AddError("error saving idempotency key", err)
+		tracing.TraceLogger(ctx).ErrorErr("error saving idempotency key", err)
+	}
+	c.Data(status, gin.MIMEJSON, data)
+}
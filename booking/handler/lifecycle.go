@@ -0,0 +1,111 @@
+package handler
+
+import (
+	"booking/storage/bookingpg"
+	"context"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"log/slog"
+	"net/http"
+	"otel-jaeger-learn/pkg/tracing"
+	"strconv"
+	"time"
+)
+
+// bookingUpdate - тело PATCH /update-booking/:id, пустые поля не меняются
+type bookingUpdate struct {
+	Status string     `json:"status"`
+	Time   *time.Time `json:"time"`
+	// Version - версия бронирования, которую видел клиент; если её успели изменить, ответ 409
+	Version int `json:"version"`
+}
+
+func (b *BookingHnd) UpdateBooking(c *gin.Context) {
+	ctx := c.Request.Context()
+	tracing.TraceLogger(ctx).Debug("UpdateBooking()")
+	spanCtx, span := tracing.NewSpan(ctx, "Handler.UpdateBooking")
+	defer span.End()
+
+	var upd bookingUpdate
+	if err := c.BindJSON(&upd); err != nil {
+		span.AddError("error in BindJSON", err)
+		c.JSON(http.StatusBadRequest, tracing.ErrorBody(ctx, err.Error()))
+		return
+	}
+	if upd.Status != "" && !bookingpg.ValidStatus(upd.Status) {
+		err := errors.New("unknown booking status " + strconv.Quote(upd.Status))
+		span.AddError("invalid booking update", err)
+		c.JSON(http.StatusBadRequest, tracing.ErrorBody(ctx, err.Error()))
+		return
+	}
+
+	if upd.Time != nil {
+		utc := upd.Time.UTC()
+		upd.Time = &utc
+	}
+	b.updateBooking(c, spanCtx, &span, bookingpg.BookingUpdate{Status: upd.Status, Time: upd.Time, Version: upd.Version})
+}
+
+// CancelBooking отменяет бронирование, версию можно передать параметром version.
+// Повторная отмена возвращает то же бронирование
+func (b *BookingHnd) CancelBooking(c *gin.Context) {
+	ctx := c.Request.Context()
+	tracing.TraceLogger(ctx).Debug("CancelBooking()")
+	spanCtx, span := tracing.NewSpan(ctx, "Handler.CancelBooking")
+	defer span.End()
+
+	upd := bookingpg.BookingUpdate{Status: bookingpg.StatusCancelled}
+	if v := c.Query("version"); v != "" {
+		version, err := strconv.Atoi(v)
+		if err != nil {
+			span.AddError("invalid booking version", err)
+			c.JSON(http.StatusBadRequest, tracing.ErrorBody(ctx, "invalid booking version"))
+			return
+		}
+		upd.Version = version
+	}
+
+	b.updateBooking(c, spanCtx, &span, upd)
+}
+
+// updateBooking применяет изменение к бронированию из параметра id и пишет ответ
+func (b *BookingHnd) updateBooking(c *gin.Context, spanCtx context.Context, span *tracing.Span, upd bookingpg.BookingUpdate) {
+	ctx := c.Request.Context()
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		span.AddError("invalid booking id", err)
+		c.JSON(http.StatusBadRequest, tracing.ErrorBody(ctx, "invalid booking id"))
+		return
+	}
+
+	result, err := b.db.UpdateBooking(spanCtx, id, upd)
+	switch {
+	case errors.Is(err, bookingpg.ErrBookingNotFound):
+		span.AddEvent("booking not found")
+		c.JSON(http.StatusNotFound, tracing.ErrorBody(ctx, "booking not found"))
+		return
+	case errors.Is(err, bookingpg.ErrVersionConflict), errors.Is(err, bookingpg.ErrInvalidTransition),
+		errors.Is(err, bookingpg.ErrSlotConflict), errors.Is(err, bookingpg.ErrQuotedReschedule):
+		span.AddError("booking update rejected", err)
+		c.JSON(http.StatusConflict, tracing.ErrorBody(ctx, err.Error()))
+		return
+	case err != nil:
+		span.AddError("db.UpdateBooking returns error", err)
+		tracing.TraceLogger(ctx).ErrorErr("db.UpdateBooking returns error", err)
+		c.JSON(tracing.ErrorStatus(ctx, http.StatusInternalServerError), tracing.ErrorBody(ctx, "db.UpdateBooking returns error"))
+		return
+	}
+
+	booking := result.Booking
+	if booking.Status != result.PrevStatus {
+		span.AddEvent("booking status changed",
+			slog.Int("booking.id", booking.ID),
+			slog.String("booking.status.from", result.PrevStatus),
+			slog.String("booking.status.to", booking.Status),
+			slog.Int("booking.version", booking.Version))
+	} else if result.Changed {
+		span.AddEvent("booking updated", slog.Int("booking.id", booking.ID), slog.Int("booking.version", booking.Version))
+	}
+	c.JSON(http.StatusOK, newBooking(booking))
+}
@@ -0,0 +1,172 @@
+package handler
+
+import (
+	"booking/storage/bookingpg"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"net/http"
+	"otel-jaeger-learn/pkg/money"
+	"otel-jaeger-learn/pkg/tracing"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Размер страницы ListBookings
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+type listResponse struct {
+	Bookings   []Booking `json:"bookings"`
+	NextCursor string    `json:"next_cursor,omitempty"`
+}
+
+// listCursor - последнее бронирование страницы, клиент получает его непрозрачной строкой в next_cursor.
+// Курсор действителен только для тех же сортировки и фильтров (Filter - их хэш): с другими фильтрами, например
+// с другой валютой, keyset сравнивал бы цену из курсора с ценами в другой валюте и выдавал бы не те страницы
+type listCursor struct {
+	Sort   string      `json:"s"`
+	Desc   bool        `json:"d,omitempty"`
+	Filter string      `json:"f"`
+	ID     int         `json:"id"`
+	Time   time.Time   `json:"t"`
+	Price  money.Money `json:"p"`
+}
+
+func encodeCursor(q bookingpg.ListQuery, last bookingpg.Booking) string {
+	data, _ := json.Marshal(listCursor{Sort: q.SortBy, Desc: q.Desc, Filter: filterHash(q.Filter), ID: last.ID, Time: last.Time, Price: last.Price})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// filterHash - хэш фильтров выборки для проверки курсора
+func filterHash(f bookingpg.BookingFilter) string {
+	data, _ := json.Marshal(f)
+	hash := sha256.Sum256(data)
+	return base64.RawURLEncoding.EncodeToString(hash[:12])
+}
+
+func decodeCursor(s string) (listCursor, error) {
+	var cursor listCursor
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return cursor, err
+	}
+	err = json.Unmarshal(data, &cursor)
+	return cursor, err
+}
+
+// parseListQuery разбирает параметры запроса:
+// from, to (RFC3339), currency, min_price, max_price, status, driver_id, sort (time, -time, price, -price), limit, cursor.
+// Фильтр по цене и сортировка по цене требуют currency, суммы в разных валютах не сравниваются
+func parseListQuery(c *gin.Context) (bookingpg.ListQuery, error) {
+	q := bookingpg.ListQuery{SortBy: bookingpg.SortByTime, Limit: defaultPageSize}
+
+	for param, dst := range map[string]*time.Time{"from": &q.Filter.From, "to": &q.Filter.To} {
+		if v := c.Query(param); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return q, fmt.Errorf("%s must be RFC3339 time", param)
+			}
+			// Время в БД хранится в UTC, смещение из запроса в фильтр не переносим
+			*dst = t.UTC()
+		}
+	}
+	q.Filter.Currency = c.Query("currency")
+	for param, dst := range map[string]**money.Money{"min_price": &q.Filter.MinPrice, "max_price": &q.Filter.MaxPrice} {
+		if v := c.Query(param); v != "" {
+			price, err := money.Parse(v, q.Filter.Currency)
+			if err != nil {
+				// Например, больше знаков после точки, чем у валюты: min_price=10.5&currency=JPY
+				return q, fmt.Errorf("%s: %w", param, err)
+			}
+			*dst = &price
+		}
+	}
+	q.Filter.Status = c.Query("status")
+	q.Filter.DriverID = c.Query("driver_id")
+
+	if sort := c.Query("sort"); sort != "" {
+		q.Desc = strings.HasPrefix(sort, "-")
+		q.SortBy = strings.TrimPrefix(sort, "-")
+		if q.SortBy != bookingpg.SortByTime && q.SortBy != bookingpg.SortByPrice {
+			return q, errors.New("sort must be one of time, -time, price, -price")
+		}
+	}
+	if q.Filter.Currency == "" && (q.Filter.MinPrice != nil || q.Filter.MaxPrice != nil || q.SortBy == bookingpg.SortByPrice) {
+		return q, errors.New("currency is required to filter or sort by price")
+	}
+
+	if v := c.Query("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxPageSize {
+			return q, fmt.Errorf("limit must be between 1 and %d", maxPageSize)
+		}
+		q.Limit = limit
+	}
+
+	if v := c.Query("cursor"); v != "" {
+		cursor, err := decodeCursor(v)
+		if err != nil {
+			return q, errors.New("invalid cursor")
+		}
+		if cursor.Sort != q.SortBy || cursor.Desc != q.Desc {
+			return q, errors.New("cursor was issued for another sort order")
+		}
+		if cursor.Filter != filterHash(q.Filter) {
+			return q, errors.New("cursor was issued for other filters")
+		}
+		q.After = &bookingpg.Booking{ID: cursor.ID, Time: cursor.Time, Price: cursor.Price}
+	}
+	return q, nil
+}
+
+func (b *BookingHnd) ListBookings(c *gin.Context) {
+	ctx := c.Request.Context()
+	tracing.TraceLogger(ctx).Debug("ListBookings()")
+	spanCtx, span := tracing.NewSpan(ctx, "Handler.ListBookings")
+	defer span.End()
+
+	q, err := parseListQuery(c)
+	if err != nil {
+		span.AddError("invalid list query", err)
+		c.JSON(http.StatusBadRequest, tracing.ErrorBody(ctx, err.Error()))
+		return
+	}
+
+	// Запрашиваем на одно бронирование больше, чтобы узнать, есть ли следующая страница
+	page := q
+	page.Limit++
+	bookings, err := b.db.ListBookings(spanCtx, page)
+	if err != nil {
+		span.AddError("db.ListBookings returns error", err)
+		tracing.TraceLogger(ctx).ErrorErr("db.ListBookings returns error", err)
+		c.JSON(tracing.ErrorStatus(ctx, http.StatusInternalServerError), tracing.ErrorBody(ctx, "db.ListBookings returns error"))
+		return
+	}
+
+	resp := listResponse{Bookings: []Booking{}}
+	hasMore := len(bookings) > q.Limit
+	if hasMore {
+		bookings = bookings[:q.Limit]
+		resp.NextCursor = encodeCursor(q, bookings[len(bookings)-1])
+	}
+	for _, booking := range bookings {
+		resp.Bookings = append(resp.Bookings, newBooking(booking))
+	}
+
+	trace.SpanFromContext(spanCtx).SetAttributes(
+		attribute.Int("booking.list.count", len(resp.Bookings)),
+		attribute.Int("booking.list.limit", q.Limit),
+		attribute.Bool("booking.list.has_more", hasMore),
+		attribute.String("booking.list.sort", c.DefaultQuery("sort", q.SortBy)),
+	)
+	c.JSON(http.StatusOK, resp)
+}
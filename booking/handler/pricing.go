@@ -0,0 +1,210 @@
+package handler
+
+import (
+	"booking/config"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"otel-jaeger-learn/pkg/money"
+	"otel-jaeger-learn/pkg/quote"
+	"otel-jaeger-learn/pkg/tracing"
+	"otel-jaeger-learn/pkg/tracing/httpclient"
+	"sync"
+	"time"
+)
+
+// Источник цены бронирования, пишется в атрибут span'а booking.price_source
+const (
+	priceSourceCalcs   = "price-calcs"
+	priceSourceCache   = "cache"
+	priceSourceDefault = "default"
+	priceSourceQuote   = "quote"
+)
+
+var (
+	// ErrPriceUnavailable - price-calcs недоступен, и ни одна из стратегий PRICE_FALLBACK не дала цену
+	ErrPriceUnavailable = errors.New("booking price is unavailable")
+	// ErrUnknownDriver - price-calcs не знает водителя из запроса
+	ErrUnknownDriver = errors.New("unknown driver")
+	// ErrInvalidPriceRequest - price-calcs отклонил параметры запроса цены, например неверный id водителя
+	ErrInvalidPriceRequest = errors.New("invalid price request")
+	// ErrQuoteDriverMismatch - предложение цены выдано для другого водителя
+	ErrQuoteDriverMismatch = errors.New("quote is for another driver")
+	// ErrQuoteMismatch - предложение цены выдано на другое время бронирования
+	ErrQuoteMismatch = errors.New("quote is for another booking time")
+	// ErrQuoteCurrencyMismatch - предложение цены выдано в другой валюте
+	ErrQuoteCurrencyMismatch = errors.New("quote is in another currency")
+)
+
+// priceResponse - цена водителя от price-calcs: Price в запрошенной валюте,
+// OriginalPrice - в валюте водителя, Rate - курс перевода между ними
+type priceResponse struct {
+	Price         money.Money `json:"price"`
+	OriginalPrice money.Money `json:"original_price"`
+	Rate          float64     `json:"rate"`
+	DriverID      string      `json:"driver_id"`
+}
+
+// unconverted - цена без перевода в другую валюту
+func unconverted(price money.Money, driverId string) priceResponse {
+	return priceResponse{Price: price, OriginalPrice: price, Rate: 1, DriverID: driverId}
+}
+
+// priceCache хранит последнюю цену от price-calcs по водителю
+type priceCache struct {
+	ttl time.Duration
+
+	mu     sync.Mutex
+	prices map[string]cachedPrice
+}
+
+type cachedPrice struct {
+	price money.Money
+	at    time.Time
+}
+
+func newPriceCache(ttl time.Duration) *priceCache {
+	return &priceCache{ttl: ttl, prices: make(map[string]cachedPrice)}
+}
+
+// set запоминает цену водителя, а также как последнюю цену любого водителя (ключ "")
+// для бронирований, где водитель не выбран
+func (c *priceCache) set(driverId string, price money.Money) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.prices[driverId] = cachedPrice{price: price, at: time.Now()}
+	c.prices[""] = c.prices[driverId]
+}
+
+func (c *priceCache) get(driverId string) (money.Money, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cached, ok := c.prices[driverId]
+	if !ok || (c.ttl > 0 && time.Since(cached.at) > c.ttl) {
+		return money.Money{}, false
+	}
+	return cached.price, true
+}
+
+// bookingPrice запрашивает цену водителя driverId на время at у price-calcs (пустой - водителя выбирает price-calcs),
+// а если он недоступен или ответил некорректно - пробует стратегии PRICE_FALLBACK.
+// Если задан currency, price-calcs переводит цену в эту валюту, а запасная цена подходит, только если она уже в ней.
+// estimated = true, если цена не от price-calcs, тогда водитель в ответе тот же, что и в запросе.
+func (b *BookingHnd) bookingPrice(ctx context.Context, driverId string, at time.Time, currency string) (priced priceResponse, estimated bool, err error) {
+	span := trace.SpanFromContext(ctx)
+
+	// Цена зависит от времени бронирования (надбавки по времени суток и дням недели)
+	query := url.Values{"time": {at.Format(time.RFC3339)}}
+	if driverId != "" {
+		query.Set("driver_id", driverId)
+	}
+	if currency != "" {
+		query.Set("currency", currency)
+	}
+	resp, err := httpclient.GetJSON[priceResponse](ctx, b.client, fmt.Sprintf("%s/booking-price?%s", b.cfg.CalcPricesAddr, query.Encode()))
+	// Цены для несуществующего водителя или неверного запроса нет и в кэше, подставлять её нельзя
+	var statusErr *httpclient.StatusError
+	if errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusNotFound {
+		return priced, false, fmt.Errorf("%w %q", ErrUnknownDriver, driverId)
+	}
+	// 422 - нет курса для перевода в запрошенную валюту
+	if errors.As(err, &statusErr) && (statusErr.StatusCode == http.StatusBadRequest || statusErr.StatusCode == http.StatusUnprocessableEntity) {
+		var body struct {
+			Error string `json:"error"`
+		}
+		_ = json.Unmarshal(statusErr.Body, &body)
+		return priced, false, fmt.Errorf("%w: %s", ErrInvalidPriceRequest, body.Error)
+	}
+	if err == nil && (resp.Price.IsNegative() || resp.Price.Currency == "" || (currency != "" && resp.Price.Currency != currency)) {
+		err = fmt.Errorf("invalid price %v from price calc service", resp.Price)
+	}
+	// Без курса price-calcs цену не переводил, и она уже в запрошенной валюте
+	if err == nil && resp.Rate <= 0 {
+		resp = unconverted(resp.Price, resp.DriverID)
+	}
+	if err == nil {
+		// В кэше цена в валюте водителя: курс на момент fallback'а уже может быть другим
+		b.prices.set(resp.DriverID, resp.OriginalPrice)
+		span.SetAttributes(
+			attribute.String("booking.price_source", priceSourceCalcs),
+			attribute.String("driver.id", resp.DriverID),
+			attribute.String("price.currency", resp.Price.Currency),
+			attribute.Float64("currency.rate", resp.Rate),
+		)
+		return resp, false, nil
+	}
+	// Ошибка price-calcs ещё не ошибка бронирования, если сработает fallback
+	tracing.TraceEvent(ctx, "price calc service is unavailable", slog.String("error", err.Error()))
+
+	// По дедлайну запроса нет смысла подставлять цену, клиент уже не ждёт ответа
+	if ctx.Err() != nil {
+		return priced, false, ctx.Err()
+	}
+
+	var price money.Money
+	for _, fallback := range b.cfg.PriceFallback {
+		source := ""
+		switch fallback {
+		case config.PriceFallbackCache:
+			if cached, ok := b.prices.get(driverId); ok {
+				price, source = cached, priceSourceCache
+			}
+		case config.PriceFallbackDefault:
+			price, source = b.cfg.DefaultPrice, priceSourceDefault
+		}
+		if fallback == config.PriceFallbackReject {
+			break
+		}
+		// Курса без price-calcs нет, цену в другой валюте подставлять нельзя
+		if source != "" && currency != "" && price.Currency != currency {
+			tracing.TraceEvent(ctx, "fallback price is in another currency",
+				slog.String("source", source), slog.String("price", price.String()), slog.String("currency", currency))
+			continue
+		}
+		if source != "" {
+			span.SetAttributes(
+				attribute.String("booking.price_source", source),
+				attribute.Bool("booking.price_estimated", true),
+			)
+			tracing.TraceLogger(ctx).Warn("booking price is estimated",
+				slog.String("source", source), slog.String("price", price.String()))
+			return unconverted(price, driverId), true, nil
+		}
+	}
+
+	span.SetAttributes(attribute.String("booking.price_source", "none"))
+	return priced, false, fmt.Errorf("%w: %v", ErrPriceUnavailable, err)
+}
+
+// verifyQuote проверяет подпись и срок действия предложения цены, что оно выдано водителю driverId (если задан)
+// в валюте currency (если задана) и на время бронирования at: цена зависит от времени,
+// и предложение на другое время её бы подменило
+func (b *BookingHnd) verifyQuote(ctx context.Context, token, driverId string, at time.Time, currency string) (quote.Quote, error) {
+	q, err := b.quotes.Verify(token, time.Now())
+	if err != nil {
+		return q, err
+	}
+	if !q.Time.Equal(at) {
+		return q, fmt.Errorf("%w: quote time %s, requested %s", ErrQuoteMismatch, q.Time.Format(time.RFC3339), at.Format(time.RFC3339))
+	}
+	if driverId != "" && driverId != q.DriverID {
+		return q, fmt.Errorf("%w: quote driver %q, requested %q", ErrQuoteDriverMismatch, q.DriverID, driverId)
+	}
+	if currency != "" && currency != q.Price.Currency {
+		return q, fmt.Errorf("%w: quote currency %s, requested %s", ErrQuoteCurrencyMismatch, q.Price.Currency, currency)
+	}
+	trace.SpanFromContext(ctx).SetAttributes(
+		attribute.String("booking.price_source", priceSourceQuote),
+		attribute.String("quote.id", q.ID),
+		attribute.String("driver.id", q.DriverID),
+		attribute.String("price.currency", q.Price.Currency),
+		attribute.Float64("currency.rate", q.Rate),
+	)
+	return q, nil
+}
@@ -0,0 +1,13 @@
+package handler
+
+import "github.com/gin-gonic/gin"
+
+// RegisterRoutes регистрирует маршруты сервиса booking
+func RegisterRoutes(router gin.IRouter, bookingHandler *BookingHnd) {
+	router.POST("/add-booking", func(c *gin.Context) { bookingHandler.AddBooking(c) })
+	router.GET("/list-bookings", func(c *gin.Context) { bookingHandler.ListBookings(c) })
+	router.GET("/get-booking/:id", func(c *gin.Context) { bookingHandler.GetBooking(c) })
+	router.PATCH("/update-booking/:id", func(c *gin.Context) { bookingHandler.UpdateBooking(c) })
+	router.DELETE("/cancel-booking/:id", func(c *gin.Context) { bookingHandler.CancelBooking(c) })
+	router.GET("/driver-availability/:driver", func(c *gin.Context) { bookingHandler.DriverAvailability(c) })
+}
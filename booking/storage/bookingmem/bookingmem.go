@@ -0,0 +1,263 @@
+// Package bookingmem - хранилище бронирований в памяти, повторяет API bookingpg для тестов
+package bookingmem
+
+import (
+	"booking/storage/bookingpg"
+	"context"
+	"fmt"
+	"go.opentelemetry.io/otel"
+	semconv "go.opentelemetry.io/otel/semconv/v1.22.0"
+	"go.opentelemetry.io/otel/trace"
+	"sort"
+	"sync"
+	"time"
+)
+
+const tracerName = "booking/storage/bookingmem"
+
+// Storage хранит бронирования в памяти
+type Storage struct {
+	mu       sync.Mutex
+	bookings []bookingpg.Booking
+	audit    []AuditRecord
+	keys     map[string]*idempotencyKey
+	slots    map[int]bookingpg.Slot // по ID бронирования
+}
+
+type idempotencyKey struct {
+	requestHash string
+	createdAt   time.Time
+	lockedUntil time.Time
+	response    *bookingpg.IdempotentResponse
+}
+
+// AuditRecord - смена статуса бронирования, как строка booking_audit
+type AuditRecord struct {
+	BookingID int
+	From, To  string
+	Version   int
+}
+
+// NewStorage создает пустое хранилище
+func NewStorage() *Storage {
+	return &Storage{keys: make(map[string]*idempotencyKey), slots: make(map[int]bookingpg.Slot)}
+}
+
+// AddBooking добавляет новое бронирование с версией 1, booking.ID и booking.Version игнорируются
+func (s *Storage) AddBooking(ctx context.Context, booking bookingpg.Booking) (int, error) {
+	_, span := startSpan(ctx, "INSERT")
+	defer span.End()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	booking.ID = len(s.bookings) + 1
+	booking.Version = 1
+	if booking.Slot != nil {
+		if err := s.checkSlot(booking.ID, *booking.Slot); err != nil {
+			return 0, err
+		}
+		s.slots[booking.ID] = *booking.Slot
+	}
+	s.bookings = append(s.bookings, booking)
+	s.audit = append(s.audit, AuditRecord{BookingID: booking.ID, To: booking.Status, Version: 1})
+	return booking.ID, nil
+}
+
+// UpdateBooking изменяет бронирование по тем же правилам, что и bookingpg
+func (s *Storage) UpdateBooking(ctx context.Context, id int, upd bookingpg.BookingUpdate) (bookingpg.UpdateResult, error) {
+	_, span := startSpan(ctx, "UPDATE")
+	defer span.End()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if id < 1 || id > len(s.bookings) {
+		return bookingpg.UpdateResult{}, fmt.Errorf("%w: id %d", bookingpg.ErrBookingNotFound, id)
+	}
+	prev := s.bookings[id-1]
+	result, err := bookingpg.ApplyUpdate(prev, upd)
+	if err != nil || !result.Changed {
+		return result, err
+	}
+	if slot, ok := s.slots[id]; ok {
+		switch {
+		case result.Booking.Status == bookingpg.StatusCancelled:
+			delete(s.slots, id)
+		case !result.Booking.Time.Equal(prev.Time):
+			moved := bookingpg.Slot{DriverID: slot.DriverID, Start: result.Booking.Time, End: result.Booking.Time.Add(slot.End.Sub(slot.Start))}
+			if err := s.checkSlot(id, moved); err != nil {
+				return bookingpg.UpdateResult{}, err
+			}
+			s.slots[id] = moved
+		}
+	}
+	s.bookings[id-1] = result.Booking
+	if result.Booking.Status != prev.Status {
+		s.audit = append(s.audit, AuditRecord{BookingID: id, From: prev.Status, To: result.Booking.Status, Version: result.Booking.Version})
+	}
+	return result, nil
+}
+
+// GetBookingById получает бронирование по ID
+func (s *Storage) GetBookingById(ctx context.Context, id int) (*bookingpg.Booking, error) {
+	_, span := startSpan(ctx, "SELECT")
+	defer span.End()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, b := range s.bookings {
+		if b.ID == id {
+			booking := b
+			return &booking, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: id %d", bookingpg.ErrBookingNotFound, id)
+}
+
+// ListBookings возвращает страницу бронирований с той же фильтрацией и порядком, что и bookingpg
+func (s *Storage) ListBookings(ctx context.Context, q bookingpg.ListQuery) ([]bookingpg.Booking, error) {
+	_, span := startSpan(ctx, "SELECT")
+	defer span.End()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var bookings []bookingpg.Booking
+	for _, b := range s.bookings {
+		if matches(b, q.Filter) && (q.After == nil || less(*q.After, b, q)) {
+			bookings = append(bookings, b)
+		}
+	}
+	sort.Slice(bookings, func(i, j int) bool { return less(bookings[i], bookings[j], q) })
+	if len(bookings) > q.Limit {
+		bookings = bookings[:q.Limit]
+	}
+	return bookings, nil
+}
+
+// matches проверяет фильтр, суммы сравниваются точно: фильтр по цене задаётся вместе с валютой
+func matches(b bookingpg.Booking, f bookingpg.BookingFilter) bool {
+	return (f.From.IsZero() || !b.Time.Before(f.From)) &&
+		(f.To.IsZero() || b.Time.Before(f.To)) &&
+		(f.Currency == "" || b.Price.Currency == f.Currency) &&
+		(f.MinPrice == nil || b.Price.Amount >= f.MinPrice.Amount) &&
+		(f.MaxPrice == nil || b.Price.Amount <= f.MaxPrice.Amount) &&
+		(f.Status == "" || b.Status == f.Status) &&
+		(f.DriverID == "" || b.DriverID == f.DriverID)
+}
+
+// less сравнивает пары (поле сортировки, ID) в порядке запроса
+func less(a, b bookingpg.Booking, q bookingpg.ListQuery) bool {
+	if q.Desc {
+		a, b = b, a
+	}
+	switch {
+	case q.SortBy == bookingpg.SortByPrice && a.Price.Amount != b.Price.Amount:
+		return a.Price.Amount < b.Price.Amount
+	case q.SortBy != bookingpg.SortByPrice && !a.Time.Equal(b.Time):
+		return a.Time.Before(b.Time)
+	}
+	return a.ID < b.ID
+}
+
+// ClaimIdempotencyKey занимает ключ по тем же правилам, что и bookingpg
+func (s *Storage) ClaimIdempotencyKey(ctx context.Context, key, requestHash string, retention, lease time.Duration) (*bookingpg.IdempotentResponse, error) {
+	_, span := startSpan(ctx, "INSERT")
+	defer span.End()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	saved, ok := s.keys[key]
+	if !ok || now.Sub(saved.createdAt) > retention || (saved.response == nil && now.After(saved.lockedUntil)) {
+		s.keys[key] = &idempotencyKey{requestHash: requestHash, createdAt: now, lockedUntil: now.Add(lease)}
+		return nil, nil
+	}
+	if saved.requestHash != requestHash {
+		return nil, bookingpg.ErrIdempotencyConflict
+	}
+	if saved.response == nil {
+		return nil, bookingpg.ErrIdempotencyInProgress
+	}
+	return saved.response, nil
+}
+
+// SaveIdempotentResponse сохраняет ответ на запрос с занятым ключом
+func (s *Storage) SaveIdempotentResponse(ctx context.Context, key string, resp bookingpg.IdempotentResponse) error {
+	_, span := startSpan(ctx, "UPDATE")
+	defer span.End()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if saved, ok := s.keys[key]; ok {
+		saved.response = &resp
+	}
+	return nil
+}
+
+// ReleaseIdempotencyKey освобождает ключ запроса, который не выполнился
+func (s *Storage) ReleaseIdempotencyKey(ctx context.Context, key string) error {
+	_, span := startSpan(ctx, "DELETE")
+	defer span.End()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if saved, ok := s.keys[key]; ok && saved.response == nil {
+		delete(s.keys, key)
+	}
+	return nil
+}
+
+// DriverAvailability возвращает свободные промежутки водителя в [from, to)
+func (s *Storage) DriverAvailability(ctx context.Context, driverId string, from, to time.Time) ([]bookingpg.Slot, error) {
+	_, span := startSpan(ctx, "SELECT")
+	defer span.End()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	window := bookingpg.Slot{DriverID: driverId, Start: from, End: to}
+	var busy []bookingpg.Slot
+	for _, slot := range s.slots {
+		if slot.Overlaps(window) {
+			busy = append(busy, slot)
+		}
+	}
+	sort.Slice(busy, func(i, j int) bool { return busy[i].Start.Before(busy[j].Start) })
+	return bookingpg.FreeSlots(driverId, busy, from, to), nil
+}
+
+// checkSlot проверяет, что slot не пересекается со слотами других бронирований, как ограничение driver_slots
+func (s *Storage) checkSlot(bookingId int, slot bookingpg.Slot) error {
+	for id, other := range s.slots {
+		if id != bookingId && slot.Overlaps(other) {
+			return fmt.Errorf("%w: driver %s at %s", bookingpg.ErrSlotConflict, slot.DriverID, slot.Start.Format(time.RFC3339))
+		}
+	}
+	return nil
+}
+
+// Audit возвращает копию журнала смен статуса
+func (s *Storage) Audit() []AuditRecord {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]AuditRecord(nil), s.audit...)
+}
+
+// Bookings возвращает копию всех сохранённых бронирований
+func (s *Storage) Bookings() []bookingpg.Booking {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]bookingpg.Booking(nil), s.bookings...)
+}
+
+// startSpan создаёт span запроса к "базе", как это делает otelsql для настоящей БД
+func startSpan(ctx context.Context, operation string) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, "bookingmem."+operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.DBSystemKey.String("memory"), semconv.DBOperation(operation)),
+	)
+}
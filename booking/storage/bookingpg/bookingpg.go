@@ -3,18 +3,49 @@ package bookingpg
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"github.com/XSAM/otelsql"
 	_ "github.com/lib/pq"
 	semconv "go.opentelemetry.io/otel/semconv/v1.22.0"
+	"otel-jaeger-learn/pkg/money"
 	"time"
 )
 
+// ErrBookingNotFound - бронирования с таким ID нет
+var ErrBookingNotFound = errors.New("booking not found")
+
+// Статусы бронирования
+const (
+	StatusPending   = "pending"
+	StatusConfirmed = "confirmed"
+	StatusCompleted = "completed"
+	StatusCancelled = "cancelled"
+)
+
 // Booking представляет собой запись о бронировании
 type Booking struct {
-	ID    int
-	Price float64
-	Time  time.Time
+	ID int
+	// Price - цена в валюте клиента, валюта хранится в колонке currency
+	Price money.Money
+	// OriginalPrice - цена в валюте водителя, Rate - курс, по которому она переведена в Price (1 - без конвертации).
+	// Rate хранится в NUMERIC(20, 10) без потерь: у курсов не больше 10 знаков после точки (так их хранит
+	// currency_rates и проверяет rates.NewStatic), lib/pq пишет float64 кратчайшей десятичной записью,
+	// а при чтении она разбирается в тот же float64. Price по курсу не пересчитывается, она хранится отдельно
+	OriginalPrice money.Money
+	Rate          float64
+	Time          time.Time
+	// Цена не от price-calcs, а из кэша или цена по умолчанию - финансам нужно её сверить
+	PriceEstimated bool
+	Status         string
+	// Version увеличивается при каждом изменении, по ней UpdateBooking отклоняет устаревшие изменения
+	Version int
+	// DriverID - водитель, по цене которого посчитано бронирование, пустой - если price-calcs был недоступен
+	DriverID string
+	// QuoteID - подписанное предложение price-calcs, по которому забронирована цена, пустой - цена запрошена при бронировании
+	QuoteID string
+	// Slot - время водителя, которое занимает бронирование, nil - водитель не выбран
+	Slot *Slot
 }
 
 // Storage предоставляет методы для работы с базой данных
@@ -48,29 +79,88 @@ func (s *Storage) mustInitTable() error {
 	if err != nil {
 		return fmt.Errorf("failed to create table: %w", err)
 	}
+
+	// Колонки, добавленные после создания таблицы
+	migrations := []string{
+		"ALTER TABLE bookings ADD COLUMN IF NOT EXISTS price_estimated BOOLEAN NOT NULL DEFAULT false;",
+		"ALTER TABLE bookings ADD COLUMN IF NOT EXISTS status TEXT NOT NULL DEFAULT 'confirmed';",
+		// Индексы под сортировки ListBookings
+		"CREATE INDEX IF NOT EXISTS bookings_time_id_idx ON bookings (time, id);",
+		"CREATE INDEX IF NOT EXISTS bookings_price_id_idx ON bookings (price, id);",
+		"ALTER TABLE bookings ADD COLUMN IF NOT EXISTS version INT NOT NULL DEFAULT 1;",
+		// Все смены статуса, from_status пустой при создании
+		"CREATE TABLE IF NOT EXISTS booking_audit (id SERIAL PRIMARY KEY, booking_id INT NOT NULL REFERENCES bookings (id), from_status TEXT NOT NULL, to_status TEXT NOT NULL, version INT NOT NULL, time TIMESTAMP NOT NULL);",
+		// Ответы на POST /add-booking по ключу идемпотентности, status пустой, пока запрос выполняется
+		"CREATE TABLE IF NOT EXISTS idempotency_keys (key TEXT PRIMARY KEY, request_hash TEXT NOT NULL, status INT, response BYTEA, created_at TIMESTAMP NOT NULL);",
+		// Занятое время водителей: ограничение не даёт вставить пересекающиеся слоты одного водителя
+		// даже из параллельных транзакций
+		"ALTER TABLE bookings ADD COLUMN IF NOT EXISTS driver_id TEXT NOT NULL DEFAULT '';",
+		"CREATE INDEX IF NOT EXISTS bookings_driver_id_idx ON bookings (driver_id);",
+		"ALTER TABLE bookings ADD COLUMN IF NOT EXISTS quote_id TEXT NOT NULL DEFAULT '';",
+		"CREATE EXTENSION IF NOT EXISTS btree_gist;",
+		"CREATE TABLE IF NOT EXISTS driver_slots (booking_id INT PRIMARY KEY REFERENCES bookings (id), driver_id TEXT NOT NULL, during TSRANGE NOT NULL, CONSTRAINT driver_slots_no_overlap EXCLUDE USING gist (driver_id WITH =, during WITH &&));",
+		// До введения валюты все цены были в рублях
+		"ALTER TABLE bookings ADD COLUMN IF NOT EXISTS currency TEXT NOT NULL DEFAULT 'RUB';",
+		// Цена до конвертации в валюту клиента и курс; до их появления цены не конвертировались
+		"ALTER TABLE bookings ADD COLUMN IF NOT EXISTS original_price NUMERIC(12, 3);",
+		"ALTER TABLE bookings ADD COLUMN IF NOT EXISTS original_currency TEXT;",
+		"ALTER TABLE bookings ADD COLUMN IF NOT EXISTS rate NUMERIC(20, 10) NOT NULL DEFAULT 1;",
+		"UPDATE bookings SET original_price = price, original_currency = currency WHERE original_price IS NULL;",
+		// До какого момента ключ занят выполняющимся запросом, после - его может занять повтор
+		"ALTER TABLE idempotency_keys ADD COLUMN IF NOT EXISTS locked_until TIMESTAMP;",
+		// DECIMAL(10, 2) округлял цены в валютах с тремя знаками после точки (KWD, BHD, ...). Смена типа блокирует
+		// таблицу, поэтому только если колонки ещё не расширены
+		`DO $$ BEGIN
+			IF EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name = 'bookings'
+				AND column_name IN ('price', 'original_price') AND (numeric_precision, numeric_scale) <> (12, 3)) THEN
+				ALTER TABLE bookings ALTER COLUMN price TYPE NUMERIC(12, 3), ALTER COLUMN original_price TYPE NUMERIC(12, 3);
+			END IF;
+		END $$;`,
+	}
+	for _, migration := range migrations {
+		if _, err := s.db.Exec(migration); err != nil {
+			return fmt.Errorf("failed to migrate table: %w", err)
+		}
+	}
 	return nil
 }
 
-// AddBooking добавляет новое бронирование в базу данных
-func (s *Storage) AddBooking(ctx context.Context, price float64, time time.Time) (int, error) {
+// AddBooking добавляет новое бронирование в базу данных с версией 1, booking.ID и booking.Version игнорируются
+func (s *Storage) AddBooking(ctx context.Context, booking Booking) (int, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
 	var id int
-	query := `INSERT INTO bookings (price, time) VALUES ($1, $2) RETURNING id`
-	err := s.db.QueryRowContext(ctx, query, price, time).Scan(&id)
+	query := `INSERT INTO bookings (price, currency, original_price, original_currency, rate, time, price_estimated, status, version, driver_id, quote_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, 1, $9, $10) RETURNING id`
+	// ctx несёт дедлайн запроса, lib/pq отменяет выполняющийся запрос на сервере, когда он истекает
+	err = tx.QueryRowContext(ctx, query, booking.Price, booking.Price.Currency, booking.OriginalPrice, booking.OriginalPrice.Currency, booking.Rate, booking.Time, booking.PriceEstimated, booking.Status, booking.DriverID, booking.QuoteID).Scan(&id)
 	if err != nil {
 		return 0, err
 	}
-	return id, nil
+	if err := insertAudit(ctx, tx, id, "", booking.Status, 1); err != nil {
+		return 0, err
+	}
+	if booking.Slot != nil {
+		if err := insertSlot(ctx, tx, id, *booking.Slot); err != nil {
+			return 0, err
+		}
+	}
+	return id, tx.Commit()
 }
 
 // GetBookingById получает бронирование по ID
 func (s *Storage) GetBookingById(ctx context.Context, id int) (*Booking, error) {
 	var booking Booking
-	query := `SELECT id, price, time FROM bookings WHERE id = $1`
+	query := `SELECT id, currency, price, original_currency, original_price, rate, time, price_estimated, status, version, driver_id, quote_id FROM bookings WHERE id = $1`
 	row := s.db.QueryRowContext(ctx, query, id)
-	err := row.Scan(&booking.ID, &booking.Price, &booking.Time)
+	err := row.Scan(&booking.ID, &booking.Price.Currency, &booking.Price, &booking.OriginalPrice.Currency, &booking.OriginalPrice, &booking.Rate, &booking.Time, &booking.PriceEstimated, &booking.Status, &booking.Version, &booking.DriverID, &booking.QuoteID)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("no booking with id %d", id)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("%w: id %d", ErrBookingNotFound, id)
 		}
 		return nil, err
 	}
@@ -0,0 +1,99 @@
+package bookingpg
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+var (
+	// ErrIdempotencyConflict - ключ уже использован запросом с другим телом
+	ErrIdempotencyConflict = errors.New("idempotency key was used with another request")
+	// ErrIdempotencyInProgress - запрос с этим ключом ещё выполняется
+	ErrIdempotencyInProgress = errors.New("request with this idempotency key is in progress")
+)
+
+// IdempotentResponse - сохранённый ответ на запрос с ключом идемпотентности
+type IdempotentResponse struct {
+	Status int
+	Body   []byte
+}
+
+// ClaimIdempotencyKey занимает ключ для запроса с хэшем requestHash на время lease. Если запрос с этим ключом
+// уже выполнен, возвращает его ответ. Ключи старше retention считаются свободными, как и ключи запросов,
+// которые не сохранили ответ за lease (например, сервис перезапустился посреди запроса)
+func (s *Storage) ClaimIdempotencyKey(ctx context.Context, key, requestHash string, retention, lease time.Duration) (*IdempotentResponse, error) {
+	saved, err := s.claimIdempotencyKey(ctx, key, requestHash, retention, lease)
+	if errors.Is(err, errIdempotencyKeyReleased) {
+		// Ключ освободили между вставкой и чтением, теперь его можно занять
+		saved, err = s.claimIdempotencyKey(ctx, key, requestHash, retention, lease)
+	}
+	if errors.Is(err, errIdempotencyKeyReleased) {
+		// Освободили снова: ключ всё это время занимают и освобождают другие запросы
+		return nil, ErrIdempotencyInProgress
+	}
+	return saved, err
+}
+
+// errIdempotencyKeyReleased - ключ был занят при вставке, но освобождён до чтения
+var errIdempotencyKeyReleased = errors.New("idempotency key was released")
+
+func (s *Storage) claimIdempotencyKey(ctx context.Context, key, requestHash string, retention, lease time.Duration) (*IdempotentResponse, error) {
+	now := time.Now()
+	// Из параллельных запросов с одним ключом вставка пройдёт только у одного: остальные
+	// ждут на блокировке строки и после её коммита попадают в ON CONFLICT.
+	// У ключей, занятых до появления locked_until, срок считается от created_at
+	query := `INSERT INTO idempotency_keys (key, request_hash, created_at, locked_until) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (key) DO UPDATE SET request_hash = EXCLUDED.request_hash, created_at = EXCLUDED.created_at,
+			locked_until = EXCLUDED.locked_until, status = NULL, response = NULL
+		WHERE idempotency_keys.created_at < $5
+			OR (idempotency_keys.status IS NULL AND COALESCE(idempotency_keys.locked_until, idempotency_keys.created_at) < $3)`
+	res, err := s.db.ExecContext(ctx, query, key, requestHash, now, now.Add(lease), now.Add(-retention))
+	if err != nil {
+		return nil, err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return nil, err
+	} else if n == 1 {
+		return nil, nil
+	}
+
+	var savedHash string
+	var status sql.NullInt64
+	var body []byte
+	query = `SELECT request_hash, status, response FROM idempotency_keys WHERE key = $1`
+	err = s.db.QueryRowContext(ctx, query, key).Scan(&savedHash, &status, &body)
+	if errors.Is(err, sql.ErrNoRows) {
+		// Первый запрос завершился ошибкой и освободил ключ
+		return nil, errIdempotencyKeyReleased
+	}
+	if err != nil {
+		return nil, err
+	}
+	return savedResponse(savedHash, requestHash, status, body)
+}
+
+// savedResponse проверяет запись ключа, занятого другим запросом
+func savedResponse(savedHash, requestHash string, status sql.NullInt64, body []byte) (*IdempotentResponse, error) {
+	if savedHash != requestHash {
+		return nil, ErrIdempotencyConflict
+	}
+	if !status.Valid {
+		return nil, ErrIdempotencyInProgress
+	}
+	return &IdempotentResponse{Status: int(status.Int64), Body: body}, nil
+}
+
+// SaveIdempotentResponse сохраняет ответ на запрос с занятым ключом
+func (s *Storage) SaveIdempotentResponse(ctx context.Context, key string, resp IdempotentResponse) error {
+	_, err := s.db.ExecContext(ctx, `UPDATE idempotency_keys SET status = $1, response = $2 WHERE key = $3`,
+		resp.Status, resp.Body, key)
+	return err
+}
+
+// ReleaseIdempotencyKey освобождает ключ запроса, который не выполнился, чтобы его можно было повторить
+func (s *Storage) ReleaseIdempotencyKey(ctx context.Context, key string) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM idempotency_keys WHERE key = $1 AND status IS NULL`, key)
+	return err
+}
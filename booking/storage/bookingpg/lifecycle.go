@@ -0,0 +1,151 @@
+package bookingpg
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	// ErrVersionConflict - бронирование изменили после того, как клиент его прочитал
+	ErrVersionConflict = errors.New("booking version conflict")
+	// ErrInvalidTransition - переход из текущего статуса в запрошенный запрещён
+	ErrInvalidTransition = errors.New("invalid booking status transition")
+	// ErrQuotedReschedule - цена предложения действует только на его время, поэтому бронирование по нему не переносится
+	ErrQuotedReschedule = errors.New("booking with quoted price can't be rescheduled")
+)
+
+// Разрешённые переходы: pending -> confirmed -> completed, отменить можно до завершения
+var transitions = map[string][]string{
+	StatusPending:   {StatusConfirmed, StatusCancelled},
+	StatusConfirmed: {StatusCompleted, StatusCancelled},
+}
+
+// ValidStatus сообщает, известен ли статус
+func ValidStatus(status string) bool {
+	switch status {
+	case StatusPending, StatusConfirmed, StatusCompleted, StatusCancelled:
+		return true
+	}
+	return false
+}
+
+// CanTransition сообщает, можно ли перевести бронирование из статуса from в to
+func CanTransition(from, to string) bool {
+	for _, allowed := range transitions[from] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
+
+// BookingUpdate - изменение бронирования, нулевые поля не меняются
+type BookingUpdate struct {
+	Status string
+	Time   *time.Time
+	// Version - версия, которую видел клиент, 0 - не проверять
+	Version int
+}
+
+// UpdateResult - бронирование после изменения и статус до него
+type UpdateResult struct {
+	Booking    Booking
+	PrevStatus string
+	// Changed - false, если бронирование уже было в запрошенном состоянии (повтор запроса)
+	Changed bool
+}
+
+// ApplyUpdate проверяет изменение и применяет его к b, увеличивая версию. При переносе цена не пересчитывается:
+// бронирование сохраняет цену, по которой было создано, даже если на новое время действуют другие надбавки
+func ApplyUpdate(b Booking, upd BookingUpdate) (UpdateResult, error) {
+	result := UpdateResult{Booking: b, PrevStatus: b.Status}
+	if upd.Time != nil && upd.Time.Equal(b.Time) {
+		// Перенос на то же время - не изменение, как и повтор статуса
+		upd.Time = nil
+	}
+	if upd.Time == nil && (upd.Status == "" || upd.Status == b.Status) {
+		// Повторная отмена или подтверждение ничего не меняет и не конфликтует по версии
+		return result, nil
+	}
+	if upd.Version != 0 && upd.Version != b.Version {
+		return result, fmt.Errorf("%w: booking %d has version %d, got %d", ErrVersionConflict, b.ID, b.Version, upd.Version)
+	}
+	if upd.Status != "" && upd.Status != b.Status {
+		if !CanTransition(b.Status, upd.Status) {
+			return result, fmt.Errorf("%w: %s -> %s", ErrInvalidTransition, b.Status, upd.Status)
+		}
+		result.Booking.Status = upd.Status
+	}
+	if upd.Time != nil {
+		if len(transitions[b.Status]) == 0 {
+			return result, fmt.Errorf("%w: %s booking can't be rescheduled", ErrInvalidTransition, b.Status)
+		}
+		if b.QuoteID != "" {
+			return result, fmt.Errorf("%w: booking %d has quote %s", ErrQuotedReschedule, b.ID, b.QuoteID)
+		}
+		result.Booking.Time = *upd.Time
+	}
+	result.Booking.Version++
+	result.Changed = true
+	return result, nil
+}
+
+// UpdateBooking изменяет бронирование, проверяя версию и переход статуса. Смена статуса пишется в booking_audit
+func (s *Storage) UpdateBooking(ctx context.Context, id int, upd BookingUpdate) (UpdateResult, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return UpdateResult{}, err
+	}
+	defer tx.Rollback()
+
+	// FOR UPDATE блокирует строку до конца транзакции, параллельные изменения ждут и видят новую версию
+	var b Booking
+	query := `SELECT id, currency, price, original_currency, original_price, rate, time, price_estimated, status, version, driver_id, quote_id FROM bookings WHERE id = $1 FOR UPDATE`
+	err = tx.QueryRowContext(ctx, query, id).Scan(&b.ID, &b.Price.Currency, &b.Price, &b.OriginalPrice.Currency, &b.OriginalPrice, &b.Rate, &b.Time, &b.PriceEstimated, &b.Status, &b.Version, &b.DriverID, &b.QuoteID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return UpdateResult{}, fmt.Errorf("%w: id %d", ErrBookingNotFound, id)
+	}
+	if err != nil {
+		return UpdateResult{}, err
+	}
+
+	result, err := ApplyUpdate(b, upd)
+	if err != nil || !result.Changed {
+		return result, err
+	}
+
+	nb := result.Booking
+	_, err = tx.ExecContext(ctx, `UPDATE bookings SET status = $1, time = $2, version = $3 WHERE id = $4`,
+		nb.Status, nb.Time, nb.Version, id)
+	if err != nil {
+		return UpdateResult{}, err
+	}
+	if nb.Status != b.Status {
+		if err := insertAudit(ctx, tx, id, b.Status, nb.Status, nb.Version); err != nil {
+			return UpdateResult{}, err
+		}
+	}
+	// Отменённое бронирование освобождает время водителя, перенесённое - занимает новое
+	switch {
+	case nb.Status == StatusCancelled:
+		err = releaseSlot(ctx, tx, id)
+	case !nb.Time.Equal(b.Time):
+		err = moveSlot(ctx, tx, id, nb.Time)
+	}
+	if err != nil {
+		return UpdateResult{}, err
+	}
+	return result, tx.Commit()
+}
+
+func insertAudit(ctx context.Context, tx *sql.Tx, bookingId int, from, to string, version int) error {
+	query := `INSERT INTO booking_audit (booking_id, from_status, to_status, version, time) VALUES ($1, $2, $3, $4, $5)`
+	_, err := tx.ExecContext(ctx, query, bookingId, from, to, version, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to write booking audit: %w", err)
+	}
+	return nil
+}
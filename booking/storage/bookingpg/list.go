@@ -0,0 +1,112 @@
+package bookingpg
+
+import (
+	"context"
+	"fmt"
+	"otel-jaeger-learn/pkg/money"
+	"strings"
+	"time"
+)
+
+// Поля сортировки ListBookings
+const (
+	SortByTime  = "time"
+	SortByPrice = "price"
+)
+
+// BookingFilter - условия выборки бронирований, нулевые поля не фильтруют
+type BookingFilter struct {
+	From     time.Time    // time >= From
+	To       time.Time    // time < To
+	Currency string       // суммы в разных валютах не сравниваются, нужна для MinPrice, MaxPrice и сортировки по цене
+	MinPrice *money.Money // в валюте Currency
+	MaxPrice *money.Money
+	Status   string
+	DriverID string
+}
+
+// ListQuery - параметры страницы ListBookings. Порядок всегда дополняется ID,
+// поэтому он стабилен и при одинаковых time или price
+type ListQuery struct {
+	Filter BookingFilter
+	SortBy string // SortByTime или SortByPrice
+	Desc   bool
+	// After - последнее бронирование предыдущей страницы, выборка продолжается после него
+	After *Booking
+	Limit int
+}
+
+// ListBookings возвращает до q.Limit бронирований, подходящих под фильтр, в порядке q.SortBy
+func (s *Storage) ListBookings(ctx context.Context, q ListQuery) ([]Booking, error) {
+	var where []string
+	var args []any
+	arg := func(v any) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	f := q.Filter
+	if !f.From.IsZero() {
+		where = append(where, "time >= "+arg(f.From))
+	}
+	if !f.To.IsZero() {
+		where = append(where, "time < "+arg(f.To))
+	}
+	if f.Currency != "" {
+		where = append(where, "currency = "+arg(f.Currency))
+	}
+	if f.MinPrice != nil {
+		where = append(where, "price >= "+arg(*f.MinPrice))
+	}
+	if f.MaxPrice != nil {
+		where = append(where, "price <= "+arg(*f.MaxPrice))
+	}
+	if f.Status != "" {
+		where = append(where, "status = "+arg(f.Status))
+	}
+	if f.DriverID != "" {
+		where = append(where, "driver_id = "+arg(f.DriverID))
+	}
+
+	column, dir, cmp := "time", "ASC", ">"
+	if q.SortBy == SortByPrice {
+		column = "price"
+	}
+	if q.Desc {
+		dir, cmp = "DESC", "<"
+	}
+	if q.After != nil {
+		// Keyset пагинация: сравнение пары (column, id) использует индекс и не пропускает строки,
+		// добавленные между запросами страниц, в отличие от OFFSET
+		var after any = q.After.Time
+		if q.SortBy == SortByPrice {
+			after = q.After.Price
+		}
+		where = append(where, fmt.Sprintf("(%s, id) %s (%s, %s)", column, cmp, arg(after), arg(q.After.ID)))
+	}
+
+	query := `SELECT id, currency, price, original_currency, original_price, rate, time, price_estimated, status, version, driver_id, quote_id FROM bookings`
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += fmt.Sprintf(" ORDER BY %s %s, id %s LIMIT %s", column, dir, dir, arg(q.Limit))
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var bookings []Booking
+	for rows.Next() {
+		var b Booking
+		if err := rows.Scan(&b.ID, &b.Price.Currency, &b.Price, &b.OriginalPrice.Currency, &b.OriginalPrice, &b.Rate, &b.Time, &b.PriceEstimated, &b.Status, &b.Version, &b.DriverID, &b.QuoteID); err != nil {
+			return nil, err
+		}
+		bookings = append(bookings, b)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return bookings, nil
+}
@@ -0,0 +1,107 @@
+package bookingpg
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/lib/pq"
+	"time"
+)
+
+// ErrSlotConflict - водитель уже забронирован на пересекающееся время
+var ErrSlotConflict = errors.New("driver is already booked for this time")
+
+// Slot - время водителя, занятое бронированием: [Start, End)
+type Slot struct {
+	DriverID string
+	Start    time.Time
+	End      time.Time
+}
+
+// Overlaps сообщает, пересекаются ли слоты одного водителя
+func (s Slot) Overlaps(other Slot) bool {
+	return s.DriverID == other.DriverID && s.Start.Before(other.End) && other.Start.Before(s.End)
+}
+
+// FreeSlots возвращает промежутки [from, to), не занятые busy. busy должны быть отсортированы по Start
+func FreeSlots(driverId string, busy []Slot, from, to time.Time) []Slot {
+	free := []Slot{}
+	cur := from
+	for _, slot := range busy {
+		if slot.Start.After(cur) {
+			free = append(free, Slot{DriverID: driverId, Start: cur, End: minTime(slot.Start, to)})
+		}
+		if slot.End.After(cur) {
+			cur = slot.End
+		}
+		if !cur.Before(to) {
+			return free
+		}
+	}
+	if cur.Before(to) {
+		free = append(free, Slot{DriverID: driverId, Start: cur, End: to})
+	}
+	return free
+}
+
+func minTime(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
+
+// isSlotConflict сообщает, нарушено ли ограничение driver_slots_no_overlap
+func isSlotConflict(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23P01" // exclusion_violation
+}
+
+func insertSlot(ctx context.Context, tx *sql.Tx, bookingId int, slot Slot) error {
+	query := `INSERT INTO driver_slots (booking_id, driver_id, during) VALUES ($1, $2, tsrange($3, $4))`
+	_, err := tx.ExecContext(ctx, query, bookingId, slot.DriverID, slot.Start, slot.End)
+	if isSlotConflict(err) {
+		return fmt.Errorf("%w: driver %s at %s", ErrSlotConflict, slot.DriverID, slot.Start.Format(time.RFC3339))
+	}
+	return err
+}
+
+// moveSlot сдвигает слот бронирования на новое время начала, сохраняя длительность
+func moveSlot(ctx context.Context, tx *sql.Tx, bookingId int, start time.Time) error {
+	query := `UPDATE driver_slots SET during = tsrange($1, $1 + (upper(during) - lower(during))) WHERE booking_id = $2`
+	_, err := tx.ExecContext(ctx, query, start, bookingId)
+	if isSlotConflict(err) {
+		return fmt.Errorf("%w: booking %d at %s", ErrSlotConflict, bookingId, start.Format(time.RFC3339))
+	}
+	return err
+}
+
+func releaseSlot(ctx context.Context, tx *sql.Tx, bookingId int) error {
+	_, err := tx.ExecContext(ctx, `DELETE FROM driver_slots WHERE booking_id = $1`, bookingId)
+	return err
+}
+
+// DriverAvailability возвращает свободные промежутки водителя в [from, to)
+func (s *Storage) DriverAvailability(ctx context.Context, driverId string, from, to time.Time) ([]Slot, error) {
+	query := `SELECT lower(during), upper(during) FROM driver_slots
+		WHERE driver_id = $1 AND during && tsrange($2, $3) ORDER BY lower(during)`
+	rows, err := s.db.QueryContext(ctx, query, driverId, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var busy []Slot
+	for rows.Next() {
+		slot := Slot{DriverID: driverId}
+		if err := rows.Scan(&slot.Start, &slot.End); err != nil {
+			return nil, err
+		}
+		busy = append(busy, slot)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return FreeSlots(driverId, busy, from, to), nil
+}
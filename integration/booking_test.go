@@ -0,0 +1,79 @@
+package integration
+
+import (
+	"fmt"
+	"net/http"
+	"otel-jaeger-learn/pkg/tracing/tracingtest"
+	"testing"
+	"time"
+)
+
+// bookingTime - время бронирования в тестах, в пределах BookingHorizon
+var bookingTime = time.Now().Add(24 * time.Hour).UTC().Truncate(time.Second)
+
+var bookingBody = bookingJSON("1", bookingTime)
+
+func bookingJSON(id string, t time.Time) string {
+	return fmt.Sprintf(`{"id":%q, "time":%q}`, id, t.Format(time.RFC3339))
+}
+
+func TestAddBookingProducesSingleConnectedTrace(t *testing.T) {
+	h := Start(t)
+
+	if status, _ := postBookingJSON(h, bookingBody); status != http.StatusOK {
+		t.Fatalf("POST /bookings status = %d, want %d", status, http.StatusOK)
+	}
+
+	rec := h.Recorder
+	root := rec.WaitForSpan("/bookings", time.Second)
+	traceID := rec.AssertSingleTrace()
+
+	if roots := rec.Roots(); len(roots) != 1 || roots[0].ID() != root.ID() {
+		t.Fatalf("expected web-entry server span to be the only root, trace:\n%s", rec.Dump())
+	}
+
+	// Серверные span'ы всех трёх сервисов
+	servers := map[string]string{
+		"/bookings":      WebEntryService,
+		"/add-booking":   BookingService,
+		"/booking-price": PriceCalcsService,
+	}
+	for route, service := range servers {
+		span := rec.Span(route)
+		rec.AssertAttribute(span, "net.host.name", service)
+		if span.TraceID() != traceID {
+			t.Errorf("server span %q is in another trace", route)
+		}
+	}
+
+	// Каждый сервис вызывается из предыдущего
+	rec.AssertChildOf(rec.Span("HTTP POST"), findHandlerSpan(t, h, "/bookings", "Handler.AddBooking"))
+	rec.AssertChildOf(rec.Span("/add-booking"), rec.Span("HTTP POST"))
+	rec.AssertChildOf(rec.Span("/booking-price"), rec.Span("HTTP GET"))
+
+	// Span'ы обращений к базе
+	bookingHandler := findHandlerSpan(t, h, "/add-booking", "Handler.AddBooking")
+	rec.AssertChildOf(rec.Span("bookingmem.INSERT"), bookingHandler)
+
+	priceHandler := rec.Span("Booking Price Calculation")
+	rec.AssertChildOf(priceHandler, rec.Span("/booking-price"))
+	rec.AssertChildOf(rec.Span("pricesmem.GetDriverPrice"), priceHandler)
+	rec.AssertChildOf(rec.Span("pricesmem.GetDriverDiscounts"), priceHandler)
+	rec.AssertEvent(priceHandler, "Price Calculated")
+
+	if got := len(h.BookingStorage.Bookings()); got != 1 {
+		t.Errorf("stored %d bookings, want 1", got)
+	}
+}
+
+// findHandlerSpan возвращает span хендлера с именем name, созданный внутри серверного span'а route
+func findHandlerSpan(t *testing.T, h *Harness, route, name string) tracingtest.Span {
+	t.Helper()
+	for _, span := range h.Recorder.Children(h.Recorder.Span(route)) {
+		if span.Name == name {
+			return span
+		}
+	}
+	t.Fatalf("no span %q under %q, trace:\n%s", name, route, h.Recorder.Dump())
+	return tracingtest.Span{}
+}
@@ -0,0 +1,63 @@
+package integration
+
+import (
+	"net/http"
+	"otel-jaeger-learn/pkg/tracing"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestResponsesCarryTraceAndRequestID(t *testing.T) {
+	h := Start(t)
+
+	resp := h.Do(http.MethodPost, "/bookings", bookingBody, map[string]string{tracing.RequestIDHeader: "support-42"}, nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("POST /bookings status = %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+
+	rec := h.Recorder
+	rec.WaitForSpan("/bookings", time.Second)
+	traceID := rec.AssertSingleTrace()
+
+	if got := resp.Header.Get(tracing.RequestIDHeader); got != "support-42" {
+		t.Errorf("%s = %q, want %q", tracing.RequestIDHeader, got, "support-42")
+	}
+	if got := resp.Header.Get(tracing.TraceIDHeader); got != traceID.String() {
+		t.Errorf("%s = %q, want %q", tracing.TraceIDHeader, got, traceID)
+	}
+	if got := resp.Header.Get("traceparent"); !strings.Contains(got, traceID.String()) {
+		t.Errorf("traceparent = %q, want trace %s", got, traceID)
+	}
+
+	// ID запроса передаётся дальше по цепочке сервисов
+	for _, route := range []string{"/bookings", "/add-booking", "/booking-price"} {
+		rec.AssertAttribute(rec.Span(route), "http.request_id", "support-42")
+	}
+}
+
+func TestErrorBodyContainsTraceID(t *testing.T) {
+	h := Start(t)
+
+	var body struct {
+		Error     string `json:"error"`
+		TraceID   string `json:"trace_id"`
+		RequestID string `json:"request_id"`
+	}
+	resp := h.Do(http.MethodPost, "/bookings", `{`, nil, &body)
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("POST /bookings status = %d, want %d", resp.StatusCode, http.StatusBadRequest)
+	}
+
+	h.Recorder.WaitForSpan("/bookings", time.Second)
+	traceID := h.Recorder.AssertSingleTrace()
+	if body.Error == "" {
+		t.Error("error body has no error message")
+	}
+	if body.TraceID != traceID.String() || body.TraceID != resp.Header.Get(tracing.TraceIDHeader) {
+		t.Errorf("trace_id = %q, want %q", body.TraceID, traceID)
+	}
+	if body.RequestID == "" || body.RequestID != resp.Header.Get(tracing.RequestIDHeader) {
+		t.Errorf("request_id = %q, want generated ID from %s header", body.RequestID, tracing.RequestIDHeader)
+	}
+}
@@ -0,0 +1,189 @@
+package integration
+
+import (
+	bookingconfig "booking/config"
+	"fmt"
+	"net/http"
+	"net/url"
+	"otel-jaeger-learn/pkg/money"
+	"price-calcs/rates"
+	"testing"
+	"time"
+)
+
+// requestQuote запрашивает предложение цены через web-entry с параметрами query, время бронирования
+// по умолчанию - bookingTime
+func requestQuote(t *testing.T, h *Harness, query string) (int, quoteResponse) {
+	t.Helper()
+	values, err := url.ParseQuery(query)
+	if err != nil {
+		t.Fatalf("parse query %q: %v", query, err)
+	}
+	if !values.Has("time") {
+		values.Set("time", bookingTime.Format(time.RFC3339))
+	}
+	var q quoteResponse
+	resp := h.Do(http.MethodGet, "/quotes?"+values.Encode(), "", nil, &q)
+	return resp.StatusCode, q
+}
+
+func TestQuoteInRequestedCurrencyIsBooked(t *testing.T) {
+	h := Start(t)
+	h.PricesStorage.SetDriver("5", 1200)
+
+	status, q := requestQuote(t, h, "driver_id=5&currency=USD")
+	if status != http.StatusOK {
+		t.Fatalf("GET /quotes status = %d, want 200", status)
+	}
+	original := money.FromMajor(1200, Currency)
+	if q.Price != money.New(1260, "USD") || q.OriginalPrice != original || q.Rate != 0.0105 {
+		t.Fatalf("quote = %+v, want 12.60 USD converted from %s at 0.0105", q.Quote, original)
+	}
+	if q.Breakdown.Total != original {
+		t.Errorf("breakdown total = %s, want price in driver currency %s", q.Breakdown.Total, original)
+	}
+	quoteSpan := h.Recorder.WaitForSpan("Booking Quote", time.Second)
+	h.Recorder.AssertAttribute(quoteSpan, "currency.rate", 0.0105)
+	h.Recorder.AssertAttribute(quoteSpan, "currency.to", "USD")
+	h.Recorder.AssertEvent(quoteSpan, "price converted")
+
+	h.Recorder.Reset()
+	if status, _ := postBookingJSON(h, quotedBookingJSON("", q.Token)); status != http.StatusOK {
+		t.Fatalf("POST /bookings status = %d, want 200", status)
+	}
+	h.Recorder.WaitForSpan("/bookings", time.Second)
+	h.Recorder.AssertAttribute(findHandlerSpan(t, h, "/add-booking", "Handler.AddBooking"), "currency.rate", 0.0105)
+
+	stored := h.BookingStorage.Bookings()[0]
+	if stored.Price != q.Price || stored.OriginalPrice != original || stored.Rate != 0.0105 {
+		t.Errorf("stored booking = %+v, want %s converted from %s at 0.0105", stored, q.Price, original)
+	}
+}
+
+func TestQuoteWithoutConversion(t *testing.T) {
+	h := Start(t)
+	h.PricesStorage.SetDriver("5", 1200)
+
+	for _, query := range []string{"driver_id=5", "driver_id=5&currency=" + Currency} {
+		status, q := requestQuote(t, h, query)
+		if status != http.StatusOK {
+			t.Fatalf("GET /quotes?%s status = %d, want 200", query, status)
+		}
+		if q.Price != money.FromMajor(1200, Currency) || q.OriginalPrice != q.Price || q.Rate != 1 {
+			t.Errorf("GET /quotes?%s = %+v, want unconverted price with rate 1", query, q.Quote)
+		}
+	}
+}
+
+func TestRateIsChosenByEffectiveDate(t *testing.T) {
+	now := time.Now().UTC()
+	h := Start(t, WithCurrencyRates(
+		rates.Rate{From: Currency, To: "USD", Value: 0.01, EffectiveFrom: now.Add(-48 * time.Hour)},
+		rates.Rate{From: Currency, To: "USD", Value: 0.011, EffectiveFrom: now.Add(-time.Hour)},
+		// Ещё не действует
+		rates.Rate{From: Currency, To: "USD", Value: 0.02, EffectiveFrom: now.Add(time.Hour)},
+	))
+
+	status, q := requestQuote(t, h, "driver_id=5&currency=USD")
+	if status != http.StatusOK {
+		t.Fatalf("GET /quotes status = %d, want 200", status)
+	}
+	if q.Rate != 0.011 || q.Price != money.New(1100, "USD") {
+		t.Errorf("quote = %+v, want 11.00 USD at the latest effective rate 0.011", q.Quote)
+	}
+}
+
+func TestQuoteCurrencyErrors(t *testing.T) {
+	h := Start(t)
+	cases := []struct {
+		name, currency string
+		want           int
+	}{
+		{"no rate", "EUR", http.StatusUnprocessableEntity},
+		{"not ISO 4217", "usd", http.StatusBadRequest},
+	}
+	for _, tc := range cases {
+		if status, _ := requestQuote(t, h, "driver_id=5&currency="+tc.currency); status != tc.want {
+			t.Errorf("%s: GET /quotes status = %d, want %d", tc.name, status, tc.want)
+		}
+	}
+}
+
+// bookingJSONInCurrency - тело бронирования водителя driverId на bookingTime с ценой в валюте currency
+func bookingJSONInCurrency(driverId, currency string) string {
+	return fmt.Sprintf(`{"id":"1", "time":%q, "driver_id":%q, "currency":%q}`, bookingTime.Format(time.RFC3339), driverId, currency)
+}
+
+func TestBookingInRequestedCurrency(t *testing.T) {
+	h := Start(t)
+	h.PricesStorage.SetDriver("5", 1200)
+
+	if status, _ := postBookingJSON(h, bookingJSONInCurrency("5", "USD")); status != http.StatusOK {
+		t.Fatalf("POST /bookings status = %d, want 200", status)
+	}
+	h.Recorder.WaitForSpan("/bookings", time.Second)
+	handler := findHandlerSpan(t, h, "/add-booking", "Handler.AddBooking")
+	h.Recorder.AssertAttribute(handler, "booking.price_source", "price-calcs")
+	h.Recorder.AssertAttribute(handler, "currency.rate", 0.0105)
+
+	original := money.FromMajor(1200, Currency)
+	stored := h.BookingStorage.Bookings()[0]
+	if stored.Price != money.New(1260, "USD") || stored.OriginalPrice != original || stored.Rate != 0.0105 {
+		t.Errorf("stored booking = %+v, want 12.60 USD converted from %s at 0.0105", stored, original)
+	}
+}
+
+func TestBookingCurrencyErrors(t *testing.T) {
+	h := Start(t)
+	h.PricesStorage.SetDriver("5", 1200)
+	status, usdQuote := requestQuote(t, h, "driver_id=5&currency=USD")
+	if status != http.StatusOK {
+		t.Fatalf("GET /quotes status = %d, want 200", status)
+	}
+
+	cases := []struct {
+		name, body string
+		want       int
+	}{
+		{"no rate", bookingJSONInCurrency("5", "EUR"), http.StatusUnprocessableEntity},
+		{"not ISO 4217", bookingJSONInCurrency("5", "usd"), http.StatusUnprocessableEntity},
+		{"quote in another currency", fmt.Sprintf(`{"id":"1", "time":%q, "driver_id":"5", "currency":"EUR", "quote_token":%q}`,
+			bookingTime.Format(time.RFC3339), usdQuote.Token), http.StatusUnprocessableEntity},
+	}
+	for _, tc := range cases {
+		if status, _ := postBookingJSON(h, tc.body); status != tc.want {
+			t.Errorf("%s: POST /bookings status = %d, want %d", tc.name, status, tc.want)
+		}
+	}
+	if got := len(h.BookingStorage.Bookings()); got != 0 {
+		t.Errorf("stored %d bookings, want 0", got)
+	}
+}
+
+// Без price-calcs курса нет: запасная цена в валюте водителя не подставляется вместо цены в другой валюте
+func TestFallbackPriceIsNotConverted(t *testing.T) {
+	h := Start(t, WithPriceFallback(bookingconfig.PriceFallbackDefault))
+	h.PriceCalcs.Close()
+
+	if status, _ := postBookingJSON(h, bookingJSONInCurrency("5", "USD")); status == http.StatusOK {
+		t.Fatal("booking in USD was accepted with the default price in " + Currency)
+	}
+	if status, added := postBookingJSON(h, bookingJSONInCurrency("5", Currency)); status != http.StatusOK || !added.PriceEstimated {
+		t.Fatalf("booking in driver currency = %d %+v, want 200 with estimated price", status, added)
+	}
+	if stored := h.BookingStorage.Bookings(); len(stored) != 1 || stored[0].Rate != 1 {
+		t.Errorf("stored bookings = %+v, want one with rate 1", stored)
+	}
+}
+
+func TestRateLongerThanStoredIsRejected(t *testing.T) {
+	// Курс сохраняется в бронировании в NUMERIC(20, 10), более длинный округлился бы
+	long := rates.Rate{From: Currency, To: "USD", Value: 0.01234567891, EffectiveFrom: time.Now()}
+	if _, err := rates.NewStatic([]rates.Rate{long}); err == nil {
+		t.Errorf("NewStatic with rate %v succeeded, want error", long.Value)
+	}
+	long.Value = 0.0123456789
+	if _, err := rates.NewStatic([]rates.Rate{long}); err != nil {
+		t.Errorf("NewStatic with rate %v: %v", long.Value, err)
+	}
+}
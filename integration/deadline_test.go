@@ -0,0 +1,61 @@
+package integration
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestBudgetIsPropagatedToEveryHop(t *testing.T) {
+	h := Start(t)
+
+	if status, _ := postBookingJSON(h, bookingBody); status != http.StatusOK {
+		t.Fatalf("POST /bookings status = %d, want %d", status, http.StatusOK)
+	}
+
+	rec := h.Recorder
+	rec.WaitForSpan("/bookings", time.Second)
+
+	var prevBudget int64
+	for _, route := range []string{"/bookings", "/add-booking", "/booking-price"} {
+		span := rec.Span(route)
+		budget, ok := span.Attr("request.budget_ms")
+		if !ok {
+			t.Fatalf("server span %q has no request.budget_ms", route)
+		}
+		if _, ok := span.Attr("request.budget_consumed_ms"); !ok {
+			t.Errorf("server span %q has no request.budget_consumed_ms", route)
+		}
+		// Каждый следующий сервис получает не больше, чем осталось у предыдущего
+		if prevBudget != 0 && budget.AsInt64() > prevBudget {
+			t.Errorf("%q budget %dms is greater than previous hop budget %dms", route, budget.AsInt64(), prevBudget)
+		}
+		prevBudget = budget.AsInt64()
+	}
+	rec.AssertAttribute(rec.Span("/bookings"), "request.budget_ms", DefaultRequestBudget.Milliseconds())
+}
+
+func TestSlowPriceCalcsIsCutByDeadline(t *testing.T) {
+	budget := 300 * time.Millisecond
+	h := Start(t, WithRequestBudget(budget))
+	h.PricesStorage.SetLatency(time.Minute)
+
+	start := time.Now()
+	status, _ := postBookingJSON(h, bookingBody)
+	elapsed := time.Since(start)
+
+	if status != http.StatusGatewayTimeout {
+		t.Errorf("POST /bookings status = %d, want %d", status, http.StatusGatewayTimeout)
+	}
+	if elapsed > budget+time.Second {
+		t.Errorf("request took %v with budget %v", elapsed, budget)
+	}
+
+	rec := h.Recorder
+	rec.WaitForSpan("/bookings", time.Second)
+	rec.WaitForSpan("/booking-price", time.Second)
+	if got := len(h.BookingStorage.Bookings()); got != 0 {
+		t.Errorf("stored %d bookings, want 0", got)
+	}
+	rec.AssertStatus(rec.Span("pricesmem.GetDriverPrice"), 1) // codes.Error
+}
@@ -0,0 +1,138 @@
+package integration
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"otel-jaeger-learn/pkg/money"
+	"price-calcs/storage/pricespg"
+	"testing"
+	"time"
+)
+
+// addedBooking - ответ web-entry на POST /bookings
+type addedBooking struct {
+	ID             int    `json:"id"`
+	DriverID       string `json:"driver_id"`
+	PriceEstimated bool   `json:"price_estimated"`
+}
+
+// postBookingJSON отправляет body на POST /bookings и возвращает статус и ответ
+func postBookingJSON(h *Harness, body string) (int, addedBooking) {
+	var added addedBooking
+	resp := h.Do(http.MethodPost, "/bookings", body, nil, &added)
+	return resp.StatusCode, added
+}
+
+// driverBookingJSON - тело бронирования водителя driverId на время at
+func driverBookingJSON(driverId string, at time.Time) string {
+	return fmt.Sprintf(`{"id":"1", "time":%q, "driver_id":%q}`, at.Format(time.RFC3339), driverId)
+}
+
+func TestPriceCalcsPicksDriverWhenNotGiven(t *testing.T) {
+	h := Start(t)
+
+	// Водители выбираются по кругу, поэтому два бронирования на одно время не конфликтуют
+	var drivers []string
+	for i := 0; i < 2; i++ {
+		h.Recorder.Reset()
+		status, added := postBookingJSON(h, bookingBody)
+		if status != http.StatusOK {
+			t.Fatalf("POST /bookings status = %d, want 200", status)
+		}
+		h.Recorder.WaitForSpan("/bookings", time.Second)
+		h.Recorder.AssertEvent(h.Recorder.Span("Booking Price Calculation"), "driver picked")
+		h.Recorder.AssertAttribute(findHandlerSpan(t, h, "/add-booking", "Handler.AddBooking"), "driver.id", added.DriverID)
+		drivers = append(drivers, added.DriverID)
+	}
+	if drivers[0] == "" || drivers[0] == drivers[1] {
+		t.Fatalf("picked drivers = %q, want two different drivers", drivers)
+	}
+
+	for i, stored := range h.BookingStorage.Bookings() {
+		if stored.DriverID != drivers[i] {
+			t.Errorf("booking %d driver = %q, want %q", stored.ID, stored.DriverID, drivers[i])
+		}
+		if stored.Slot == nil || stored.Slot.DriverID != drivers[i] {
+			t.Errorf("booking %d slot = %+v, want slot of driver %q", stored.ID, stored.Slot, drivers[i])
+		}
+	}
+}
+
+func TestRequestedDriverIsPricedAndStored(t *testing.T) {
+	h := Start(t)
+	h.PricesStorage.SetDriver("42", 2000)
+
+	h.Recorder.Reset()
+	status, added := postBookingJSON(h, driverBookingJSON("42", bookingTime))
+	if status != http.StatusOK {
+		t.Fatalf("POST /bookings status = %d, want 200", status)
+	}
+	if added.DriverID != "42" {
+		t.Errorf("driver_id = %q, want 42", added.DriverID)
+	}
+
+	h.Recorder.WaitForSpan("/bookings", time.Second)
+	priceHandler := h.Recorder.Span("Booking Price Calculation")
+	h.Recorder.AssertAttribute(priceHandler, "driver.id", "42")
+	h.Recorder.AssertNoEvent(priceHandler, "driver picked")
+
+	var got struct {
+		Price    money.Money `json:"price"`
+		DriverID string      `json:"driver_id"`
+	}
+	if resp := h.Do(http.MethodGet, fmt.Sprintf("/bookings/%d", added.ID), "", nil, &got); resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET /bookings/%d status = %d, want 200", added.ID, resp.StatusCode)
+	}
+	if got.DriverID != "42" || got.Price != money.FromMajor(2000, Currency) {
+		t.Errorf("stored booking = %+v, want driver 42 with price 2000", got)
+	}
+
+	// Бронирования водителя можно выбрать фильтром списка
+	status, list := listBookings(h, url.Values{"driver_id": {"42"}})
+	if status != http.StatusOK || len(list.Bookings) != 1 {
+		t.Errorf("list by driver: status %d, %d bookings, want 1", status, len(list.Bookings))
+	}
+}
+
+func TestUnknownDriverIsRejected(t *testing.T) {
+	h := Start(t)
+
+	// Несуществующий водитель (404 от price-calcs) и неверный id (400) - разные ошибки
+	for driverId, want := range map[string]string{
+		"1000":   `unknown driver "1000"`,
+		"driver": "invalid price request: invalid driver id",
+	} {
+		var errBody struct {
+			Error string `json:"error"`
+		}
+		resp := h.Do(http.MethodPost, "/bookings", driverBookingJSON(driverId, bookingTime), nil, &errBody)
+		if resp.StatusCode != http.StatusUnprocessableEntity || errBody.Error != want {
+			t.Errorf("driver %q: POST /bookings = %d %q, want 422 %q", driverId, resp.StatusCode, errBody.Error, want)
+		}
+	}
+	if got := len(h.BookingStorage.Bookings()); got != 0 {
+		t.Errorf("stored %d bookings, want 0", got)
+	}
+}
+
+func TestPickedDriversExistInStorage(t *testing.T) {
+	h := Start(t)
+
+	// Полный круг выбора водителей и ещё один: каждый выбранный водитель есть в хранилище, а круг замыкается
+	var first string
+	for i := 0; i <= pricespg.DRIVERS_COUNT; i++ {
+		status, q := requestQuote(t, h, "")
+		if status != http.StatusOK {
+			t.Fatalf("quote #%d status = %d, want 200 for a picked driver", i+1, status)
+		}
+		switch i {
+		case 0:
+			first = q.DriverID
+		case pricespg.DRIVERS_COUNT:
+			if q.DriverID != first {
+				t.Errorf("driver after a full round = %q, want %q", q.DriverID, first)
+			}
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package integration
+
+import (
+	bookingconfig "booking/config"
+	"net/http"
+	"otel-jaeger-learn/pkg/money"
+	"testing"
+	"time"
+)
+
+func TestFallbackToCachedPrice(t *testing.T) {
+	h := Start(t, WithPriceFallback(bookingconfig.PriceFallbackCache, bookingconfig.PriceFallbackReject))
+	if status, _ := postBookingJSON(h, bookingBody); status != http.StatusOK {
+		t.Fatalf("first booking status = %d, want 200", status)
+	}
+
+	h.PriceCalcs.Close()
+	h.Recorder.Reset()
+	// Клиент узнаёт из ответа, что цена оценочная
+	if status, added := postBookingJSON(h, bookingBody); status != http.StatusOK || !added.PriceEstimated {
+		t.Fatalf("booking with price-calcs down = %d %+v, want 200 with estimated price", status, added)
+	}
+
+	bookings := h.BookingStorage.Bookings()
+	if len(bookings) != 2 {
+		t.Fatalf("stored %d bookings, want 2", len(bookings))
+	}
+	if bookings[0].PriceEstimated || !bookings[1].PriceEstimated {
+		t.Errorf("price_estimated flags = %v, %v; want false, true", bookings[0].PriceEstimated, bookings[1].PriceEstimated)
+	}
+	if bookings[1].Price != bookings[0].Price {
+		t.Errorf("fallback price = %v, want cached %v", bookings[1].Price, bookings[0].Price)
+	}
+
+	h.Recorder.WaitForSpan("/bookings", time.Second)
+	handler := findHandlerSpan(t, h, "/add-booking", "Handler.AddBooking")
+	h.Recorder.AssertAttribute(handler, "booking.price_source", "cache")
+	h.Recorder.AssertEvent(handler, "price calc service is unavailable")
+}
+
+func TestFallbackToDefaultPrice(t *testing.T) {
+	h := Start(t, WithPriceFallback(bookingconfig.PriceFallbackCache, bookingconfig.PriceFallbackDefault))
+	h.PriceCalcs.Close()
+
+	if status, _ := postBookingJSON(h, bookingBody); status != http.StatusOK {
+		t.Fatalf("booking status = %d, want 200", status)
+	}
+	bookings := h.BookingStorage.Bookings()
+	if len(bookings) != 1 || bookings[0].Price != money.FromMajor(DefaultFallbackPrice, Currency) || !bookings[0].PriceEstimated {
+		t.Fatalf("stored bookings = %+v, want one estimated with default price", bookings)
+	}
+
+	h.Recorder.WaitForSpan("/bookings", time.Second)
+	h.Recorder.AssertAttribute(findHandlerSpan(t, h, "/add-booking", "Handler.AddBooking"), "booking.price_source", "default")
+}
+
+func TestFallbackReject(t *testing.T) {
+	h := Start(t, WithPriceFallback(bookingconfig.PriceFallbackReject))
+	h.PriceCalcs.Close()
+
+	if status, _ := postBookingJSON(h, bookingBody); status == http.StatusOK {
+		t.Fatal("booking without price was accepted")
+	}
+	if got := len(h.BookingStorage.Bookings()); got != 0 {
+		t.Errorf("stored %d bookings, want 0", got)
+	}
+
+	h.Recorder.WaitForSpan("/bookings", time.Second)
+	h.Recorder.AssertStatus(findHandlerSpan(t, h, "/add-booking", "Handler.AddBooking"), 1) // codes.Error
+}
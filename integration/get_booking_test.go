@@ -0,0 +1,62 @@
+package integration
+
+import (
+	"net/http"
+	"otel-jaeger-learn/pkg/money"
+	"testing"
+	"time"
+)
+
+func TestGetBookingReadsStorageThroughBothServices(t *testing.T) {
+	h := Start(t)
+	if status, _ := postBookingJSON(h, bookingBody); status != http.StatusOK {
+		t.Fatalf("POST /bookings status = %d, want 200", status)
+	}
+	stored := h.BookingStorage.Bookings()[0]
+	h.Recorder.Reset()
+
+	var body struct {
+		ID    int         `json:"id"`
+		Time  time.Time   `json:"time"`
+		Price money.Money `json:"price"`
+	}
+	if resp := h.Do(http.MethodGet, "/bookings/1", "", nil, &body); resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET /bookings/1 status = %d, want 200", resp.StatusCode)
+	}
+	if body.ID != 1 || body.Price != stored.Price || !body.Time.Equal(stored.Time) {
+		t.Errorf("booking = %+v, want stored %+v", body, stored)
+	}
+
+	rec := h.Recorder
+	rec.WaitForSpan("/bookings/:id", time.Second)
+	rec.AssertSingleTrace()
+
+	rec.AssertChildOf(rec.Span("HTTP GET"), findHandlerSpan(t, h, "/bookings/:id", "Handler.GetBookingByID"))
+	rec.AssertChildOf(rec.Span("/get-booking/:id"), rec.Span("HTTP GET"))
+	bookingHandler := findHandlerSpan(t, h, "/get-booking/:id", "Handler.GetBooking")
+	rec.AssertChildOf(rec.Span("bookingmem.SELECT"), bookingHandler)
+	rec.AssertAttribute(bookingHandler, "booking.id", 1)
+}
+
+func TestGetBookingNotFound(t *testing.T) {
+	h := Start(t)
+
+	if resp := h.Do(http.MethodGet, "/bookings/42", "", nil, nil); resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("GET /bookings/42 status = %d, want 404", resp.StatusCode)
+	}
+
+	rec := h.Recorder
+	rec.WaitForSpan("/bookings/:id", time.Second)
+	rec.AssertAttribute(rec.Span("/get-booking/:id"), "http.status_code", http.StatusNotFound)
+	rec.AssertAttribute(rec.Span("/bookings/:id"), "http.status_code", http.StatusNotFound)
+	rec.AssertEvent(findHandlerSpan(t, h, "/get-booking/:id", "Handler.GetBooking"), "booking not found")
+	rec.AssertEvent(findHandlerSpan(t, h, "/bookings/:id", "Handler.GetBookingByID"), "booking not found")
+}
+
+func TestGetBookingInvalidID(t *testing.T) {
+	h := Start(t)
+
+	if resp := h.Do(http.MethodGet, "/bookings/abc", "", nil, nil); resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("GET /bookings/abc status = %d, want 400", resp.StatusCode)
+	}
+}
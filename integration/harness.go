@@ -0,0 +1,249 @@
+// Package integration поднимает web-entry, booking и price-calcs в одном процессе
+// на httptest серверах, с хранилищами в памяти и записью span'ов через tracingtest.
+package integration
+
+import (
+	bookingconfig "booking/config"
+	bookinghandler "booking/handler"
+	"booking/storage/bookingmem"
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"otel-jaeger-learn/pkg/money"
+	"otel-jaeger-learn/pkg/quote"
+	"otel-jaeger-learn/pkg/tracing"
+	"otel-jaeger-learn/pkg/tracing/httpclient"
+	"otel-jaeger-learn/pkg/tracing/tracingtest"
+	pricesconfig "price-calcs/config"
+	priceshandler "price-calcs/handler"
+	"price-calcs/pricing"
+	"price-calcs/rates"
+	"price-calcs/storage/pricesmem"
+	"strings"
+	"testing"
+	"time"
+	webconfig "web-entry/config"
+	webhandler "web-entry/handler"
+)
+
+// Имена сервисов, с которыми их регистрируют cmd/start
+const (
+	WebEntryService   = "web-entry"
+	BookingService    = "bookings"
+	PriceCalcsService = "price-calcs"
+)
+
+// DefaultDriverPrice - цена любого водителя в хранилище по умолчанию, в валюте Currency
+const DefaultDriverPrice = 1000
+
+// Настройки сервисов, с которыми их поднимает Start
+const (
+	// DefaultRequestBudget - бюджет запроса web-entry, как REQUEST_BUDGET по умолчанию
+	DefaultRequestBudget = 10 * time.Second
+	// BookingHorizon - насколько вперёд web-entry разрешает бронировать
+	BookingHorizon = 90 * 24 * time.Hour
+	// IdempotencyLease - сколько ключ идемпотентности занят выполняющимся запросом
+	IdempotencyLease = 10 * time.Second
+	// DefaultFallbackPrice - цена, которую booking берёт при стратегии PRICE_FALLBACK=default
+	DefaultFallbackPrice = 500
+)
+
+// Currency - валюта цен водителей и цены по умолчанию
+const Currency = pricesmem.Currency
+
+// Подпись предложений цены: ключ общий у price-calcs и booking
+const (
+	QuoteKey = "integration-quote-key"
+	QuoteTTL = 15 * time.Minute
+)
+
+// Harness - три сервиса, связанные через настоящие otel http клиенты
+type Harness struct {
+	t testing.TB
+
+	Recorder *tracingtest.Recorder
+
+	BookingStorage *bookingmem.Storage
+	PricesStorage  *pricesmem.Storage
+
+	WebEntry   *httptest.Server
+	Booking    *httptest.Server
+	PriceCalcs *httptest.Server
+}
+
+// Option меняет настройки сервисов, поднимаемых Start
+type Option func(*options)
+
+type options struct {
+	requestBudget time.Duration
+	priceFallback []string
+	pricingRules  []pricing.RuleConfig
+	currencyRates []rates.Rate
+}
+
+// WithRequestBudget задаёт бюджет времени запроса к web-entry
+func WithRequestBudget(budget time.Duration) Option {
+	return func(o *options) { o.requestBudget = budget }
+}
+
+// WithPriceFallback задаёт стратегии booking на случай недоступности price-calcs (по умолчанию cache)
+func WithPriceFallback(strategies ...string) Option {
+	return func(o *options) { o.priceFallback = strategies }
+}
+
+// WithPricingRules задаёт правила расчёта цены price-calcs (по умолчанию pricing.DefaultRules), время - в UTC
+func WithPricingRules(rules ...pricing.RuleConfig) Option {
+	return func(o *options) { o.pricingRules = rules }
+}
+
+// WithCurrencyRates задаёт курсы валют price-calcs (по умолчанию DefaultRates)
+func WithCurrencyRates(currencyRates ...rates.Rate) Option {
+	return func(o *options) { o.currencyRates = currencyRates }
+}
+
+// DefaultRates - курсы валют price-calcs по умолчанию: рубли в доллары, действует с 2020 года
+func DefaultRates() []rates.Rate {
+	return []rates.Rate{
+		{From: Currency, To: "USD", Value: 0.0105, EffectiveFrom: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)},
+	}
+}
+
+// Start поднимает все сервисы, они останавливаются по завершению теста
+func Start(t testing.TB, opts ...Option) *Harness {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	o := options{
+		requestBudget: DefaultRequestBudget,
+		priceFallback: []string{bookingconfig.PriceFallbackCache},
+		pricingRules:  pricing.DefaultRules(),
+		currencyRates: DefaultRates(),
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	h := &Harness{
+		t: t,
+		// Recorder нужно установить до создания роутеров, otelgin берёт глобальный провайдер при создании
+		Recorder:       tracingtest.Install(t),
+		BookingStorage: bookingmem.NewStorage(),
+		PricesStorage:  pricesmem.NewStorage(DefaultDriverPrice),
+	}
+
+	// price-calcs
+	pricesRouter := newRouter(PriceCalcsService)
+	rules, err := pricing.NewEngine(o.pricingRules, time.UTC)
+	if err != nil {
+		t.Fatalf("pricing rules: %v", err)
+	}
+	currencyRates, err := rates.NewStatic(o.currencyRates)
+	if err != nil {
+		t.Fatalf("currency rates: %v", err)
+	}
+	pricesHandler, err := priceshandler.NewPricesHnd(h.PricesStorage, rules, currencyRates, pricesconfig.Config{
+		QuoteCfg: quote.Config{Key: QuoteKey, TTL: QuoteTTL},
+	})
+	if err != nil {
+		t.Fatalf("price handler: %v", err)
+	}
+	priceshandler.RegisterRoutes(pricesRouter, pricesHandler)
+	h.PriceCalcs = startServer(t, pricesRouter)
+
+	// booking
+	bookingCfg := bookingconfig.Config{
+		CalcPricesAddr:   h.PriceCalcs.URL,
+		PriceFallback:    o.priceFallback,
+		DefaultPrice:     money.FromMajor(DefaultFallbackPrice, Currency),
+		PriceCacheTTL:    time.Hour,
+		IdempotencyTTL:   time.Hour,
+		IdempotencyLease: IdempotencyLease,
+		SlotDuration:     time.Hour,
+		QuoteCfg:         quote.Config{Key: QuoteKey},
+	}
+	bookingHandler, err := bookinghandler.NewBookingHnd(newClient(t), h.BookingStorage, bookingCfg)
+	if err != nil {
+		t.Fatalf("booking handler: %v", err)
+	}
+	bookingRouter := newRouter(BookingService)
+	bookinghandler.RegisterRoutes(bookingRouter, bookingHandler)
+	h.Booking = startServer(t, bookingRouter)
+
+	// web-entry
+	webCfg := webconfig.Config{BookingAddr: h.Booking.URL, CalcPricesAddr: h.PriceCalcs.URL, BookingHorizon: BookingHorizon}
+	webRouter := gin.New()
+	tracing.AddDebugHeaderMiddleware(webRouter)
+	tracing.AddOtelMiddleware(webRouter, WebEntryService, tracing.WithRequestBudget(o.requestBudget))
+	webhandler.RegisterRoutes(webRouter, webhandler.NewBookingHnd(newClient(t), webCfg))
+	h.WebEntry = startServer(t, webRouter)
+
+	return h
+}
+
+// Do отправляет запрос method на path web-entry (или на полный URL другого сервиса) с JSON телом body
+// (пустое - без тела) и заголовками headers и возвращает ответ с уже прочитанным телом.
+// Если out не nil, в него декодируется тело ответа с любым статусом, у ошибок это {"error", "trace_id", ...}.
+// Ошибки запроса и декодирования отмечаются в тесте через Errorf, поэтому Do можно вызывать из горутин;
+// если запрос не удался, статус ответа 0
+func (h *Harness) Do(method, path, body string, headers map[string]string, out any) *http.Response {
+	h.t.Helper()
+	target := path
+	if !strings.HasPrefix(path, "http://") {
+		target = h.WebEntry.URL + path
+	}
+	var reqBody io.Reader
+	if body != "" {
+		reqBody = strings.NewReader(body)
+	}
+	failed := &http.Response{Header: http.Header{}}
+	req, err := http.NewRequest(method, target, reqBody)
+	if err != nil {
+		h.t.Errorf("%s %s: %v", method, path, err)
+		return failed
+	}
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		h.t.Errorf("%s %s: %v", method, path, err)
+		return failed
+	}
+	defer resp.Body.Close()
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		h.t.Errorf("%s %s: read response: %v", method, path, err)
+		return resp
+	}
+	if out != nil && len(raw) > 0 {
+		if err := json.Unmarshal(raw, out); err != nil {
+			h.t.Errorf("%s %s: decode %d response %s: %v", method, path, resp.StatusCode, raw, err)
+		}
+	}
+	return resp
+}
+
+func newRouter(serviceName string) *gin.Engine {
+	router := gin.New()
+	tracing.AddOtelMiddleware(router, serviceName)
+	return router
+}
+
+func newClient(t testing.TB) *httpclient.Client {
+	client, err := httpclient.New(httpclient.DefaultConfig())
+	if err != nil {
+		t.Fatalf("create http client: %v", err)
+	}
+	return client
+}
+
+func startServer(t testing.TB, router *gin.Engine) *httptest.Server {
+	srv := httptest.NewServer(router)
+	t.Cleanup(srv.Close)
+	return srv
+}
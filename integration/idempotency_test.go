@@ -0,0 +1,110 @@
+package integration
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+// postBookingWithKey отправляет POST /bookings с заголовком Idempotency-Key и возвращает статус и ID бронирования
+func postBookingWithKey(h *Harness, key, body string) (int, int) {
+	var added addedBooking
+	resp := h.Do(http.MethodPost, "/bookings", body, map[string]string{"Idempotency-Key": key}, &added)
+	return resp.StatusCode, added.ID
+}
+
+func TestIdempotentBookingIsCreatedOnce(t *testing.T) {
+	h := Start(t)
+
+	status, first := postBookingWithKey(h, "key-1", bookingBody)
+	if status != http.StatusOK {
+		t.Fatalf("first POST status = %d, want 200", status)
+	}
+	h.Recorder.Reset()
+	status, second := postBookingWithKey(h, "key-1", bookingBody)
+	if status != http.StatusOK || second != first {
+		t.Fatalf("repeated POST = %d id %d, want 200 id %d", status, second, first)
+	}
+	if got := len(h.BookingStorage.Bookings()); got != 1 {
+		t.Errorf("stored %d bookings, want 1", got)
+	}
+
+	h.Recorder.WaitForSpan("/bookings", time.Second)
+	handler := findHandlerSpan(t, h, "/add-booking", "Handler.AddBooking")
+	h.Recorder.AssertEvent(handler, "idempotent request replayed")
+	h.Recorder.AssertAttribute(handler, "booking.idempotency_key", "key-1")
+
+	// То же время с другим смещением - тот же запрос
+	msk := time.FixedZone("MSK", 3*60*60)
+	if status, id := postBookingWithKey(h, "key-1", bookingJSON("1", bookingTime.In(msk))); status != http.StatusOK || id != first {
+		t.Errorf("POST with the same time in another zone = %d id %d, want 200 id %d", status, id, first)
+	}
+	// Тот же ключ с другим временем
+	if status, _ := postBookingWithKey(h, "key-1", bookingJSON("1", bookingTime.Add(time.Hour))); status != http.StatusConflict {
+		t.Errorf("POST with reused key and another body status = %d, want 409", status)
+	}
+	// Другой ключ - новое бронирование
+	if status, id := postBookingWithKey(h, "key-2", bookingBody); status != http.StatusOK || id == first {
+		t.Errorf("POST with new key = %d id %d, want 200 and new id", status, id)
+	}
+}
+
+func TestConcurrentDuplicatesCreateOneBooking(t *testing.T) {
+	h := Start(t)
+	h.PricesStorage.SetLatency(50 * time.Millisecond)
+
+	const requests = 5
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	ids := map[int]bool{}
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			status, id := postBookingWithKey(h, "key-1", bookingBody)
+			switch status {
+			case http.StatusOK:
+				mu.Lock()
+				ids[id] = true
+				mu.Unlock()
+			case http.StatusConflict:
+				// Первый запрос ещё выполняется
+			default:
+				t.Errorf("duplicate POST status = %d", status)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := len(h.BookingStorage.Bookings()); got != 1 {
+		t.Errorf("stored %d bookings, want 1", got)
+	}
+	if len(ids) != 1 {
+		t.Errorf("successful responses have ids %v, want one id", ids)
+	}
+}
+
+func TestAbandonedIdempotencyKeyIsTakenOverAfterLease(t *testing.T) {
+	h := Start(t)
+	// Запросы, которые заняли ключ и не сохранили ответ, например из-за падения booking
+	ctx := context.Background()
+	if _, err := h.BookingStorage.ClaimIdempotencyKey(ctx, "abandoned", "hash", time.Hour, time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.BookingStorage.ClaimIdempotencyKey(ctx, "in-progress", "hash", time.Hour, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(10 * time.Millisecond)
+
+	if status, _ := postBookingWithKey(h, "abandoned", bookingBody); status != http.StatusOK {
+		t.Errorf("POST with abandoned key status = %d, want 200", status)
+	}
+	if status, _ := postBookingWithKey(h, "in-progress", bookingBody); status != http.StatusConflict {
+		t.Errorf("POST with key of running request status = %d, want 409", status)
+	}
+	if got := len(h.BookingStorage.Bookings()); got != 1 {
+		t.Errorf("stored %d bookings, want 1", got)
+	}
+}
@@ -0,0 +1,178 @@
+package integration
+
+import (
+	"booking/storage/bookingmem"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"otel-jaeger-learn/pkg/money"
+	"otel-jaeger-learn/pkg/tracing/tracingtest"
+	"testing"
+	"time"
+)
+
+type bookingState struct {
+	Status  string `json:"status"`
+	Version int    `json:"version"`
+}
+
+// sendBookingRequest отправляет запрос на изменение бронирования и возвращает статус и новое состояние
+func sendBookingRequest(h *Harness, method, path, body string) (int, bookingState) {
+	var state bookingState
+	resp := h.Do(method, path, body, nil, &state)
+	return resp.StatusCode, state
+}
+
+func TestBookingLifecycle(t *testing.T) {
+	h := Start(t)
+	if status, _ := postBookingJSON(h, bookingBody); status != http.StatusOK {
+		t.Fatalf("POST /bookings status = %d, want 200", status)
+	}
+	if got := h.BookingStorage.Bookings()[0].Status; got != "pending" {
+		t.Fatalf("new booking status = %q, want pending", got)
+	}
+
+	h.Recorder.Reset()
+	status, state := sendBookingRequest(h, http.MethodPatch, "/bookings/1", `{"status":"confirmed","version":1}`)
+	if status != http.StatusOK || state.Status != "confirmed" || state.Version != 2 {
+		t.Fatalf("confirm = %d %+v, want 200 confirmed v2", status, state)
+	}
+	h.Recorder.WaitForSpan("/bookings/:id", time.Second)
+	h.Recorder.AssertEvent(findHandlerSpan(t, h, "/update-booking/:id", "Handler.UpdateBooking"), "booking status changed",
+		tracingtest.EventAttr(slog.String("booking.status.from", "pending")),
+		tracingtest.EventAttr(slog.String("booking.status.to", "confirmed")),
+		tracingtest.EventAttr(slog.Int("booking.version", 2)))
+
+	// Изменение по устаревшей версии отклоняется
+	if status, _ := sendBookingRequest(h, http.MethodPatch, "/bookings/1", rescheduleJSON(bookingTime.Add(time.Hour), 1)); status != http.StatusConflict {
+		t.Errorf("update with stale version status = %d, want 409", status)
+	}
+
+	if status, state := sendBookingRequest(h, http.MethodPatch, "/bookings/1", `{"status":"completed","version":2}`); status != http.StatusOK || state.Version != 3 {
+		t.Fatalf("complete = %d %+v, want 200 v3", status, state)
+	}
+	// Завершённое бронирование нельзя отменить
+	if status, _ := sendBookingRequest(h, http.MethodDelete, "/bookings/1", ""); status != http.StatusConflict {
+		t.Errorf("cancel completed booking status = %d, want 409", status)
+	}
+
+	want := []bookingmem.AuditRecord{
+		{BookingID: 1, To: "pending", Version: 1},
+		{BookingID: 1, From: "pending", To: "confirmed", Version: 2},
+		{BookingID: 1, From: "confirmed", To: "completed", Version: 3},
+	}
+	assertAudit(t, h, want)
+}
+
+func rescheduleJSON(at time.Time, version int) string {
+	return fmt.Sprintf(`{"time":%q,"version":%d}`, at.Format(time.RFC3339), version)
+}
+
+func TestRescheduleTimeIsValidated(t *testing.T) {
+	h := Start(t)
+	if status, _ := postBookingJSON(h, bookingBody); status != http.StatusOK {
+		t.Fatalf("POST /bookings status = %d, want 200", status)
+	}
+
+	tests := []struct {
+		name, body, rule string
+	}{
+		{"not rfc3339", `{"time":"2030-01-01 10:00:00"}`, "rfc3339"},
+		{"past", rescheduleJSON(time.Now().Add(-time.Hour), 0), "future"},
+		{"beyond horizon", rescheduleJSON(time.Now().Add(BookingHorizon+24*time.Hour), 0), "horizon"},
+	}
+	for _, tt := range tests {
+		var body validationBody
+		if resp := h.Do(http.MethodPatch, "/bookings/1", tt.body, nil, &body); resp.StatusCode != http.StatusUnprocessableEntity {
+			t.Errorf("%s: status = %d, want 422 with field errors", tt.name, resp.StatusCode)
+			continue
+		}
+		if len(body.Fields) != 1 || body.Fields[0].Field != "time" || body.Fields[0].Rule != tt.rule {
+			t.Errorf("%s: fields = %+v, want time %s", tt.name, body.Fields, tt.rule)
+		}
+	}
+	if got := h.BookingStorage.Bookings()[0]; !got.Time.Equal(bookingTime) || got.Version != 1 {
+		t.Errorf("booking after rejected updates = %+v, want unchanged", got)
+	}
+
+	later := bookingTime.Add(time.Hour)
+	if status, state := sendBookingRequest(h, http.MethodPatch, "/bookings/1", rescheduleJSON(later, 1)); status != http.StatusOK || state.Version != 2 {
+		t.Fatalf("reschedule = %d %+v, want 200 v2", status, state)
+	}
+	if got := h.BookingStorage.Bookings()[0]; !got.Time.Equal(later) || got.Price != money.FromMajor(DefaultDriverPrice, Currency) {
+		t.Errorf("rescheduled booking = %+v, want time %v and the original price", got, later)
+	}
+
+	// Перенос на то же время (в другом поясе) ничего не меняет, версия клиента остаётся действительной
+	msk := time.FixedZone("MSK", 3*60*60)
+	if status, state := sendBookingRequest(h, http.MethodPatch, "/bookings/1", rescheduleJSON(later.In(msk), 2)); status != http.StatusOK || state.Version != 2 {
+		t.Errorf("reschedule to the same time = %d %+v, want 200 v2", status, state)
+	}
+	if status, state := sendBookingRequest(h, http.MethodPatch, "/bookings/1", `{"status":"confirmed","version":2}`); status != http.StatusOK || state.Version != 3 {
+		t.Errorf("confirm after no-op reschedule = %d %+v, want 200 v3", status, state)
+	}
+}
+
+func TestQuotedBookingIsNotRescheduled(t *testing.T) {
+	h := Start(t)
+	q := getQuote(t, h, "5")
+	if status, _ := postBookingJSON(h, quotedBookingJSON("5", q.Token)); status != http.StatusOK {
+		t.Fatalf("POST /bookings status = %d, want 200", status)
+	}
+
+	// На то же время - не перенос, это разрешено
+	if status, state := sendBookingRequest(h, http.MethodPatch, "/bookings/1", rescheduleJSON(bookingTime, 1)); status != http.StatusOK || state.Version != 1 {
+		t.Errorf("reschedule quoted booking to its own time = %d %+v, want 200 v1", status, state)
+	}
+	// Цена предложения действует только на его время
+	if status, _ := sendBookingRequest(h, http.MethodPatch, "/bookings/1", rescheduleJSON(bookingTime.Add(time.Hour), 1)); status != http.StatusConflict {
+		t.Errorf("reschedule quoted booking status = %d, want 409", status)
+	}
+	if status, state := sendBookingRequest(h, http.MethodPatch, "/bookings/1", `{"status":"confirmed","version":1}`); status != http.StatusOK || state.Status != "confirmed" {
+		t.Errorf("confirm quoted booking = %d %+v, want 200 confirmed", status, state)
+	}
+	if got := h.BookingStorage.Bookings()[0].Time; !got.Equal(bookingTime) {
+		t.Errorf("quoted booking time = %v, want %v", got, bookingTime)
+	}
+}
+
+func TestCancelBookingIsIdempotent(t *testing.T) {
+	h := Start(t)
+	if status, _ := postBookingJSON(h, bookingBody); status != http.StatusOK {
+		t.Fatalf("POST /bookings status = %d, want 200", status)
+	}
+
+	for i := 0; i < 2; i++ {
+		status, state := sendBookingRequest(h, http.MethodDelete, "/bookings/1?version=1", "")
+		if status != http.StatusOK || state.Status != "cancelled" || state.Version != 2 {
+			t.Fatalf("cancel #%d = %d %+v, want 200 cancelled v2", i+1, status, state)
+		}
+	}
+	assertAudit(t, h, []bookingmem.AuditRecord{
+		{BookingID: 1, To: "pending", Version: 1},
+		{BookingID: 1, From: "pending", To: "cancelled", Version: 2},
+	})
+
+	if status, _ := sendBookingRequest(h, http.MethodPatch, "/bookings/1", `{"status":"confirmed"}`); status != http.StatusConflict {
+		t.Errorf("confirm cancelled booking status = %d, want 409", status)
+	}
+	if status, _ := sendBookingRequest(h, http.MethodDelete, "/bookings/2", ""); status != http.StatusNotFound {
+		t.Errorf("cancel missing booking status = %d, want 404", status)
+	}
+	if status, _ := sendBookingRequest(h, http.MethodPatch, "/bookings/1", `{"status":"lost"}`); status != http.StatusBadRequest {
+		t.Errorf("unknown status update = %d, want 400", status)
+	}
+}
+
+func assertAudit(t *testing.T, h *Harness, want []bookingmem.AuditRecord) {
+	t.Helper()
+	got := h.BookingStorage.Audit()
+	if len(got) != len(want) {
+		t.Fatalf("audit = %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("audit[%d] = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
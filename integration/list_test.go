@@ -0,0 +1,192 @@
+package integration
+
+import (
+	"booking/storage/bookingpg"
+	"context"
+	"net/http"
+	"net/url"
+	"otel-jaeger-learn/pkg/money"
+	"testing"
+	"time"
+)
+
+type bookingList struct {
+	Bookings []struct {
+		ID    int         `json:"id"`
+		Price money.Money `json:"price"`
+	} `json:"bookings"`
+	NextCursor string `json:"next_cursor"`
+}
+
+// listBookings запрашивает страницу GET /bookings с параметрами query
+func listBookings(h *Harness, query url.Values) (int, bookingList) {
+	var list bookingList
+	resp := h.Do(http.MethodGet, "/bookings?"+query.Encode(), "", nil, &list)
+	return resp.StatusCode, list
+}
+
+// addBookings сохраняет бронирования с ценами prices, по одному в час начиная с base
+func addBookings(t *testing.T, h *Harness, base time.Time, prices ...int64) {
+	t.Helper()
+	for i, price := range prices {
+		booking := bookingpg.Booking{Price: money.FromMajor(price, Currency), Time: base.Add(time.Duration(i) * time.Hour), Status: bookingpg.StatusConfirmed}
+		booking.OriginalPrice, booking.Rate = booking.Price, 1
+		if _, err := h.BookingStorage.AddBooking(context.Background(), booking); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestListBookingsPaginatesWithStableOrder(t *testing.T) {
+	h := Start(t)
+	base := time.Date(2030, 1, 1, 10, 0, 0, 0, time.UTC)
+	// Одинаковые цены упорядочиваются по ID
+	addBookings(t, h, base, 300, 100, 300, 200, 300)
+
+	var ids []int
+	query := url.Values{"sort": {"-price"}, "currency": {Currency}, "limit": {"2"}}
+	for page := 0; ; page++ {
+		h.Recorder.Reset()
+		status, list := listBookings(h, query)
+		if status != http.StatusOK {
+			t.Fatalf("page %d status = %d, want 200", page, status)
+		}
+		for _, b := range list.Bookings {
+			ids = append(ids, b.ID)
+		}
+		if list.NextCursor == "" {
+			break
+		}
+		if page > 3 {
+			t.Fatalf("pagination does not end, ids so far %v", ids)
+		}
+		query.Set("cursor", list.NextCursor)
+	}
+
+	want := []int{5, 3, 1, 4, 2}
+	if len(ids) != len(want) {
+		t.Fatalf("ids = %v, want %v", ids, want)
+	}
+	for i := range want {
+		if ids[i] != want[i] {
+			t.Fatalf("ids = %v, want %v", ids, want)
+		}
+	}
+
+	// Span'ы последней страницы
+	h.Recorder.WaitForSpan("/bookings", time.Second)
+	handler := findHandlerSpan(t, h, "/list-bookings", "Handler.ListBookings")
+	h.Recorder.AssertAttribute(handler, "booking.list.count", 1)
+	h.Recorder.AssertAttribute(handler, "booking.list.has_more", false)
+}
+
+func TestListBookingsFilters(t *testing.T) {
+	h := Start(t)
+	base := time.Date(2030, 1, 1, 10, 0, 0, 0, time.UTC)
+	addBookings(t, h, base, 100, 200, 300, 400)
+
+	status, list := listBookings(h, url.Values{
+		"from":      {base.Add(time.Hour).Format(time.RFC3339)},
+		"to":        {base.Add(3 * time.Hour).Format(time.RFC3339)},
+		"currency":  {Currency},
+		"min_price": {"150"},
+		"status":    {bookingpg.StatusConfirmed},
+	})
+	if status != http.StatusOK {
+		t.Fatalf("status = %d, want 200", status)
+	}
+	if len(list.Bookings) != 2 || list.Bookings[0].Price != money.FromMajor(200, Currency) || list.Bookings[1].Price != money.FromMajor(300, Currency) {
+		t.Errorf("bookings = %+v, want prices 200, 300", list.Bookings)
+	}
+
+	// Те же границы со смещением часового пояса
+	msk := time.FixedZone("MSK", 3*60*60)
+	_, list = listBookings(h, url.Values{
+		"from": {base.Add(time.Hour).In(msk).Format(time.RFC3339)},
+		"to":   {base.Add(3 * time.Hour).In(msk).Format(time.RFC3339)},
+	})
+	if len(list.Bookings) != 2 || list.Bookings[0].Price != money.FromMajor(200, Currency) {
+		t.Errorf("bookings with +03:00 bounds = %+v, want prices 200, 300", list.Bookings)
+	}
+
+	if _, list := listBookings(h, url.Values{"status": {"cancelled"}}); len(list.Bookings) != 0 {
+		t.Errorf("cancelled bookings = %+v, want none", list.Bookings)
+	}
+}
+
+func TestListBookingsRejectsInvalidQuery(t *testing.T) {
+	h := Start(t)
+
+	for _, query := range []url.Values{
+		{"sort": {"driver"}},
+		{"limit": {"1000"}},
+		{"from": {"yesterday"}},
+		{"cursor": {"not-a-cursor"}},
+		// Суммы в разных валютах не сравниваются
+		{"sort": {"price"}},
+		{"min_price": {"100"}},
+		{"max_price": {"100"}, "sort": {"time"}},
+		{"min_price": {"1.005"}, "currency": {Currency}},
+		{"min_price": {"10.5"}, "currency": {"JPY"}},
+	} {
+		if status, _ := listBookings(h, query); status != http.StatusBadRequest {
+			t.Errorf("GET /bookings?%s status = %d, want 400", query.Encode(), status)
+		}
+	}
+}
+
+func TestListBookingsByPriceInOneCurrency(t *testing.T) {
+	h := Start(t)
+	base := time.Date(2030, 1, 1, 10, 0, 0, 0, time.UTC)
+	addBookings(t, h, base, 100, 300)
+	// 2.000 KWD больше 100 RUB только как число
+	kwd := bookingpg.Booking{Price: money.New(2000, "KWD"), OriginalPrice: money.New(2000, "KWD"), Rate: 1, Time: base.Add(5 * time.Hour), Status: bookingpg.StatusConfirmed}
+	if _, err := h.BookingStorage.AddBooking(context.Background(), kwd); err != nil {
+		t.Fatal(err)
+	}
+
+	status, list := listBookings(h, url.Values{"sort": {"-price"}, "currency": {Currency}, "min_price": {"1"}})
+	if status != http.StatusOK {
+		t.Fatalf("status = %d, want 200", status)
+	}
+	if len(list.Bookings) != 2 || list.Bookings[0].Price != money.FromMajor(300, Currency) || list.Bookings[1].Price != money.FromMajor(100, Currency) {
+		t.Errorf("RUB bookings by price = %+v, want 300, 100 RUB", list.Bookings)
+	}
+
+	// Сумма разбирается с числом знаков валюты фильтра
+	_, list = listBookings(h, url.Values{"currency": {"KWD"}, "max_price": {"2.005"}})
+	if len(list.Bookings) != 1 || list.Bookings[0].Price != kwd.Price {
+		t.Errorf("KWD bookings up to 2.005 = %+v, want %s", list.Bookings, kwd.Price)
+	}
+}
+
+func TestListCursorIsBoundToFilters(t *testing.T) {
+	h := Start(t)
+	base := time.Date(2030, 1, 1, 10, 0, 0, 0, time.UTC)
+	addBookings(t, h, base, 100, 200, 300)
+
+	query := url.Values{"sort": {"price"}, "currency": {Currency}, "limit": {"1"}}
+	status, list := listBookings(h, query)
+	if status != http.StatusOK || list.NextCursor == "" {
+		t.Fatalf("first page = %d, cursor %q, want 200 with cursor", status, list.NextCursor)
+	}
+
+	// Курсор страницы в рублях не продолжает выборку в другой валюте или с другими фильтрами
+	for _, changed := range []url.Values{
+		{"sort": {"price"}, "currency": {"USD"}, "limit": {"1"}},
+		{"sort": {"price"}, "currency": {Currency}, "min_price": {"150"}, "limit": {"1"}},
+		{"sort": {"price"}, "currency": {Currency}, "status": {bookingpg.StatusCancelled}, "limit": {"1"}},
+	} {
+		changed.Set("cursor", list.NextCursor)
+		if status, _ := listBookings(h, changed); status != http.StatusBadRequest {
+			t.Errorf("GET /bookings?%s status = %d, want 400", changed.Encode(), status)
+		}
+	}
+
+	// С теми же фильтрами и другим размером страницы курсор действует
+	query.Set("cursor", list.NextCursor)
+	query.Set("limit", "5")
+	if status, next := listBookings(h, query); status != http.StatusOK || len(next.Bookings) != 2 {
+		t.Errorf("next page = %d, %d bookings, want 200 with 2 bookings", status, len(next.Bookings))
+	}
+}
@@ -0,0 +1,94 @@
+package integration
+
+import (
+	"fmt"
+	"net/http"
+	"otel-jaeger-learn/pkg/money"
+	"otel-jaeger-learn/pkg/tracing/tracingtest"
+	"price-calcs/pricing"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// appliedRules возвращает правила из событий "pricing rule applied" span'а расчёта цены по порядку
+func appliedRules(t *testing.T, h *Harness) []string {
+	t.Helper()
+	var rules []string
+	for _, event := range h.Recorder.Span("Booking Price Calculation").Events {
+		if event.Name != "pricing rule applied" {
+			continue
+		}
+		if rule, ok := tracingtest.EventValue(event, "pricing.rule"); ok {
+			rules = append(rules, rule)
+		}
+	}
+	return rules
+}
+
+// bookDriverAt бронирует водителя driverId на время at и возвращает сохранённую цену
+func bookDriverAt(t *testing.T, h *Harness, driverId string, at time.Time) money.Money {
+	t.Helper()
+	h.Recorder.Reset()
+	if status, _ := postBookingJSON(h, driverBookingJSON(driverId, at)); status != http.StatusOK {
+		t.Fatalf("POST /bookings status = %d, want 200", status)
+	}
+	h.Recorder.WaitForSpan("/bookings", time.Second)
+	bookings := h.BookingStorage.Bookings()
+	return bookings[len(bookings)-1].Price
+}
+
+func TestPricingRulesAreAppliedInOrder(t *testing.T) {
+	// Надбавка действует в час бронирования bookingTime и в его день недели
+	surgeFrom := bookingTime.Truncate(time.Hour)
+	surge := pricing.RuleConfig{
+		Name:       "rush hour",
+		Type:       pricing.TypeSurge,
+		Multiplier: 1.5,
+		Weekdays:   []string{surgeFrom.Weekday().String()[:3]},
+		From:       surgeFrom.Format("15:04"),
+		To:         fmt.Sprintf("%02d:00", surgeFrom.Hour()+1),
+	}
+	h := Start(t, WithPricingRules(
+		surge,
+		pricing.RuleConfig{Type: pricing.TypeDiscount, Percent: 10},
+		pricing.RuleConfig{Type: pricing.TypeDriverDiscounts},
+		pricing.RuleConfig{Type: pricing.TypeMinFare, Amount: 300},
+		pricing.RuleConfig{Type: pricing.TypeCap, Amount: 1234},
+		pricing.RuleConfig{Type: pricing.TypeRound, Step: 10, Mode: "up"},
+	))
+	h.PricesStorage.SetDriver("3", 1000, 25)
+
+	// 1000 * 1.5 = 1500, -10% = 1350, -25 = 1325, не выше 1234, округление вверх до 1240
+	if price := bookDriverAt(t, h, "3", surgeFrom); price != money.FromMajor(1240, Currency) {
+		t.Errorf("price in rush hour = %v, want 1240", price)
+	}
+	want := []string{"rush hour", "discount", "driver_discounts", "cap", "round"}
+	if got := appliedRules(t, h); !reflect.DeepEqual(got, want) {
+		t.Errorf("applied rules = %q, want %q", got, want)
+	}
+	h.Recorder.AssertEvent(h.Recorder.Span("Booking Price Calculation"), "Price Calculated")
+
+	// Вне часа надбавки: 1000 -10% = 900, -25 = 875, округление вверх до 880
+	if price := bookDriverAt(t, h, "3", surgeFrom.Add(2*time.Hour)); price != money.FromMajor(880, Currency) {
+		t.Errorf("price outside rush hour = %v, want 880", price)
+	}
+	want = []string{"discount", "driver_discounts", "round"}
+	if got := appliedRules(t, h); !reflect.DeepEqual(got, want) {
+		t.Errorf("applied rules = %q, want %q", got, want)
+	}
+}
+
+func TestDefaultRulesFloorAtMinFare(t *testing.T) {
+	h := Start(t)
+	h.PricesStorage.SetDriver("3", 50, 30, 40)
+
+	// 50 - 30 - 40 = -20, не ниже минимальной цены
+	if price := bookDriverAt(t, h, "3", bookingTime); price != money.FromMajor(pricing.DefaultMinFare, Currency) {
+		t.Errorf("price = %v, want %d", price, pricing.DefaultMinFare)
+	}
+	want := []string{"driver_discounts", "min_fare"}
+	if got := appliedRules(t, h); !reflect.DeepEqual(got, want) {
+		t.Errorf("applied rules = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,171 @@
+package integration
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"otel-jaeger-learn/pkg/money"
+	"otel-jaeger-learn/pkg/quote"
+	"price-calcs/pricing"
+	"strings"
+	"testing"
+	"time"
+)
+
+type quoteResponse struct {
+	quote.Quote
+	Breakdown pricing.Breakdown `json:"breakdown"`
+	Token     string            `json:"token"`
+}
+
+// getQuote запрашивает предложение цены водителя driverId на bookingTime через web-entry
+func getQuote(t *testing.T, h *Harness, driverId string) quoteResponse {
+	t.Helper()
+	status, q := requestQuote(t, h, "driver_id="+driverId)
+	if status != http.StatusOK {
+		t.Fatalf("GET /quotes status = %d, want 200", status)
+	}
+	return q
+}
+
+// quotedBookingJSON - тело бронирования на bookingTime по предложению token
+func quotedBookingJSON(driverId, token string) string {
+	return bookingJSONWithQuote(driverId, bookingTime, token)
+}
+
+func bookingJSONWithQuote(driverId string, at time.Time, token string) string {
+	return fmt.Sprintf(`{"id":"1", "time":%q, "driver_id":%q, "quote_token":%q}`, at.Format(time.RFC3339), driverId, token)
+}
+
+func TestQuotedPriceIsBooked(t *testing.T) {
+	h := Start(t)
+	h.PricesStorage.SetDriver("5", 1200)
+
+	q := getQuote(t, h, "5")
+	price := money.FromMajor(1200, Currency)
+	if q.DriverID != "5" || q.Price != price || q.ID == "" || !q.Time.Equal(bookingTime) {
+		t.Fatalf("quote = %+v, want driver 5, price %s at %s", q.Quote, price, bookingTime)
+	}
+	if q.Breakdown.Base != price || q.Breakdown.Total != q.Price {
+		t.Errorf("quote breakdown = %+v, want base 1200 and total equal to price", q.Breakdown)
+	}
+	if until := time.Until(q.ExpiresAt); until <= 0 || until > QuoteTTL {
+		t.Errorf("quote expires in %s, want within %s", until, QuoteTTL)
+	}
+
+	// Цена водителя изменилась после выдачи предложения, бронируется цена из предложения
+	h.PricesStorage.SetDriver("5", 5000)
+	h.Recorder.Reset()
+	status, added := postBookingJSON(h, quotedBookingJSON("", q.Token))
+	if status != http.StatusOK {
+		t.Fatalf("POST /bookings status = %d, want 200", status)
+	}
+	if added.DriverID != "5" {
+		t.Errorf("driver_id = %q, want driver from quote", added.DriverID)
+	}
+
+	h.Recorder.WaitForSpan("/bookings", time.Second)
+	handler := findHandlerSpan(t, h, "/add-booking", "Handler.AddBooking")
+	h.Recorder.AssertAttribute(handler, "booking.price_source", "quote")
+	h.Recorder.AssertAttribute(handler, "quote.id", q.ID)
+	// С предложением price-calcs повторно не вызывается
+	if spans := h.Recorder.SpansByName("/booking-price"); len(spans) != 0 {
+		t.Errorf("price-calcs called %d times, want 0", len(spans))
+	}
+
+	stored := h.BookingStorage.Bookings()[0]
+	if stored.Price != price || stored.QuoteID != q.ID || stored.PriceEstimated {
+		t.Errorf("stored booking = %+v, want price 1200 from quote %s", stored, q.ID)
+	}
+}
+
+func TestInvalidQuoteIsRejected(t *testing.T) {
+	h := Start(t)
+	q := getQuote(t, h, "5")
+
+	signer, err := quote.NewSigner(QuoteKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expired := q.Quote
+	expired.ExpiresAt = time.Now().Add(-time.Minute)
+	expiredToken, err := signer.Sign(expired)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	other, err := quote.NewSigner("other-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cheap := q.Quote
+	cheap.Price = money.New(1, Currency)
+	forgedToken, err := other.Sign(cheap)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name, body, reason string
+	}{
+		{"expired", quotedBookingJSON("5", expiredToken), "quote expired"},
+		{"forged", quotedBookingJSON("5", forgedToken), "invalid quote signature"},
+		{"malformed", quotedBookingJSON("5", "not-a-token"), "malformed quote"},
+		{"other driver", quotedBookingJSON("6", q.Token), "quote is for another driver"},
+		{"other time", bookingJSONWithQuote("5", bookingTime.Add(time.Hour), q.Token), "quote is for another booking time"},
+	}
+	for _, tc := range cases {
+		var body struct {
+			Error string `json:"error"`
+		}
+		resp := h.Do(http.MethodPost, "/bookings", tc.body, nil, &body)
+		if resp.StatusCode != http.StatusUnprocessableEntity || !strings.Contains(body.Error, tc.reason) {
+			t.Errorf("%s: status %d, error %q, want 422 with %q", tc.name, resp.StatusCode, body.Error, tc.reason)
+		}
+	}
+	if got := len(h.BookingStorage.Bookings()); got != 0 {
+		t.Errorf("stored %d bookings, want 0", got)
+	}
+}
+
+func TestQuoteForUnknownDriver(t *testing.T) {
+	h := Start(t)
+	if status, _ := requestQuote(t, h, "driver_id=1000"); status != http.StatusNotFound {
+		t.Errorf("GET /quotes status = %d, want 404", status)
+	}
+}
+
+func TestQuoteIsBoundToBookingTime(t *testing.T) {
+	// Надбавка действует только в час бронирования bookingTime
+	surgeFrom := bookingTime.Truncate(time.Hour)
+	h := Start(t, WithPricingRules(pricing.RuleConfig{
+		Type:       pricing.TypeSurge,
+		Multiplier: 2,
+		From:       surgeFrom.Format("15:04"),
+		To:         surgeFrom.Add(time.Hour).Format("15:04"),
+	}))
+	h.PricesStorage.SetDriver("5", 1000)
+
+	// Предложение вне часа надбавки нельзя использовать для бронирования в час надбавки
+	offPeak := surgeFrom.Add(2 * time.Hour)
+	status, q := requestQuote(t, h, "driver_id=5&time="+url.QueryEscape(offPeak.Format(time.RFC3339)))
+	if status != http.StatusOK || q.Price != money.FromMajor(1000, Currency) || !q.Time.Equal(offPeak) {
+		t.Fatalf("off-peak quote = %d %+v, want 1000 at %s", status, q.Quote, offPeak)
+	}
+	if status, _ := postBookingJSON(h, bookingJSONWithQuote("5", surgeFrom, q.Token)); status != http.StatusUnprocessableEntity {
+		t.Errorf("POST /bookings in rush hour with off-peak quote status = %d, want 422", status)
+	}
+	if got := len(h.BookingStorage.Bookings()); got != 0 {
+		t.Fatalf("stored %d bookings, want 0", got)
+	}
+
+	// На своё время предложение бронируется
+	if status, _ := postBookingJSON(h, bookingJSONWithQuote("5", offPeak, q.Token)); status != http.StatusOK {
+		t.Errorf("POST /bookings at quote time status = %d, want 200", status)
+	}
+
+	// Без времени бронирования предложение не выдаётся
+	if resp := h.Do(http.MethodGet, "/quotes?driver_id=5", "", nil, nil); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("GET /quotes without time status = %d, want 400", resp.StatusCode)
+	}
+}
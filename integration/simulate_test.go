@@ -0,0 +1,89 @@
+package integration
+
+import (
+	"net/http"
+	"otel-jaeger-learn/pkg/money"
+	"price-calcs/pricing"
+	"reflect"
+	"testing"
+)
+
+type simulation struct {
+	DriverID  string            `json:"driver_id"`
+	Price     money.Money       `json:"price"`
+	Breakdown pricing.Breakdown `json:"breakdown"`
+	Rules     string            `json:"rules"`
+}
+
+// simulatePrice отправляет body на POST /price-simulate сервиса price-calcs
+func simulatePrice(h *Harness, body string) (int, simulation) {
+	var sim simulation
+	resp := h.Do(http.MethodPost, h.PriceCalcs.URL+"/price-simulate", body, nil, &sim)
+	return resp.StatusCode, sim
+}
+
+func TestSimulatePriceWithCandidateRules(t *testing.T) {
+	h := Start(t)
+	h.PricesStorage.SetDriver("3", 1000, 25)
+
+	status, sim := simulatePrice(h, `{"driver_id":"3", "time":"2030-01-01T10:00:00Z", "rules":[
+		{"type":"discount", "percent":10},
+		{"type":"driver_discounts"},
+		{"name":"hundreds", "type":"round", "step":100, "mode":"down"}
+	]}`)
+	if status != http.StatusOK {
+		t.Fatalf("POST /price-simulate status = %d, want 200", status)
+	}
+	rub := func(major int64) money.Money { return money.FromMajor(major, Currency) }
+	want := pricing.Breakdown{
+		Base: rub(1000),
+		Steps: []pricing.Step{
+			{Rule: "discount", Type: "discount", Before: rub(1000), After: rub(900), Effect: rub(-100)},
+			{Rule: "driver_discounts", Type: "driver_discounts", Before: rub(900), After: rub(875), Effect: rub(-25)},
+			{Rule: "hundreds", Type: "round", Before: rub(875), After: rub(800), Effect: rub(-75)},
+		},
+		Total: rub(800),
+	}
+	if !reflect.DeepEqual(sim.Breakdown, want) || sim.Price != rub(800) || sim.Rules != "request" {
+		t.Errorf("simulation = %+v, want price 800 with breakdown %+v", sim, want)
+	}
+	h.Recorder.AssertAttribute(h.Recorder.Span("Price Simulation"), "pricing.rules_source", "request")
+
+	// Действующие правила не изменились, симуляция ничего не сохраняет
+	h.Recorder.Reset()
+	if price := bookDriverAt(t, h, "3", bookingTime); price != rub(975) {
+		t.Errorf("booked price = %v, want 975 by current rules", price)
+	}
+}
+
+func TestSimulatePriceWithCurrentRules(t *testing.T) {
+	h := Start(t)
+
+	// Гипотетический водитель: цену и скидки задаёт запрос, база не нужна
+	status, sim := simulatePrice(h, `{"base_price":{"amount":"50.00","currency":"RUB"}, "discounts":[100]}`)
+	if status != http.StatusOK {
+		t.Fatalf("POST /price-simulate status = %d, want 200", status)
+	}
+	if sim.Price != money.FromMajor(pricing.DefaultMinFare, Currency) || sim.Rules != "current" || len(sim.Breakdown.Steps) != 2 {
+		t.Errorf("simulation = %+v, want price %d after driver_discounts and min_fare", sim, pricing.DefaultMinFare)
+	}
+}
+
+func TestSimulatePriceRejectsInvalidRequest(t *testing.T) {
+	h := Start(t)
+
+	cases := []struct {
+		name, body string
+		want       int
+	}{
+		{"no driver and price", `{}`, http.StatusBadRequest},
+		{"unknown field", `{"driver_id":"3", "rule":[]}`, http.StatusBadRequest},
+		{"unknown driver", `{"driver_id":"1000"}`, http.StatusNotFound},
+		{"invalid rule", `{"driver_id":"3", "rules":[{"type":"bonus"}]}`, http.StatusUnprocessableEntity},
+	}
+	for _, tc := range cases {
+		if status, _ := simulatePrice(h, tc.body); status != tc.want {
+			t.Errorf("%s: status = %d, want %d", tc.name, status, tc.want)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package integration
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+type availability struct {
+	Free []struct {
+		Start time.Time `json:"start"`
+		End   time.Time `json:"end"`
+	} `json:"free"`
+}
+
+func TestDriverCannotBeDoubleBooked(t *testing.T) {
+	h := Start(t)
+	start := bookingTime
+
+	h.Recorder.Reset()
+	if status, _ := postBookingJSON(h, driverBookingJSON("7", start)); status != http.StatusOK {
+		t.Fatalf("first booking status = %d, want 200", status)
+	}
+	h.Recorder.WaitForSpan("/bookings", time.Second)
+	h.Recorder.AssertEvent(findHandlerSpan(t, h, "/add-booking", "Handler.AddBooking"), "driver slot reserved")
+
+	// Слот по умолчанию - час, бронирование через полчаса пересекается с ним
+	if status, _ := postBookingJSON(h, driverBookingJSON("7", start.Add(30*time.Minute))); status != http.StatusConflict {
+		t.Errorf("overlapping booking status = %d, want 409", status)
+	}
+	if status, _ := postBookingJSON(h, driverBookingJSON("8", start.Add(30*time.Minute))); status != http.StatusOK {
+		t.Errorf("other driver booking status = %d, want 200", status)
+	}
+	if status, _ := postBookingJSON(h, driverBookingJSON("7", start.Add(time.Hour))); status != http.StatusOK {
+		t.Errorf("adjacent booking status = %d, want 200", status)
+	}
+
+	// Перенос на занятое время тоже конфликт
+	status, _ := sendBookingRequest(h, http.MethodPatch, "/bookings/3", fmt.Sprintf(`{"time":%q}`, start.Add(-30*time.Minute).Format(time.RFC3339)))
+	if status != http.StatusConflict {
+		t.Errorf("reschedule into busy slot status = %d, want 409", status)
+	}
+
+	// Отмена освобождает время водителя
+	if status, _ := sendBookingRequest(h, http.MethodDelete, "/bookings/1", ""); status != http.StatusOK {
+		t.Fatalf("cancel status = %d, want 200", status)
+	}
+	if status, _ := postBookingJSON(h, driverBookingJSON("7", start)); status != http.StatusOK {
+		t.Errorf("booking freed slot status = %d, want 200", status)
+	}
+}
+
+func TestDriverAvailability(t *testing.T) {
+	h := Start(t)
+	start := bookingTime
+	if status, _ := postBookingJSON(h, driverBookingJSON("7", start)); status != http.StatusOK {
+		t.Fatalf("booking status = %d, want 200", status)
+	}
+	if status, _ := postBookingJSON(h, driverBookingJSON("7", start.Add(2*time.Hour))); status != http.StatusOK {
+		t.Fatalf("booking status = %d, want 200", status)
+	}
+
+	from, to := start.Add(-time.Hour), start.Add(4*time.Hour)
+	query := url.Values{"from": {from.Format(time.RFC3339)}, "to": {to.Format(time.RFC3339)}}
+	var got availability
+	if resp := h.Do(http.MethodGet, "/drivers/7/availability?"+query.Encode(), "", nil, &got); resp.StatusCode != http.StatusOK {
+		t.Fatalf("availability status = %d, want 200", resp.StatusCode)
+	}
+
+	want := [][2]time.Time{
+		{from, start},
+		{start.Add(time.Hour), start.Add(2 * time.Hour)},
+		{start.Add(3 * time.Hour), to},
+	}
+	if len(got.Free) != len(want) {
+		t.Fatalf("free slots = %+v, want %v", got.Free, want)
+	}
+	for i, slot := range got.Free {
+		if !slot.Start.Equal(want[i][0]) || !slot.End.Equal(want[i][1]) {
+			t.Errorf("free slot %d = %v - %v, want %v - %v", i, slot.Start, slot.End, want[i][0], want[i][1])
+		}
+	}
+
+	// У другого водителя свободно всё время
+	got = availability{}
+	if resp := h.Do(http.MethodGet, "/drivers/8/availability?"+query.Encode(), "", nil, &got); resp.StatusCode != http.StatusOK || len(got.Free) != 1 {
+		t.Errorf("free slots of free driver = %d %+v, want whole range", resp.StatusCode, got.Free)
+	}
+
+	if resp := h.Do(http.MethodGet, "/drivers/7/availability?from=tomorrow", "", nil, nil); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("availability without range status = %d, want 400", resp.StatusCode)
+	}
+}
@@ -0,0 +1,80 @@
+package integration
+
+import (
+	"net/http"
+	"otel-jaeger-learn/pkg/tracing/tracingtest"
+	"testing"
+	"time"
+)
+
+type validationBody struct {
+	Error  string `json:"error"`
+	Fields []struct {
+		Field string `json:"field"`
+		Rule  string `json:"rule"`
+	} `json:"fields"`
+}
+
+func TestInvalidBookingIsRejectedWithFieldErrors(t *testing.T) {
+	h := Start(t)
+
+	tests := []struct {
+		name string
+		body string
+		want map[string]string // поле -> правило
+	}{
+		{"empty", `{}`, map[string]string{"id": "required", "time": "required"}},
+		{"not rfc3339", `{"id":"1", "time":"2030-01-01 10:00:00"}`, map[string]string{"time": "rfc3339"}},
+		{"past", bookingJSON("1", time.Now().Add(-time.Hour)), map[string]string{"time": "future"}},
+		{"beyond horizon", bookingJSON("", time.Now().Add(BookingHorizon+24*time.Hour)), map[string]string{"id": "required", "time": "horizon"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h.Recorder.Reset()
+			var body validationBody
+			if resp := h.Do(http.MethodPost, "/bookings", tt.body, nil, &body); resp.StatusCode != http.StatusUnprocessableEntity {
+				t.Fatalf("status = %d, want 422", resp.StatusCode)
+			}
+			got := map[string]string{}
+			for _, f := range body.Fields {
+				got[f.Field] = f.Rule
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("fields = %v, want %v", got, tt.want)
+			}
+			// Каждое неверное поле - отдельное событие в span'е хендлера
+			h.Recorder.WaitForSpan("/bookings", time.Second)
+			events := map[string]string{}
+			for _, e := range findHandlerSpan(t, h, "/bookings", "Handler.AddBooking").Events {
+				if e.Name != "validation failed" {
+					continue
+				}
+				field, _ := tracingtest.EventValue(e, "validation.field")
+				rule, _ := tracingtest.EventValue(e, "validation.rule")
+				events[field] = rule
+			}
+			for field, rule := range tt.want {
+				if got[field] != rule {
+					t.Errorf("field %s rule = %q, want %q", field, got[field], rule)
+				}
+				if events[field] != rule {
+					t.Errorf("span event for field %s has rule %q, want %q", field, events[field], rule)
+				}
+			}
+		})
+	}
+
+	if got := len(h.BookingStorage.Bookings()); got != 0 {
+		t.Errorf("stored %d invalid bookings", got)
+	}
+}
+
+func TestBookingStoresRequestedTime(t *testing.T) {
+	h := Start(t)
+	if status, _ := postBookingJSON(h, bookingBody); status != http.StatusOK {
+		t.Fatalf("POST /bookings status = %d, want 200", status)
+	}
+	if got := h.BookingStorage.Bookings()[0].Time; !got.Equal(bookingTime) {
+		t.Errorf("stored time = %v, want %v", got, bookingTime)
+	}
+}
@@ -0,0 +1,114 @@
+// otlp-sink - локальный приёмник OTLP трейсов вместо Tempo.
+//
+// Запуск приёмника:
+//
+//	otlp-sink
+//
+// Просмотр трейса деревом в терминале (адрес API берётся из SINK_ADDR, по умолчанию http://localhost:3200):
+//
+//	otlp-sink list
+//	otlp-sink tree <traceID>
+package main
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	collectorpb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	"google.golang.org/grpc"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"otel-jaeger-learn/pkg/logging"
+	"otlp-sink/config"
+	"otlp-sink/handler"
+	"otlp-sink/storage/spanstore"
+)
+
+func main() {
+	if len(os.Args) > 1 {
+		if err := runCommand(os.Args[1], os.Args[2:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	cfg := config.LoadConfig()
+	logging.InitLogging(logging.Config{Level: "info"})
+
+	store, err := spanstore.NewStore(cfg.MaxTraces, cfg.StoreFile)
+	if err != nil {
+		log.Fatalf("failed to create store: %v", err)
+	}
+	defer store.Close()
+
+	otlpHandler := handler.NewOtlpHnd(store)
+	apiHandler := handler.NewApiHnd(store)
+
+	errs := make(chan error, 3)
+
+	// OTLP/gRPC
+	go func() {
+		lis, err := net.Listen("tcp", ":"+cfg.OtlpGrpcPort)
+		if err != nil {
+			errs <- fmt.Errorf("failed to listen grpc: %w", err)
+			return
+		}
+		srv := grpc.NewServer()
+		collectorpb.RegisterTraceServiceServer(srv, otlpHandler)
+		errs <- srv.Serve(lis)
+	}()
+
+	// OTLP/HTTP
+	go func() {
+		router := gin.New()
+		handler.RegisterOtlpRoutes(router, otlpHandler)
+		errs <- router.Run(":" + cfg.OtlpHttpPort)
+	}()
+
+	// API
+	go func() {
+		router := gin.Default()
+		handler.RegisterApiRoutes(router, apiHandler)
+		errs <- router.Run(":" + cfg.HttpPort)
+	}()
+
+	log.Printf("otlp-sink: OTLP/gRPC :%s, OTLP/HTTP :%s, API :%s", cfg.OtlpGrpcPort, cfg.OtlpHttpPort, cfg.HttpPort)
+	log.Fatalf("otlp-sink stopped: %v", <-errs)
+}
+
+func runCommand(cmd string, args []string) error {
+	addr := os.Getenv("SINK_ADDR")
+	if addr == "" {
+		addr = "http://localhost:3200"
+	}
+
+	switch cmd {
+	case "list":
+		return printURL(addr + "/api/traces")
+	case "tree":
+		if len(args) != 1 {
+			return fmt.Errorf("usage: otlp-sink tree <traceID>")
+		}
+		return printURL(addr + "/api/traces/" + args[0] + "?format=tree")
+	default:
+		return fmt.Errorf("unknown command %q, expected list or tree", cmd)
+	}
+}
+
+func printURL(url string) error {
+	resp, err := http.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("%s: %s", resp.Status, body)
+	}
+	_, err = io.Copy(os.Stdout, resp.Body)
+	return err
+}
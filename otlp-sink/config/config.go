@@ -0,0 +1,24 @@
+package config
+
+import (
+	"github.com/caarlos0/env/v11"
+	"log"
+)
+
+type Config struct {
+	OtlpHttpPort string `env:"OTLP_HTTP_PORT" envDefault:"4318"` // тот же порт, что у Tempo
+	OtlpGrpcPort string `env:"OTLP_GRPC_PORT" envDefault:"4317"`
+	HttpPort     string `env:"HTTP_PORT" envDefault:"3200"` // HTTP API для просмотра трейсов
+	StoreFile    string `env:"STORE_FILE"`                  // если задано - span'ы дописываются в JSONL файл
+	// Сколько трейсов хранится в памяти; файл переписывается, когда в нём вдвое больше трейсов. 0 - без ограничений
+	MaxTraces int `env:"MAX_TRACES" envDefault:"1000"`
+}
+
+func LoadConfig() Config {
+	cfg := Config{}
+	err := env.Parse(&cfg)
+	if err != nil {
+		log.Panicf("failed to load env config: %v", err)
+	}
+	return cfg
+}
@@ -0,0 +1,47 @@
+package handler
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"otlp-sink/storage/spanstore"
+	"strconv"
+	"strings"
+)
+
+const defaultTracesLimit = 20
+
+// ApiHnd отдаёт сохранённые трейсы
+type ApiHnd struct {
+	store *spanstore.Store
+}
+
+func NewApiHnd(store *spanstore.Store) *ApiHnd {
+	return &ApiHnd{store: store}
+}
+
+// ListTraces - GET /api/traces?limit=N
+func (h *ApiHnd) ListTraces(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultTracesLimit)))
+	if err != nil || limit <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid limit"})
+		return
+	}
+	c.JSON(http.StatusOK, h.store.Traces(limit))
+}
+
+// GetTrace - GET /api/traces/:id, с ?format=tree отдаёт дерево текстом для терминала
+func (h *ApiHnd) GetTrace(c *gin.Context) {
+	spans, ok := h.store.Trace(strings.ToLower(c.Param("id")))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "trace not found"})
+		return
+	}
+
+	if c.Query("format") == "tree" {
+		c.Status(http.StatusOK)
+		c.Header("Content-Type", "text/plain; charset=utf-8")
+		spanstore.WriteTree(c.Writer, spans)
+		return
+	}
+	c.JSON(http.StatusOK, spans)
+}
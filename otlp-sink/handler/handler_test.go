@@ -0,0 +1,124 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	collectorpb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/proto"
+	"net/http"
+	"net/http/httptest"
+	"otlp-sink/storage/spanstore"
+	"strings"
+	"testing"
+	"time"
+)
+
+var (
+	traceID = bytes.Repeat([]byte{0xab}, 16)
+	rootID  = bytes.Repeat([]byte{0x01}, 8)
+	childID = bytes.Repeat([]byte{0x02}, 8)
+)
+
+func newRouter(t *testing.T) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	store, err := spanstore.NewStore(10, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	router := gin.New()
+	RegisterOtlpRoutes(router, NewOtlpHnd(store))
+	RegisterApiRoutes(router, NewApiHnd(store))
+	return router
+}
+
+func exportRequest() *collectorpb.ExportTraceServiceRequest {
+	start := uint64(time.Date(2030, 1, 1, 10, 0, 0, 0, time.UTC).UnixNano())
+	return &collectorpb.ExportTraceServiceRequest{
+		ResourceSpans: []*tracepb.ResourceSpans{{
+			Resource: &resourcepb.Resource{Attributes: []*commonpb.KeyValue{{
+				Key:   "service.name",
+				Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: "web-entry"}},
+			}}},
+			ScopeSpans: []*tracepb.ScopeSpans{{Spans: []*tracepb.Span{
+				{TraceId: traceID, SpanId: rootID, Name: "/bookings", StartTimeUnixNano: start, EndTimeUnixNano: start + 3e6},
+				{TraceId: traceID, SpanId: childID, ParentSpanId: rootID, Name: "Booking Quote", StartTimeUnixNano: start + 1e6, EndTimeUnixNano: start + 2e6},
+			}}},
+		}},
+	}
+}
+
+func serve(router *gin.Engine, req *http.Request) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestExportedProtobufTraceIsReadBack(t *testing.T) {
+	router := newRouter(t)
+	body, err := proto.Marshal(exportRequest())
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/v1/traces", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	rec := serve(router, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("POST /v1/traces status = %d, body %q", rec.Code, rec.Body)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "application/x-protobuf" {
+		t.Errorf("response content type = %q, want protobuf as in request", ct)
+	}
+	if err := proto.Unmarshal(rec.Body.Bytes(), &collectorpb.ExportTraceServiceResponse{}); err != nil {
+		t.Errorf("decode response: %v", err)
+	}
+
+	id := hex.EncodeToString(traceID)
+	rec = serve(router, httptest.NewRequest(http.MethodGet, "/api/traces", nil))
+	var summaries []spanstore.TraceSummary
+	if err := json.Unmarshal(rec.Body.Bytes(), &summaries); err != nil {
+		t.Fatalf("decode /api/traces: %v", err)
+	}
+	if len(summaries) != 1 {
+		t.Fatalf("GET /api/traces = %+v, want one trace", summaries)
+	}
+	if s := summaries[0]; s.TraceID != id || s.RootName != "/bookings" || s.Service != "web-entry" || s.SpanCount != 2 || s.Duration != 3*time.Millisecond {
+		t.Errorf("summary = %+v, want root /bookings of web-entry with 2 spans for 3ms", s)
+	}
+
+	// id трейса регистронезависимый
+	rec = serve(router, httptest.NewRequest(http.MethodGet, "/api/traces/"+strings.ToUpper(id), nil))
+	var spans []spanstore.Span
+	if err := json.Unmarshal(rec.Body.Bytes(), &spans); err != nil {
+		t.Fatalf("decode /api/traces/%s: %v", id, err)
+	}
+	if len(spans) != 2 || spans[0].Name != "/bookings" || spans[1].ParentSpanID != hex.EncodeToString(rootID) {
+		t.Errorf("GET /api/traces/%s = %+v, want root and its child by start time", id, spans)
+	}
+
+	rec = serve(router, httptest.NewRequest(http.MethodGet, "/api/traces/"+id+"?format=tree", nil))
+	if tree := rec.Body.String(); !strings.Contains(tree, "/bookings") || !strings.Contains(tree, "Booking Quote") {
+		t.Errorf("tree = %q, want both spans", tree)
+	}
+}
+
+func TestExportErrors(t *testing.T) {
+	router := newRouter(t)
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/traces", strings.NewReader("not protobuf"))
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	if rec := serve(router, req); rec.Code != http.StatusBadRequest {
+		t.Errorf("POST invalid protobuf status = %d, want 400", rec.Code)
+	}
+	if rec := serve(router, httptest.NewRequest(http.MethodGet, "/api/traces/"+strings.Repeat("0", 32), nil)); rec.Code != http.StatusNotFound {
+		t.Errorf("GET unknown trace status = %d, want 404", rec.Code)
+	}
+	if rec := serve(router, httptest.NewRequest(http.MethodGet, "/api/traces?limit=0", nil)); rec.Code != http.StatusBadRequest {
+		t.Errorf("GET /api/traces?limit=0 status = %d, want 400", rec.Code)
+	}
+}
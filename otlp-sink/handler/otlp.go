@@ -0,0 +1,134 @@
+package handler
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	collectorpb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"io"
+	"log/slog"
+	"net/http"
+	"otel-jaeger-learn/pkg/logging"
+	"otlp-sink/storage/spanstore"
+	"strings"
+)
+
+// OtlpHnd принимает экспорт трейсов по OTLP/HTTP и OTLP/gRPC
+type OtlpHnd struct {
+	collectorpb.UnimplementedTraceServiceServer
+	store *spanstore.Store
+}
+
+func NewOtlpHnd(store *spanstore.Store) *OtlpHnd {
+	return &OtlpHnd{store: store}
+}
+
+// Export - OTLP/gRPC метод TraceService
+func (h *OtlpHnd) Export(_ context.Context, req *collectorpb.ExportTraceServiceRequest) (*collectorpb.ExportTraceServiceResponse, error) {
+	if err := h.save(req); err != nil {
+		return nil, err
+	}
+	return &collectorpb.ExportTraceServiceResponse{}, nil
+}
+
+// ExportHTTP - POST /v1/traces, тело в protobuf или JSON
+func (h *OtlpHnd) ExportHTTP(c *gin.Context) {
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.String(http.StatusBadRequest, "failed to read body")
+		return
+	}
+
+	var req collectorpb.ExportTraceServiceRequest
+	isJSON := strings.HasPrefix(c.ContentType(), "application/json")
+	if isJSON {
+		err = unmarshalJSON(body, &req)
+	} else {
+		err = proto.Unmarshal(body, &req)
+	}
+	if err != nil {
+		logging.ErrorErr("failed to decode OTLP request", err)
+		c.String(http.StatusBadRequest, "failed to decode OTLP request")
+		return
+	}
+
+	if err := h.save(&req); err != nil {
+		c.String(http.StatusInternalServerError, "failed to store spans")
+		return
+	}
+
+	// Ответ в том же формате, что и запрос
+	resp := &collectorpb.ExportTraceServiceResponse{}
+	if isJSON {
+		out, _ := protojson.Marshal(resp)
+		c.Data(http.StatusOK, "application/json", out)
+		return
+	}
+	out, _ := proto.Marshal(resp)
+	c.Data(http.StatusOK, "application/x-protobuf", out)
+}
+
+// unmarshalJSON разбирает OTLP/JSON. В нём id span'ов и трейсов в hex, а protojson ждёт base64
+func unmarshalJSON(body []byte, req *collectorpb.ExportTraceServiceRequest) error {
+	var raw any
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return err
+	}
+	if err := hexIDsToBase64(raw); err != nil {
+		return err
+	}
+	converted, err := json.Marshal(raw)
+	if err != nil {
+		return err
+	}
+	return protojson.Unmarshal(converted, req)
+}
+
+func hexIDsToBase64(v any) error {
+	switch val := v.(type) {
+	case map[string]any:
+		for key, item := range val {
+			if str, ok := item.(string); ok && isIDField(key) {
+				id, err := hex.DecodeString(str)
+				if err != nil {
+					return fmt.Errorf("invalid %s: %w", key, err)
+				}
+				val[key] = base64.StdEncoding.EncodeToString(id)
+				continue
+			}
+			if err := hexIDsToBase64(item); err != nil {
+				return err
+			}
+		}
+	case []any:
+		for _, item := range val {
+			if err := hexIDsToBase64(item); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func isIDField(key string) bool {
+	switch key {
+	case "traceId", "spanId", "parentSpanId", "trace_id", "span_id", "parent_span_id":
+		return true
+	}
+	return false
+}
+
+func (h *OtlpHnd) save(req *collectorpb.ExportTraceServiceRequest) error {
+	spans := spanstore.FromResourceSpans(req.GetResourceSpans())
+	if err := h.store.Add(spans); err != nil {
+		logging.ErrorErr("failed to store spans", err)
+		return err
+	}
+	logging.Debug("spans received", slog.Int("count", len(spans)))
+	return nil
+}
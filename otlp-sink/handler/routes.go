@@ -0,0 +1,14 @@
+package handler
+
+import "github.com/gin-gonic/gin"
+
+// RegisterOtlpRoutes регистрирует приём OTLP/HTTP, путь как у коллектора и Tempo
+func RegisterOtlpRoutes(router gin.IRouter, otlpHandler *OtlpHnd) {
+	router.POST("/v1/traces", func(c *gin.Context) { otlpHandler.ExportHTTP(c) })
+}
+
+// RegisterApiRoutes регистрирует API просмотра трейсов
+func RegisterApiRoutes(router gin.IRouter, apiHandler *ApiHnd) {
+	router.GET("/api/traces", func(c *gin.Context) { apiHandler.ListTraces(c) })
+	router.GET("/api/traces/:id", func(c *gin.Context) { apiHandler.GetTrace(c) })
+}
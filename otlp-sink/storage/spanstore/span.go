@@ -0,0 +1,113 @@
+package spanstore
+
+import (
+	"encoding/hex"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"time"
+)
+
+// Span - упрощённое представление OTLP span'а
+type Span struct {
+	TraceID      string         `json:"trace_id"`
+	SpanID       string         `json:"span_id"`
+	ParentSpanID string         `json:"parent_span_id,omitempty"`
+	Name         string         `json:"name"`
+	Service      string         `json:"service"`
+	Kind         string         `json:"kind"`
+	Start        time.Time      `json:"start"`
+	End          time.Time      `json:"end"`
+	StatusCode   string         `json:"status_code"`
+	StatusMsg    string         `json:"status_message,omitempty"`
+	Attributes   map[string]any `json:"attributes,omitempty"`
+	Events       []Event        `json:"events,omitempty"`
+}
+
+type Event struct {
+	Name       string         `json:"name"`
+	Time       time.Time      `json:"time"`
+	Attributes map[string]any `json:"attributes,omitempty"`
+}
+
+// Duration возвращает длительность span'а
+func (s Span) Duration() time.Duration {
+	return s.End.Sub(s.Start)
+}
+
+// FromResourceSpans конвертирует span'ы из OTLP запроса
+func FromResourceSpans(resourceSpans []*tracepb.ResourceSpans) []Span {
+	var spans []Span
+	for _, rs := range resourceSpans {
+		resourceAttrs := convertAttributes(rs.GetResource().GetAttributes())
+		service, _ := resourceAttrs["service.name"].(string)
+
+		for _, ss := range rs.GetScopeSpans() {
+			for _, s := range ss.GetSpans() {
+				spans = append(spans, fromProto(s, service))
+			}
+		}
+	}
+	return spans
+}
+
+func fromProto(s *tracepb.Span, service string) Span {
+	span := Span{
+		TraceID:    hex.EncodeToString(s.GetTraceId()),
+		SpanID:     hex.EncodeToString(s.GetSpanId()),
+		Name:       s.GetName(),
+		Service:    service,
+		Kind:       s.GetKind().String(),
+		Start:      time.Unix(0, int64(s.GetStartTimeUnixNano())).UTC(),
+		End:        time.Unix(0, int64(s.GetEndTimeUnixNano())).UTC(),
+		StatusCode: s.GetStatus().GetCode().String(),
+		StatusMsg:  s.GetStatus().GetMessage(),
+		Attributes: convertAttributes(s.GetAttributes()),
+	}
+	if len(s.GetParentSpanId()) > 0 {
+		span.ParentSpanID = hex.EncodeToString(s.GetParentSpanId())
+	}
+	for _, e := range s.GetEvents() {
+		span.Events = append(span.Events, Event{
+			Name:       e.GetName(),
+			Time:       time.Unix(0, int64(e.GetTimeUnixNano())).UTC(),
+			Attributes: convertAttributes(e.GetAttributes()),
+		})
+	}
+	return span
+}
+
+func convertAttributes(kvs []*commonpb.KeyValue) map[string]any {
+	if len(kvs) == 0 {
+		return nil
+	}
+	attrs := make(map[string]any, len(kvs))
+	for _, kv := range kvs {
+		attrs[kv.GetKey()] = convertValue(kv.GetValue())
+	}
+	return attrs
+}
+
+func convertValue(v *commonpb.AnyValue) any {
+	switch val := v.GetValue().(type) {
+	case *commonpb.AnyValue_StringValue:
+		return val.StringValue
+	case *commonpb.AnyValue_BoolValue:
+		return val.BoolValue
+	case *commonpb.AnyValue_IntValue:
+		return val.IntValue
+	case *commonpb.AnyValue_DoubleValue:
+		return val.DoubleValue
+	case *commonpb.AnyValue_BytesValue:
+		return hex.EncodeToString(val.BytesValue)
+	case *commonpb.AnyValue_ArrayValue:
+		values := make([]any, 0, len(val.ArrayValue.GetValues()))
+		for _, item := range val.ArrayValue.GetValues() {
+			values = append(values, convertValue(item))
+		}
+		return values
+	case *commonpb.AnyValue_KvlistValue:
+		return convertAttributes(val.KvlistValue.GetValues())
+	default:
+		return nil
+	}
+}
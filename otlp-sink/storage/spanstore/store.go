@@ -0,0 +1,225 @@
+// Package spanstore хранит принятые span'ы в памяти и, опционально, в JSONL файле
+package spanstore
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// TraceSummary - краткая информация о трейсе для списка
+type TraceSummary struct {
+	TraceID   string        `json:"trace_id"`
+	RootName  string        `json:"root_name"`
+	Service   string        `json:"service"`
+	SpanCount int           `json:"span_count"`
+	Start     time.Time     `json:"start"`
+	Duration  time.Duration `json:"duration_ns"`
+	HasError  bool          `json:"has_error"`
+}
+
+type Store struct {
+	mu        sync.RWMutex
+	traces    map[string][]Span
+	order     []string // trace id в порядке получения, для вытеснения старых
+	maxTraces int
+	file      *os.File
+	filePath  string
+	// Трейсов вытеснено из памяти, но ещё лежит в файле
+	evicted int
+}
+
+// NewStore создаёт хранилище не более чем на maxTraces трейсов.
+// Если filePath не пустой, ранее сохранённые span'ы загружаются из него, а новые дописываются.
+// Файл переписывается только с трейсами из памяти, когда вытесненных в нём становится maxTraces,
+// поэтому в нём не больше 2 * maxTraces трейсов (при maxTraces = 0 и файл, и память не ограничены)
+func NewStore(maxTraces int, filePath string) (*Store, error) {
+	s := &Store{
+		traces:    make(map[string][]Span),
+		maxTraces: maxTraces,
+		filePath:  filePath,
+	}
+	if filePath == "" {
+		return s, nil
+	}
+
+	if err := s.load(filePath); err != nil {
+		return nil, err
+	}
+	// Файл с прошлого запуска мог быть больше лимита, например если MAX_TRACES уменьшили
+	if s.evicted > 0 {
+		if err := s.rewrite(); err != nil {
+			return nil, err
+		}
+		return s, nil
+	}
+	file, err := os.OpenFile(filePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0666)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open store file: %w", err)
+	}
+	s.file = file
+	return s, nil
+}
+
+func (s *Store) Close() error {
+	if s.file == nil {
+		return nil
+	}
+	return s.file.Close()
+}
+
+// Add сохраняет span'ы
+func (s *Store) Add(spans []Span) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, span := range spans {
+		s.add(span)
+	}
+
+	if s.file == nil {
+		return nil
+	}
+	if s.maxTraces > 0 && s.evicted >= s.maxTraces {
+		return s.rewrite()
+	}
+	return writeSpans(s.file, spans)
+}
+
+func writeSpans(file *os.File, spans []Span) error {
+	w := bufio.NewWriter(file)
+	enc := json.NewEncoder(w)
+	for _, span := range spans {
+		if err := enc.Encode(span); err != nil {
+			return fmt.Errorf("failed to write span: %w", err)
+		}
+	}
+	return w.Flush()
+}
+
+// rewrite заменяет файл span'ами трейсов, которые есть в памяти. Новый файл пишется рядом и переименовывается,
+// так что при падении посередине остаётся старый файл целиком
+func (s *Store) rewrite() error {
+	tmp, err := os.CreateTemp(filepath.Dir(s.filePath), filepath.Base(s.filePath)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to create store file: %w", err)
+	}
+	defer os.Remove(tmp.Name()) // после успешного переименования файла с этим именем уже нет
+
+	for _, traceID := range s.order {
+		if err := writeSpans(tmp, s.traces[traceID]); err != nil {
+			tmp.Close()
+			return err
+		}
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write store file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), s.filePath); err != nil {
+		return fmt.Errorf("failed to replace store file: %w", err)
+	}
+
+	file, err := os.OpenFile(s.filePath, os.O_APPEND|os.O_WRONLY, 0666)
+	if err != nil {
+		return fmt.Errorf("failed to open store file: %w", err)
+	}
+	if s.file != nil {
+		s.file.Close()
+	}
+	s.file = file
+	s.evicted = 0
+	return nil
+}
+
+// Trace возвращает span'ы трейса, отсортированные по времени начала
+func (s *Store) Trace(traceID string) ([]Span, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	spans, ok := s.traces[traceID]
+	if !ok {
+		return nil, false
+	}
+	result := append([]Span(nil), spans...)
+	sort.SliceStable(result, func(i, j int) bool { return result[i].Start.Before(result[j].Start) })
+	return result, true
+}
+
+// Traces возвращает краткую информацию о последних limit трейсах, новые первыми
+func (s *Store) Traces(limit int) []TraceSummary {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var summaries []TraceSummary
+	for i := len(s.order) - 1; i >= 0 && len(summaries) < limit; i-- {
+		summaries = append(summaries, summarize(s.order[i], s.traces[s.order[i]]))
+	}
+	return summaries
+}
+
+func (s *Store) add(span Span) {
+	if _, ok := s.traces[span.TraceID]; !ok {
+		s.order = append(s.order, span.TraceID)
+		// Вытесняем самый старый трейс
+		if s.maxTraces > 0 && len(s.order) > s.maxTraces {
+			delete(s.traces, s.order[0])
+			s.order = s.order[1:]
+			s.evicted++
+		}
+	}
+	s.traces[span.TraceID] = append(s.traces[span.TraceID], span)
+}
+
+func (s *Store) load(filePath string) error {
+	file, err := os.Open(filePath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open store file: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var span Span
+		if err := json.Unmarshal(scanner.Bytes(), &span); err != nil {
+			return fmt.Errorf("failed to parse store file: %w", err)
+		}
+		s.add(span)
+	}
+	return scanner.Err()
+}
+
+func summarize(traceID string, spans []Span) TraceSummary {
+	summary := TraceSummary{TraceID: traceID, SpanCount: len(spans)}
+	spanIDs := make(map[string]bool, len(spans))
+	for _, span := range spans {
+		spanIDs[span.SpanID] = true
+	}
+
+	var end time.Time
+	for _, span := range spans {
+		if summary.Start.IsZero() || span.Start.Before(summary.Start) {
+			summary.Start = span.Start
+		}
+		if span.End.After(end) {
+			end = span.End
+		}
+		if span.StatusCode == "STATUS_CODE_ERROR" {
+			summary.HasError = true
+		}
+		if span.ParentSpanID == "" || !spanIDs[span.ParentSpanID] {
+			summary.RootName = span.Name
+			summary.Service = span.Service
+		}
+	}
+	summary.Duration = end.Sub(summary.Start)
+	return summary
+}
@@ -0,0 +1,116 @@
+package spanstore
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func testSpan(trace int) Span {
+	start := time.Date(2030, 1, 1, 10, 0, trace, 0, time.UTC)
+	return Span{
+		TraceID: fmt.Sprintf("%032x", trace),
+		SpanID:  fmt.Sprintf("%016x", trace),
+		Name:    fmt.Sprintf("span %d", trace),
+		Start:   start,
+		End:     start.Add(time.Millisecond),
+	}
+}
+
+// fileLines возвращает число span'ов в файле хранилища
+func fileLines(t *testing.T, path string) int {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	lines := 0
+	for scanner := bufio.NewScanner(file); scanner.Scan(); {
+		lines++
+	}
+	return lines
+}
+
+func traceIDs(s *Store) []string {
+	var ids []string
+	for _, summary := range s.Traces(100) {
+		ids = append(ids, summary.TraceID)
+	}
+	return ids
+}
+
+func TestStoreFileIsCompactedToMaxTraces(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "spans.jsonl")
+	store, err := NewStore(3, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	// После 5 трейсов 2 вытеснены из памяти, но ещё в файле
+	for i := 1; i <= 5; i++ {
+		if err := store.Add([]Span{testSpan(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := fileLines(t, path); got != 5 {
+		t.Fatalf("file has %d spans, want 5 before compaction", got)
+	}
+	// Третий вытесненный трейс переписывает файл трейсами из памяти
+	if err := store.Add([]Span{testSpan(6)}); err != nil {
+		t.Fatal(err)
+	}
+	if got := fileLines(t, path); got != 3 {
+		t.Fatalf("file has %d spans, want 3 after compaction", got)
+	}
+	// Запись после переписывания продолжается в новый файл
+	if err := store.Add([]Span{testSpan(7)}); err != nil {
+		t.Fatal(err)
+	}
+	if got := fileLines(t, path); got != 4 {
+		t.Fatalf("file has %d spans, want 4 after append", got)
+	}
+	want := []string{testSpan(7).TraceID, testSpan(6).TraceID, testSpan(5).TraceID}
+	if got := traceIDs(store); !reflect.DeepEqual(got, want) {
+		t.Errorf("traces = %v, want %v", got, want)
+	}
+}
+
+func TestStoreReloadsFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "spans.jsonl")
+	store, err := NewStore(0, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= 4; i++ {
+		if err := store.Add([]Span{testSpan(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	store.Close()
+
+	// С меньшим лимитом лишние трейсы вытесняются при загрузке и файл сразу переписывается
+	reloaded, err := NewStore(2, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reloaded.Close()
+	want := []string{testSpan(4).TraceID, testSpan(3).TraceID}
+	if got := traceIDs(reloaded); !reflect.DeepEqual(got, want) {
+		t.Errorf("traces after reload = %v, want %v", got, want)
+	}
+	if got := fileLines(t, path); got != 2 {
+		t.Errorf("file has %d spans after reload, want 2", got)
+	}
+	if err := reloaded.Add([]Span{testSpan(5)}); err != nil {
+		t.Fatal(err)
+	}
+	if got := fileLines(t, path); got != 3 {
+		t.Errorf("file has %d spans, want 3 after append", got)
+	}
+}
@@ -0,0 +1,91 @@
+package spanstore
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// WriteTree выводит span'ы трейса деревом, как в терминале
+func WriteTree(w io.Writer, spans []Span) {
+	children := make(map[string][]Span)
+	known := make(map[string]bool, len(spans))
+	for _, span := range spans {
+		known[span.SpanID] = true
+	}
+
+	var roots []Span
+	for _, span := range spans {
+		if span.ParentSpanID == "" || !known[span.ParentSpanID] {
+			roots = append(roots, span)
+			continue
+		}
+		children[span.ParentSpanID] = append(children[span.ParentSpanID], span)
+	}
+
+	byStart := func(list []Span) {
+		sort.SliceStable(list, func(i, j int) bool { return list[i].Start.Before(list[j].Start) })
+	}
+	byStart(roots)
+	for id := range children {
+		byStart(children[id])
+	}
+
+	var start time.Time
+	if len(roots) > 0 {
+		start = roots[0].Start
+	}
+
+	var write func(span Span, prefix string, last bool, depth int)
+	write = func(span Span, prefix string, last bool, depth int) {
+		branch, next := "├── ", "│   "
+		if last {
+			branch, next = "└── ", "    "
+		}
+		if depth == 0 {
+			branch, next = "", ""
+		}
+
+		status := ""
+		if span.StatusCode == "STATUS_CODE_ERROR" {
+			status = " ERROR"
+			if span.StatusMsg != "" {
+				status += ": " + span.StatusMsg
+			}
+		}
+		fmt.Fprintf(w, "%s%s%s [%s] +%s %s%s\n", prefix, branch, span.Name, span.Service,
+			span.Start.Sub(start).Round(time.Microsecond), span.Duration().Round(time.Microsecond), status)
+
+		for _, e := range span.Events {
+			fmt.Fprintf(w, "%s%s  • %s%s\n", prefix, next, e.Name, formatAttrs(e.Attributes))
+		}
+
+		kids := children[span.SpanID]
+		for i, child := range kids {
+			write(child, prefix+next, i == len(kids)-1, depth+1)
+		}
+	}
+
+	for _, root := range roots {
+		write(root, "", true, 0)
+	}
+}
+
+func formatAttrs(attrs map[string]any) string {
+	if len(attrs) == 0 {
+		return ""
+	}
+	keys := make([]string, 0, len(attrs))
+	for k := range attrs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		parts = append(parts, fmt.Sprintf("%s=%v", k, attrs[k]))
+	}
+	return " {" + strings.Join(parts, ", ") + "}"
+}
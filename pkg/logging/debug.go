@@ -0,0 +1,50 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"sync/atomic"
+)
+
+// DebugContextFunc reports whether debug logs are forced for the context
+type DebugContextFunc func(ctx context.Context) bool
+
+var debugContext atomic.Pointer[DebugContextFunc]
+
+// SetDebugContextFunc sets how to detect contexts with forced debug logs,
+// e.g. tracing sets it to check debug flag in baggage of the request
+func SetDebugContextFunc(f DebugContextFunc) {
+	debugContext.Store(&f)
+}
+
+func isDebugContext(ctx context.Context) bool {
+	f := debugContext.Load()
+	return f != nil && *f != nil && ctx != nil && (*f)(ctx)
+}
+
+// contextLevelHandler пропускает записи не ниже level, а для контекстов с включённой
+// отладкой (см. SetDebugContextFunc) - все записи вплоть до debug
+type contextLevelHandler struct {
+	slog.Handler
+	level slog.Leveler
+}
+
+// NewContextLevelHandler wraps handler that must accept debug records
+func NewContextLevelHandler(handler slog.Handler, level slog.Leveler) slog.Handler {
+	return &contextLevelHandler{Handler: handler, level: level}
+}
+
+func (h *contextLevelHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	if level >= h.level.Level() {
+		return true
+	}
+	return level >= slog.LevelDebug && isDebugContext(ctx)
+}
+
+func (h *contextLevelHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &contextLevelHandler{Handler: h.Handler.WithAttrs(attrs), level: h.level}
+}
+
+func (h *contextLevelHandler) WithGroup(name string) slog.Handler {
+	return &contextLevelHandler{Handler: h.Handler.WithGroup(name), level: h.level}
+}
@@ -32,10 +32,11 @@ func InitLogging(cfg Config) {
 		level = slog.LevelDebug
 	}
 
-	logger := slog.New(slog.NewJSONHandler(logOut, &slog.HandlerOptions{
-		Level:     level,
+	// Сам JSON хендлер пропускает всё, уровень проверяется с учётом режима отладки запроса
+	logger := slog.New(NewContextLevelHandler(slog.NewJSONHandler(logOut, &slog.HandlerOptions{
+		Level:     slog.LevelDebug,
 		AddSource: true,
-	}))
+	}), level))
 
 	slog.SetDefault(logger)
 }
@@ -5,41 +5,64 @@ import (
 	"log/slog"
 )
 
-var defaultLogger = &Logger{logger: slog.Default()}
+var defaultLogger = &Logger{}
 
 func GetDefault() *Logger {
 	return defaultLogger
 }
 
+// Logger пишет в slog.Default(), если не задан свой slog.Logger.
+// Контекст передаётся в slog.Handler, по нему например включается режим отладки запроса.
 type Logger struct {
 	logger *slog.Logger
+	ctx    context.Context
 }
 
 func (l *Logger) Info(msg string, attrs ...slog.Attr) {
-	logAttrs(context.Background(), l.logger, slog.LevelInfo, msg, attrs)
+	logAttrs(l.context(), l.slog(), slog.LevelInfo, msg, attrs)
 }
 
 func (l *Logger) Warn(msg string, attrs ...slog.Attr) {
-	logAttrs(context.Background(), l.logger, slog.LevelWarn, msg, attrs)
+	logAttrs(l.context(), l.slog(), slog.LevelWarn, msg, attrs)
 }
 
 func (l *Logger) Error(msg string, attrs ...slog.Attr) {
-	logAttrs(context.Background(), l.logger, slog.LevelError, msg, attrs)
+	logAttrs(l.context(), l.slog(), slog.LevelError, msg, attrs)
 }
 
 func (l *Logger) ErrorErr(msg string, err error, attrs ...slog.Attr) {
 	attrs = append(attrs, slog.String("error", err.Error()))
-	logAttrs(context.Background(), l.logger, slog.LevelError, msg, attrs)
+	logAttrs(l.context(), l.slog(), slog.LevelError, msg, attrs)
 }
 
 func (l *Logger) Debug(msg string, attrs ...slog.Attr) {
-	logAttrs(context.Background(), l.logger, slog.LevelDebug, msg, attrs)
+	logAttrs(l.context(), l.slog(), slog.LevelDebug, msg, attrs)
 }
 
 func (l *Logger) With(attr slog.Attr) *Logger {
-	return &Logger{logger: l.logger.With(attr)}
+	return &Logger{logger: l.slog().With(attr), ctx: l.ctx}
+}
+
+// WithContext returns logger that passes ctx to the log handler
+func (l *Logger) WithContext(ctx context.Context) *Logger {
+	return &Logger{logger: l.logger, ctx: ctx}
 }
 
 func NewWith(attr slog.Attr) *Logger {
-	return &Logger{logger: defaultLogger.logger.With(attr)}
+	return defaultLogger.With(attr)
+}
+
+func (l *Logger) slog() *slog.Logger {
+	// slog.Default() берётся при каждом вызове, т.к. InitLogging может быть вызван после создания логгера
+	if l.logger == nil {
+		return slog.Default()
+	}
+	return l.logger
+}
+
+func (l *Logger) context() context.Context {
+	if l.ctx == nil {
+		return context.Background()
+	}
+	return l.ctx
 }
@@ -8,6 +8,9 @@ import (
 )
 
 func logAttrs(ctx context.Context, logger *slog.Logger, level slog.Level, msg string, attrs []slog.Attr) {
+	if !logger.Handler().Enabled(ctx, level) {
+		return
+	}
 	var pcs [1]uintptr
 	runtime.Callers(3, pcs[:]) // skip: [Callers, this func, log wrapper func]
 	r := slog.NewRecord(time.Now(), level, msg, pcs[0])
@@ -0,0 +1,292 @@
+// Package money - денежная сумма в минимальных единицах валюты (копейках, центах) с кодом валюты ISO 4217.
+// Сложение и вычитание точные, умножение округляет до минимальной единицы половину от нуля
+package money
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrInvalidAmount - строка не является суммой с допустимым для валюты числом знаков после точки
+	ErrInvalidAmount = errors.New("invalid money amount")
+	// ErrInvalidCurrency - валюта не задана или не код ISO 4217 из трёх заглавных латинских букв
+	ErrInvalidCurrency = errors.New("invalid currency")
+)
+
+// Знаков после точки у валют, где их не 2
+var minorDigits = map[string]int{
+	"JPY": 0, "KRW": 0, "VND": 0, "CLP": 0, "ISK": 0,
+	"BHD": 3, "KWD": 3, "OMR": 3, "JOD": 3, "TND": 3,
+}
+
+// Digits возвращает число знаков после точки у валюты
+func Digits(currency string) int {
+	if d, ok := minorDigits[currency]; ok {
+		return d
+	}
+	return 2
+}
+
+// Money - сумма Amount в минимальных единицах валюты Currency
+type Money struct {
+	Amount   int64
+	Currency string
+}
+
+// New создаёт сумму из минимальных единиц
+func New(minor int64, currency string) Money {
+	return Money{Amount: minor, Currency: currency}
+}
+
+// FromMajor создаёт сумму из целых единиц валюты (рублей, долларов)
+func FromMajor(major int64, currency string) Money {
+	return Money{Amount: major * scale(currency), Currency: currency}
+}
+
+// FromFloat переводит float64 в сумму с округлением до минимальной единицы. Только для значений
+// из конфигурации и правил, суммы из базы и JSON разбираются точно через Parse
+func FromFloat(f float64, currency string) Money {
+	return Money{Amount: int64(math.Round(f * float64(scale(currency)))), Currency: currency}
+}
+
+// Parse разбирает десятичную строку вида "-1234.5" точно, без float64
+func Parse(s, currency string) (Money, error) {
+	digits := Digits(currency)
+	orig := s
+	neg := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(s, "-")
+	whole, frac, _ := strings.Cut(s, ".")
+	if whole == "" || len(frac) > digits || strings.ContainsAny(whole+frac, "+-") {
+		return Money{}, fmt.Errorf("%w %q for %s", ErrInvalidAmount, orig, currency)
+	}
+	frac += strings.Repeat("0", digits-len(frac))
+	minor, err := strconv.ParseInt(whole+frac, 10, 64)
+	if err != nil {
+		return Money{}, fmt.Errorf("%w %q for %s", ErrInvalidAmount, orig, currency)
+	}
+	if neg {
+		minor = -minor
+	}
+	return Money{Amount: minor, Currency: currency}, nil
+}
+
+// ValidateCurrency проверяет, что currency - код ISO 4217: три заглавные латинские буквы
+func ValidateCurrency(currency string) error {
+	if len(currency) != 3 || strings.Trim(currency, "ABCDEFGHIJKLMNOPQRSTUVWXYZ") != "" {
+		return fmt.Errorf("%w %q, want ISO 4217 code", ErrInvalidCurrency, currency)
+	}
+	return nil
+}
+
+func scale(currency string) int64 {
+	s := int64(1)
+	for i := 0; i < Digits(currency); i++ {
+		s *= 10
+	}
+	return s
+}
+
+// mustMatch паникует, если валюты разные: складывать рубли с долларами - ошибка в коде, а не во входных данных
+func (m Money) mustMatch(o Money) {
+	if m.Currency != o.Currency {
+		panic(fmt.Sprintf("money: currency mismatch %s and %s", m.Currency, o.Currency))
+	}
+}
+
+func (m Money) Add(o Money) Money {
+	m.mustMatch(o)
+	return Money{Amount: m.Amount + o.Amount, Currency: m.Currency}
+}
+
+func (m Money) Sub(o Money) Money {
+	m.mustMatch(o)
+	return Money{Amount: m.Amount - o.Amount, Currency: m.Currency}
+}
+
+// Mul умножает сумму на factor и округляет до минимальной единицы половину от нуля. Как и в Convert,
+// множитель берётся как его кратчайшая десятичная запись: 0.3 - это ровно 3/10, а не ближайший float64 чуть меньше
+func (m Money) Mul(factor float64) Money {
+	product := new(big.Rat).Mul(new(big.Rat).SetInt64(m.Amount), decimalRat(factor))
+	return Money{Amount: roundRat(product), Currency: m.Currency}
+}
+
+// Convert переводит сумму в валюту currency по курсу rate (единиц currency за единицу m.Currency)
+// и округляет до минимальной единицы currency половину от нуля. Курс берётся как его кратчайшая десятичная запись,
+// так курс 0.0105 из базы или файла умножается точно, а не как ближайший к нему float64
+func (m Money) Convert(rate float64, currency string) Money {
+	product := new(big.Rat).Mul(new(big.Rat).SetInt64(m.Amount), decimalRat(rate))
+	product.Mul(product, new(big.Rat).SetFrac64(scale(currency), scale(m.Currency)))
+	return Money{Amount: roundRat(product), Currency: currency}
+}
+
+// decimalRat возвращает кратчайшую десятичную запись f точной дробью
+func decimalRat(f float64) *big.Rat {
+	r, ok := new(big.Rat).SetString(strconv.FormatFloat(f, 'g', -1, 64))
+	if !ok {
+		panic(fmt.Sprintf("money: invalid factor %v", f))
+	}
+	return r
+}
+
+// roundRat округляет до целого половину от нуля. Результат, который не помещается в int64, - ошибка в коде
+// (курс или множитель не из того диапазона), поэтому паника, как и в mustMatch, а не молча испорченная сумма
+func roundRat(r *big.Rat) int64 {
+	num, den := new(big.Int).Set(r.Num()), r.Denom()
+	neg := num.Sign() < 0
+	num.Abs(num)
+	// (2*num + den) / (2*den) - округление половины вверх для положительных
+	num.Mul(num, big.NewInt(2)).Add(num, den)
+	q := num.Quo(num, new(big.Int).Mul(den, big.NewInt(2)))
+	if neg {
+		q.Neg(q)
+	}
+	if !q.IsInt64() {
+		panic(fmt.Sprintf("money: amount %s overflows int64", q))
+	}
+	return q.Int64()
+}
+
+// Cmp сравнивает суммы одной валюты: -1, 0 или 1
+func (m Money) Cmp(o Money) int {
+	m.mustMatch(o)
+	switch {
+	case m.Amount < o.Amount:
+		return -1
+	case m.Amount > o.Amount:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func (m Money) IsNegative() bool { return m.Amount < 0 }
+
+func (m Money) IsZero() bool { return m.Amount == 0 }
+
+// Decimal возвращает сумму десятичной строкой с числом знаков валюты, например "1234.50"
+func (m Money) Decimal() string {
+	digits := Digits(m.Currency)
+	abs := m.Amount
+	sign := ""
+	if abs < 0 {
+		abs, sign = -abs, "-"
+	}
+	if digits == 0 {
+		return sign + strconv.FormatInt(abs, 10)
+	}
+	s := scale(m.Currency)
+	return fmt.Sprintf("%s%d.%0*d", sign, abs/s, digits, abs%s)
+}
+
+// Float64 - приблизительное значение для метрик и атрибутов span'ов, не для расчётов
+func (m Money) Float64() float64 {
+	return float64(m.Amount) / float64(scale(m.Currency))
+}
+
+// String возвращает сумму с валютой, например "1234.50 RUB"
+func (m Money) String() string {
+	if m.Currency == "" {
+		return m.Decimal()
+	}
+	return m.Decimal() + " " + m.Currency
+}
+
+// MarshalText и UnmarshalText - формат String, например для переменных окружения: "1000 RUB"
+func (m Money) MarshalText() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// UnmarshalText требует валюту: сумма без неё, например "1000", - ошибка
+func (m *Money) UnmarshalText(text []byte) error {
+	amount, currency, _ := strings.Cut(strings.TrimSpace(string(text)), " ")
+	currency = strings.TrimSpace(currency)
+	if err := ValidateCurrency(currency); err != nil {
+		return err
+	}
+	parsed, err := Parse(amount, currency)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
+
+// jsonMoney - сумма в JSON: amount строкой, чтобы не терять точность на float у клиента
+type jsonMoney struct {
+	Amount   string `json:"amount"`
+	Currency string `json:"currency"`
+}
+
+func (m Money) MarshalJSON() ([]byte, error) {
+	return json.Marshal(jsonMoney{Amount: m.Decimal(), Currency: m.Currency})
+}
+
+// UnmarshalJSON принимает {"amount": "12.34", "currency": "RUB"}, amount может быть и числом, currency обязательна
+func (m *Money) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		Amount   json.RawMessage `json:"amount"`
+		Currency string          `json:"currency"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	if err := ValidateCurrency(raw.Currency); err != nil {
+		return err
+	}
+	amount := strings.Trim(string(raw.Amount), `"`)
+	parsed, err := Parse(amount, raw.Currency)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
+
+// Value сохраняет в базу только сумму (колонка DECIMAL), валюта хранится в отдельной колонке
+func (m Money) Value() (driver.Value, error) {
+	return m.Decimal(), nil
+}
+
+// Scan читает сумму из колонки DECIMAL и не меняет Currency: валюту читают в m.Currency из отдельной колонки,
+// и в rows.Scan она должна идти до суммы, чтобы сумма разбиралась с числом знаков этой валюты
+func (m *Money) Scan(src any) error {
+	var s string
+	switch v := src.(type) {
+	case []byte:
+		s = string(v)
+	case string:
+		s = v
+	case int64:
+		m.Amount = v * scale(m.Currency)
+		return nil
+	case float64:
+		m.Amount = FromFloat(v, m.Currency).Amount
+		return nil
+	default:
+		return fmt.Errorf("money: cannot scan %T", src)
+	}
+	// DECIMAL(10, 2) и NUMERIC(12, 3) отдают столько знаков, сколько у колонки, лишние нули у валют с меньшим числом знаков отбрасываем
+	whole, frac, _ := strings.Cut(s, ".")
+	if digits := Digits(m.Currency); len(frac) > digits {
+		if strings.Trim(frac[digits:], "0") != "" {
+			return fmt.Errorf("%w %q for %s", ErrInvalidAmount, s, m.Currency)
+		}
+		frac = frac[:digits]
+	}
+	if frac != "" {
+		whole += "." + frac
+	}
+	parsed, err := Parse(whole, m.Currency)
+	if err != nil {
+		return err
+	}
+	m.Amount = parsed.Amount
+	return nil
+}
@@ -0,0 +1,159 @@
+package money_test
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"otel-jaeger-learn/pkg/money"
+	"testing"
+)
+
+func TestParseAndDecimal(t *testing.T) {
+	cases := []struct {
+		in, currency, want string
+		minor              int64
+	}{
+		{"1234.5", "RUB", "1234.50", 123450},
+		{"-0.01", "USD", "-0.01", -1},
+		{"1000", "JPY", "1000", 1000},
+		{"1.005", "KWD", "1.005", 1005},
+		{"12.", "RUB", "12.00", 1200},
+	}
+	for _, tc := range cases {
+		m, err := money.Parse(tc.in, tc.currency)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", tc.in, err)
+		}
+		if m.Amount != tc.minor || m.Decimal() != tc.want {
+			t.Errorf("Parse(%q, %s) = %d (%s), want %d (%s)", tc.in, tc.currency, m.Amount, m.Decimal(), tc.minor, tc.want)
+		}
+	}
+
+	for _, bad := range []string{"", "1.234", "abc", "1e3", ".5", "--1", "1.-5"} {
+		if _, err := money.Parse(bad, "RUB"); !errors.Is(err, money.ErrInvalidAmount) {
+			t.Errorf("Parse(%q): %v, want ErrInvalidAmount", bad, err)
+		}
+	}
+}
+
+func TestArithmeticIsExact(t *testing.T) {
+	// 0.1 + 0.2 во float64 не равно 0.3
+	sum := money.New(10, "RUB").Add(money.New(20, "RUB"))
+	if sum != money.New(30, "RUB") {
+		t.Errorf("0.10 + 0.20 = %s, want 0.30 RUB", sum)
+	}
+	if got := money.New(1000, "RUB").Sub(money.New(1001, "RUB")); !got.IsNegative() || got.Amount != -1 {
+		t.Errorf("10.00 - 10.01 = %s, want -0.01 RUB", got)
+	}
+
+	cases := []struct {
+		minor  int64
+		factor float64
+		want   int64
+	}{
+		{100000, 1.5, 150000},
+		{100000, 0.9, 90000},
+		{105, 0.5, 53},   // 52.5 округляется от нуля
+		{-105, 0.5, -53}, // и для отрицательных
+		{333, 1.1, 366},  // 366.3
+		// Половина в десятичной записи множителя, хотя float64 0.3 и 0.95 чуть меньше
+		{5, 0.3, 2},
+		{10, 0.95, 10},
+		{-5, 0.3, -2},
+		{15, 0.1, 2},
+	}
+	for _, tc := range cases {
+		if got := money.New(tc.minor, "RUB").Mul(tc.factor); got.Amount != tc.want {
+			t.Errorf("%d * %v = %d, want %d", tc.minor, tc.factor, got.Amount, tc.want)
+		}
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("adding different currencies did not panic")
+		}
+	}()
+	money.New(1, "RUB").Add(money.New(1, "USD"))
+}
+
+func TestConvert(t *testing.T) {
+	cases := []struct {
+		from money.Money
+		rate float64
+		to   string
+		want money.Money
+	}{
+		{money.FromMajor(1000, "RUB"), 0.0105, "USD", money.New(1050, "USD")},
+		{money.New(1050, "USD"), 95.2381, "RUB", money.FromMajor(1000, "RUB")},
+		// Разное число знаков у валют: 12.34 USD * 150 = 1851 JPY
+		{money.New(1234, "USD"), 150, "JPY", money.New(1851, "JPY")},
+		{money.New(1851, "JPY"), 0.0067, "USD", money.New(1240, "USD")},
+		{money.New(-250, "EUR"), 1.1, "USD", money.New(-275, "USD")},
+	}
+	for _, tc := range cases {
+		if got := tc.from.Convert(tc.rate, tc.to); got != tc.want {
+			t.Errorf("%s * %v = %s, want %s", tc.from, tc.rate, got, tc.want)
+		}
+	}
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+	m := money.New(123450, "RUB")
+	data, err := json.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"amount":"1234.50","currency":"RUB"}` {
+		t.Errorf("Marshal = %s", data)
+	}
+	var got money.Money
+	if err := json.Unmarshal(data, &got); err != nil || got != m {
+		t.Errorf("Unmarshal = %v (%v), want %v", got, err, m)
+	}
+	// amount числом тоже разбирается точно, без float64
+	if err := json.Unmarshal([]byte(`{"amount":1234.5,"currency":"RUB"}`), &got); err != nil || got != m {
+		t.Errorf("Unmarshal number = %v (%v), want %v", got, err, m)
+	}
+}
+
+func TestScanAndValue(t *testing.T) {
+	m := money.Money{Currency: "JPY"}
+	if err := m.Scan([]byte("1500.00")); err != nil || m.Amount != 1500 {
+		t.Errorf("Scan JPY = %v (%v), want 1500 JPY", m, err)
+	}
+	m = money.Money{Currency: "RUB"}
+	if err := m.Scan([]byte("99.90")); err != nil || m.Amount != 9990 {
+		t.Errorf("Scan RUB = %v (%v), want 99.90 RUB", m, err)
+	}
+	if v, _ := m.Value(); v != "99.90" {
+		t.Errorf("Value = %v, want 99.90", v)
+	}
+
+	var env money.Money
+	if err := env.UnmarshalText([]byte("1000 RUB")); err != nil || env != money.FromMajor(1000, "RUB") {
+		t.Errorf("UnmarshalText = %v (%v), want 1000.00 RUB", env, err)
+	}
+}
+
+func TestCurrencyIsRequired(t *testing.T) {
+	var m money.Money
+	for _, text := range []string{"1000", "1000 rub", "1000 RUBL"} {
+		if err := m.UnmarshalText([]byte(text)); !errors.Is(err, money.ErrInvalidCurrency) {
+			t.Errorf("UnmarshalText(%q): %v, want ErrInvalidCurrency", text, err)
+		}
+	}
+	for _, data := range []string{`{"amount":"10.00"}`, `{"amount":"10.00","currency":"usd"}`} {
+		if err := json.Unmarshal([]byte(data), &m); !errors.Is(err, money.ErrInvalidCurrency) {
+			t.Errorf("Unmarshal(%s): %v, want ErrInvalidCurrency", data, err)
+		}
+	}
+}
+
+func TestOverflowPanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("overflowing Mul did not panic")
+		}
+	}()
+	money.New(math.MaxInt64/2, "RUB").Mul(3)
+}
@@ -0,0 +1,109 @@
+// Package quote - подписанные предложения цены: price-calcs выдаёт их клиенту, booking проверяет при бронировании,
+// поэтому бронируется именно та цена, которую видел пользователь
+package quote
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"otel-jaeger-learn/pkg/money"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrMalformed - токен не разбирается как предложение цены
+	ErrMalformed = errors.New("malformed quote")
+	// ErrBadSignature - токен подписан другим ключом или изменён
+	ErrBadSignature = errors.New("invalid quote signature")
+	// ErrExpired - срок действия предложения истёк
+	ErrExpired = errors.New("quote expired")
+)
+
+// Config - ключ подписи, встраивается в config.Config price-calcs и booking, ключ у них должен совпадать
+type Config struct {
+	Key string        `env:"QUOTE_KEY,required"`
+	TTL time.Duration `env:"QUOTE_TTL" envDefault:"15m"` // сколько действует предложение, нужен только price-calcs
+}
+
+// Quote - предложение цены водителя на время бронирования Time, действительное до ExpiresAt
+type Quote struct {
+	ID       string      `json:"quote_id"`
+	DriverID string      `json:"driver_id"`
+	Time     time.Time   `json:"time"`  // цена зависит от времени бронирования, бронировать можно только на него
+	Price    money.Money `json:"price"` // в валюте, запрошенной клиентом
+	// OriginalPrice - цена в валюте водителя, Rate - курс, по которому она переведена в Price (1 - без конвертации)
+	OriginalPrice money.Money `json:"original_price"`
+	Rate          float64     `json:"rate"`
+	ExpiresAt     time.Time   `json:"expires_at"`
+}
+
+// NewID возвращает случайный идентификатор предложения
+func NewID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err) // crypto/rand не возвращает ошибок на поддерживаемых платформах
+	}
+	return hex.EncodeToString(b)
+}
+
+// Signer подписывает и проверяет токены предложений HMAC-SHA256
+type Signer struct {
+	key []byte
+}
+
+func NewSigner(key string) (*Signer, error) {
+	if key == "" {
+		return nil, errors.New("empty quote key")
+	}
+	return &Signer{key: []byte(key)}, nil
+}
+
+// Sign возвращает токен предложения: base64url(JSON) "." base64url(HMAC)
+func (s *Signer) Sign(q Quote) (string, error) {
+	payload, err := json.Marshal(q)
+	if err != nil {
+		return "", err
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(s.mac(encoded)), nil
+}
+
+// Verify проверяет подпись токена и что на момент now предложение ещё действует
+func (s *Signer) Verify(token string, now time.Time) (Quote, error) {
+	var q Quote
+	encoded, sig, ok := strings.Cut(token, ".")
+	if !ok {
+		return q, ErrMalformed
+	}
+	gotMAC, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil {
+		return q, ErrMalformed
+	}
+	// Подпись проверяется до разбора, содержимое чужого токена не читаем
+	if !hmac.Equal(gotMAC, s.mac(encoded)) {
+		return q, ErrBadSignature
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return q, ErrMalformed
+	}
+	if err := json.Unmarshal(payload, &q); err != nil {
+		return q, fmt.Errorf("%w: %v", ErrMalformed, err)
+	}
+	if !now.Before(q.ExpiresAt) {
+		return q, fmt.Errorf("%w at %s", ErrExpired, q.ExpiresAt.Format(time.RFC3339))
+	}
+	return q, nil
+}
+
+func (s *Signer) mac(encoded string) []byte {
+	m := hmac.New(sha256.New, s.key)
+	m.Write([]byte(encoded))
+	return m.Sum(nil)
+}
@@ -0,0 +1,63 @@
+package quote_test
+
+import (
+	"errors"
+	"otel-jaeger-learn/pkg/money"
+	"otel-jaeger-learn/pkg/quote"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSignAndVerify(t *testing.T) {
+	signer, err := quote.NewSigner("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now().UTC().Truncate(time.Second)
+	q := quote.Quote{
+		ID: quote.NewID(), DriverID: "7", Time: now.Add(24 * time.Hour), Price: money.New(1050, "USD"),
+		OriginalPrice: money.FromMajor(1000, "RUB"), Rate: 0.0105, ExpiresAt: now.Add(time.Minute),
+	}
+	token, err := signer.Sign(q)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := signer.Verify(token, now)
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if got != q {
+		t.Errorf("Verify = %+v, want %+v", got, q)
+	}
+
+	if _, err := signer.Verify(token, now.Add(time.Minute)); !errors.Is(err, quote.ErrExpired) {
+		t.Errorf("Verify after expiry: %v, want ErrExpired", err)
+	}
+
+	other, _ := quote.NewSigner("other")
+	if _, err := other.Verify(token, now); !errors.Is(err, quote.ErrBadSignature) {
+		t.Errorf("Verify with other key: %v, want ErrBadSignature", err)
+	}
+
+	// Подмена цены в токене ломает подпись
+	forged, _ := signer.Sign(quote.Quote{ID: q.ID, DriverID: "7", Price: money.New(1, "RUB"), ExpiresAt: q.ExpiresAt})
+	payload, _, _ := strings.Cut(forged, ".")
+	_, sig, _ := strings.Cut(token, ".")
+	if _, err := signer.Verify(payload+"."+sig, now); !errors.Is(err, quote.ErrBadSignature) {
+		t.Errorf("Verify forged payload: %v, want ErrBadSignature", err)
+	}
+
+	for _, bad := range []string{"", "abc", "abc.!!!"} {
+		if _, err := signer.Verify(bad, now); !errors.Is(err, quote.ErrMalformed) {
+			t.Errorf("Verify(%q): %v, want ErrMalformed", bad, err)
+		}
+	}
+}
+
+func TestEmptyKeyIsRejected(t *testing.T) {
+	if _, err := quote.NewSigner(""); err == nil {
+		t.Error("NewSigner with empty key: want error")
+	}
+}
@@ -0,0 +1,35 @@
+package shedding
+
+import "time"
+
+// Config - настройки ограничения нагрузки, встраивается в config.Config каждого сервиса
+type Config struct {
+	Enabled bool `env:"SHEDDING_ENABLED" envDefault:"true"`
+	// Лимиты одновременных запросов по маршрутам, например "POST /bookings=50,GET /bookings/:id=100"
+	RouteLimits map[string]int `env:"SHEDDING_ROUTE_LIMITS" envKeyValSeparator:"="`
+
+	// Адаптивный лимит (AIMD) на весь сервис: растёт на 1, пока запросы быстрее TargetLatency,
+	// и умножается на Backoff, когда запрос медленнее или закончился по дедлайну
+	Adaptive      bool          `env:"SHEDDING_ADAPTIVE" envDefault:"true"`
+	InitialLimit  int           `env:"SHEDDING_INITIAL_LIMIT" envDefault:"50"`
+	MinLimit      int           `env:"SHEDDING_MIN_LIMIT" envDefault:"5"`
+	MaxLimit      int           `env:"SHEDDING_MAX_LIMIT" envDefault:"500"`
+	TargetLatency time.Duration `env:"SHEDDING_TARGET_LATENCY" envDefault:"500ms"`
+	Backoff       float64       `env:"SHEDDING_BACKOFF" envDefault:"0.9"`
+
+	RetryAfter time.Duration `env:"SHEDDING_RETRY_AFTER" envDefault:"1s"` // значение Retry-After в ответе 503
+}
+
+// DefaultConfig returns config with the same values as env defaults
+func DefaultConfig() Config {
+	return Config{
+		Enabled:       true,
+		Adaptive:      true,
+		InitialLimit:  50,
+		MinLimit:      5,
+		MaxLimit:      500,
+		TargetLatency: 500 * time.Millisecond,
+		Backoff:       0.9,
+		RetryAfter:    time.Second,
+	}
+}
@@ -0,0 +1,90 @@
+package shedding
+
+import (
+	"sync"
+	"time"
+)
+
+// bulkhead - фиксированный лимит одновременных запросов маршрута
+type bulkhead struct {
+	slots chan struct{}
+}
+
+func newBulkhead(limit int) *bulkhead {
+	return &bulkhead{slots: make(chan struct{}, limit)}
+}
+
+func (b *bulkhead) tryAcquire() bool {
+	select {
+	case b.slots <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+func (b *bulkhead) release() {
+	<-b.slots
+}
+
+func (b *bulkhead) inflight() int {
+	return len(b.slots)
+}
+
+// aimdLimiter - адаптивный лимит одновременных запросов (additive increase, multiplicative decrease).
+// Лимит растёт, только когда он почти исчерпан, иначе при малой нагрузке он бы рос бесконечно.
+type aimdLimiter struct {
+	minLimit      float64
+	maxLimit      float64
+	targetLatency time.Duration
+	backoff       float64
+
+	mu       sync.Mutex
+	limit    float64
+	inflight int
+}
+
+func newAIMDLimiter(cfg Config) *aimdLimiter {
+	l := &aimdLimiter{
+		minLimit:      float64(max(cfg.MinLimit, 1)),
+		maxLimit:      float64(max(cfg.MaxLimit, cfg.MinLimit, 1)),
+		targetLatency: cfg.TargetLatency,
+		backoff:       cfg.Backoff,
+		limit:         float64(cfg.InitialLimit),
+	}
+	if l.backoff <= 0 || l.backoff >= 1 {
+		l.backoff = DefaultConfig().Backoff
+	}
+	l.limit = min(max(l.limit, l.minLimit), l.maxLimit)
+	return l
+}
+
+func (l *aimdLimiter) tryAcquire() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.inflight >= int(l.limit) {
+		return false
+	}
+	l.inflight++
+	return true
+}
+
+// release returns slot and adjusts limit by the request result, overloaded is true if request
+// was slower than target latency or ran out of its deadline
+func (l *aimdLimiter) release(latency time.Duration, overloaded bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if overloaded || (l.targetLatency > 0 && latency > l.targetLatency) {
+		l.limit = max(l.limit*l.backoff, l.minLimit)
+	} else if float64(l.inflight)*2 >= l.limit {
+		l.limit = min(l.limit+1, l.maxLimit)
+	}
+	l.inflight--
+}
+
+func (l *aimdLimiter) state() (limit, inflight int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return int(l.limit), l.inflight
+}
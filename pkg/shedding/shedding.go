@@ -0,0 +1,169 @@
+// Package shedding ограничивает число одновременных запросов к сервису: фиксированными лимитами
+// по маршрутам (bulkhead) и адаптивным лимитом на весь сервис. Лишние запросы сразу получают
+// 503 с Retry-After, а не копятся в горутинах в ожидании перегруженной базы.
+package shedding
+
+import (
+	"context"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+	"math"
+	"net/http"
+	"otel-jaeger-learn/pkg/tracing"
+	"strconv"
+	"time"
+)
+
+const meterName = "otel-jaeger-learn/pkg/shedding"
+
+// Причины отказа, пишутся в span и метрики
+const (
+	reasonRouteLimit    = "route_limit"
+	reasonAdaptiveLimit = "adaptive_limit"
+)
+
+type Shedder struct {
+	cfg       Config
+	bulkheads map[string]*bulkhead // ключ - "METHOD /route/:param"
+	adaptive  *aimdLimiter
+
+	requests metric.Int64Counter
+}
+
+func New(cfg Config) (*Shedder, error) {
+	s := &Shedder{cfg: cfg, bulkheads: make(map[string]*bulkhead, len(cfg.RouteLimits))}
+	for route, limit := range cfg.RouteLimits {
+		if limit <= 0 {
+			return nil, fmt.Errorf("shedding limit of %q must be positive, got %d", route, limit)
+		}
+		s.bulkheads[route] = newBulkhead(limit)
+	}
+	if cfg.Adaptive {
+		s.adaptive = newAIMDLimiter(cfg)
+	}
+	if err := s.initMetrics(); err != nil {
+		return nil, fmt.Errorf("could not set up shedding metrics: %v", err)
+	}
+	return s, nil
+}
+
+// AddMiddleware creates Shedder and adds its middleware to the router. Routes registered before it
+// (e.g. /metrics and /debug/tracing) are not limited. It must be added after tracing.AddOtelMiddleware
+// so shed requests are recorded on the server span.
+func AddMiddleware(r *gin.Engine, cfg Config) error {
+	if !cfg.Enabled {
+		return nil
+	}
+	s, err := New(cfg)
+	if err != nil {
+		return err
+	}
+	r.Use(s.Middleware())
+	return nil
+}
+
+func (s *Shedder) initMetrics() error {
+	meter := otel.Meter(meterName)
+
+	var err error
+	s.requests, err = meter.Int64Counter("shedding.requests",
+		metric.WithDescription("Requests that passed through the load shedder, by decision"))
+	if err != nil {
+		return err
+	}
+
+	_, err = meter.Int64ObservableGauge("shedding.limit",
+		metric.WithDescription("Current concurrency limit: adaptive for the service, fixed for routes"),
+		metric.WithInt64Callback(func(_ context.Context, o metric.Int64Observer) error {
+			if s.adaptive != nil {
+				limit, _ := s.adaptive.state()
+				o.Observe(int64(limit), metric.WithAttributes(attribute.String("limiter", reasonAdaptiveLimit)))
+			}
+			for route, b := range s.bulkheads {
+				o.Observe(int64(cap(b.slots)), metric.WithAttributes(
+					attribute.String("limiter", reasonRouteLimit), attribute.String("http.route", route)))
+			}
+			return nil
+		}))
+	if err != nil {
+		return err
+	}
+
+	_, err = meter.Int64ObservableGauge("shedding.inflight",
+		metric.WithDescription("Requests being processed, as counted by the limiter"),
+		metric.WithInt64Callback(func(_ context.Context, o metric.Int64Observer) error {
+			if s.adaptive != nil {
+				_, inflight := s.adaptive.state()
+				o.Observe(int64(inflight), metric.WithAttributes(attribute.String("limiter", reasonAdaptiveLimit)))
+			}
+			for route, b := range s.bulkheads {
+				o.Observe(int64(b.inflight()), metric.WithAttributes(
+					attribute.String("limiter", reasonRouteLimit), attribute.String("http.route", route)))
+			}
+			return nil
+		}))
+	return err
+}
+
+func (s *Shedder) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		route := c.FullPath()
+		if route == "" {
+			// Несуществующий маршрут, gin ответит 404
+			c.Next()
+			return
+		}
+		route = c.Request.Method + " " + route
+		ctx := c.Request.Context()
+
+		if b, ok := s.bulkheads[route]; ok {
+			if !b.tryAcquire() {
+				s.reject(c, route, reasonRouteLimit, cap(b.slots), b.inflight())
+				return
+			}
+			defer b.release()
+		}
+
+		if s.adaptive != nil {
+			if !s.adaptive.tryAcquire() {
+				limit, inflight := s.adaptive.state()
+				s.reject(c, route, reasonAdaptiveLimit, limit, inflight)
+				return
+			}
+			start := time.Now()
+			defer func() {
+				// 504 значит, что запрос не уложился в дедлайн - это такой же признак перегрузки, как задержка
+				s.adaptive.release(time.Since(start), c.Writer.Status() == http.StatusGatewayTimeout)
+			}()
+		}
+
+		s.requests.Add(ctx, 1, metric.WithAttributes(
+			attribute.String("http.route", route), attribute.String("decision", "accepted")))
+		c.Next()
+	}
+}
+
+func (s *Shedder) reject(c *gin.Context, route, reason string, limit, inflight int) {
+	ctx := c.Request.Context()
+
+	span := trace.SpanFromContext(ctx)
+	span.SetAttributes(attribute.String("shedding.decision", "rejected"))
+	span.AddEvent("request shed", trace.WithAttributes(
+		attribute.String("shedding.reason", reason),
+		attribute.Int("shedding.limit", limit),
+		attribute.Int("shedding.inflight", inflight),
+	))
+	s.requests.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("http.route", route),
+		attribute.String("decision", "rejected"),
+		attribute.String("reason", reason),
+	))
+
+	retryAfter := int(math.Ceil(s.cfg.RetryAfter.Seconds()))
+	c.Header("Retry-After", strconv.Itoa(max(retryAfter, 1)))
+	c.AbortWithStatusJSON(http.StatusServiceUnavailable, tracing.ErrorBody(ctx, "service is overloaded, retry later"))
+}
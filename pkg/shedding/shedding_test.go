@@ -0,0 +1,154 @@
+package shedding_test
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"net/http/httptest"
+	"otel-jaeger-learn/pkg/shedding"
+	"otel-jaeger-learn/pkg/tracing"
+	"otel-jaeger-learn/pkg/tracing/tracingtest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// gate держит запросы к /slow, пока не вызван open
+type gate struct {
+	started chan struct{}
+
+	mu      sync.Mutex
+	release chan struct{}
+}
+
+func newGate() *gate {
+	return &gate{started: make(chan struct{}), release: make(chan struct{})}
+}
+
+func (g *gate) wait() {
+	g.mu.Lock()
+	release := g.release
+	g.mu.Unlock()
+	<-release
+}
+
+// open отпускает все ждущие запросы, следующие снова будут ждать
+func (g *gate) open() {
+	g.mu.Lock()
+	close(g.release)
+	g.release = make(chan struct{})
+	g.mu.Unlock()
+}
+
+// newRouter регистрирует GET /slow, который ждёт gate, и GET /fast
+func newRouter(t *testing.T, cfg shedding.Config, g *gate) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	tracing.AddOtelMiddleware(router, "test")
+	if err := shedding.AddMiddleware(router, cfg); err != nil {
+		t.Fatal(err)
+	}
+	router.GET("/slow", func(c *gin.Context) {
+		g.started <- struct{}{}
+		g.wait()
+		c.Status(http.StatusOK)
+	})
+	router.GET("/fast", func(c *gin.Context) { c.Status(http.StatusOK) })
+	return router
+}
+
+func get(router http.Handler, path string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+	return w
+}
+
+// fill занимает n слотов запросами к /slow и ждёт, пока они начнут выполняться
+func fill(router http.Handler, n int, g *gate) *sync.WaitGroup {
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			get(router, "/slow")
+		}()
+		<-g.started
+	}
+	return &wg
+}
+
+func TestRouteLimit(t *testing.T) {
+	rec := tracingtest.Install(t)
+	cfg := shedding.DefaultConfig()
+	cfg.Adaptive = false
+	cfg.RouteLimits = map[string]int{"GET /slow": 2}
+
+	g := newGate()
+	router := newRouter(t, cfg, g)
+	wg := fill(router, 2, g)
+
+	w := get(router, "/slow")
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("third request status = %d, want 503", w.Code)
+	}
+	if w.Header().Get("Retry-After") != "1" {
+		t.Errorf("Retry-After = %q, want 1", w.Header().Get("Retry-After"))
+	}
+	// Лимит одного маршрута не задевает другие
+	if w := get(router, "/fast"); w.Code != http.StatusOK {
+		t.Errorf("/fast status = %d, want 200", w.Code)
+	}
+
+	g.open()
+	wg.Wait()
+
+	var shed int
+	for _, span := range rec.SpansByName("/slow") {
+		if _, ok := span.Event("request shed"); ok {
+			shed++
+			rec.AssertAttribute(span, "shedding.decision", "rejected")
+		}
+	}
+	if shed != 1 {
+		t.Errorf("%d spans with shed event, want 1", shed)
+	}
+
+	// Слоты освобождены, оба запроса снова проходят
+	wg = fill(router, 2, g)
+	g.open()
+	wg.Wait()
+}
+
+func TestAdaptiveLimitDecreasesOnSlowRequests(t *testing.T) {
+	tracingtest.Install(t)
+	cfg := shedding.DefaultConfig()
+	cfg.InitialLimit = 4
+	cfg.MinLimit = 1
+	cfg.Backoff = 0.5
+	cfg.TargetLatency = 10 * time.Millisecond
+
+	g := newGate()
+	router := newRouter(t, cfg, g)
+
+	// 4 медленных запроса укладываются в начальный лимит, пятый - уже нет
+	wg := fill(router, 4, g)
+	if w := get(router, "/fast"); w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("request over adaptive limit status = %d, want 503", w.Code)
+	}
+	time.Sleep(2 * cfg.TargetLatency)
+	g.open()
+	wg.Wait()
+
+	// Медленные запросы уменьшили лимит до 1: второй одновременный запрос отклоняется
+	wg = fill(router, 1, g)
+	if w := get(router, "/fast"); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("request after backoff status = %d, want 503", w.Code)
+	}
+	g.open()
+	wg.Wait()
+
+	// Быстрые запросы снова проходят
+	if w := get(router, "/fast"); w.Code != http.StatusOK {
+		t.Errorf("fast request status = %d, want 200", w.Code)
+	}
+}
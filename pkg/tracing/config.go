@@ -1,5 +1,29 @@
 package tracing
 
+import (
+	"errors"
+	"time"
+)
+
 type Config struct {
-	TempoAddr string `env:"TEMPO_ADDR,required"`
+	TempoAddr     string        `env:"TEMPO_ADDR,required"`
+	LeakDetectAge time.Duration `env:"TRACING_LEAK_DETECT_AGE"`                        // если задано - span'ы старше этого возраста без End() попадут в лог
+	SpoolDir      string        `env:"TRACING_SPOOL_DIR"`                              // если задано - неотправленные батчи буферизуются на диске
+	SpoolMaxBytes int64         `env:"TRACING_SPOOL_MAX_BYTES" envDefault:"104857600"` // должен быть положительным, если задан TRACING_SPOOL_DIR
+	SamplingRatio float64       `env:"TRACING_SAMPLING_RATIO" envDefault:"1"`          // доля трейсов, если правила не заданы файлом или URL
+	SamplingFile  string        `env:"TRACING_SAMPLING_FILE"`                          // JSON с SamplingRules, перечитывается при изменении
+	SamplingURL   string        `env:"TRACING_SAMPLING_URL"`                           // Jaeger-совместимый эндпоинт удалённого сэмплирования, не вместе с файлом
+	SamplingPoll  time.Duration `env:"TRACING_SAMPLING_POLL" envDefault:"30s"`
+}
+
+// Validate проверяет сочетания настроек, которые нельзя описать тегами env
+func (c Config) Validate() error {
+	if c.SpoolDir != "" && c.SpoolMaxBytes <= 0 {
+		return errors.New("TRACING_SPOOL_MAX_BYTES must be positive when TRACING_SPOOL_DIR is set")
+	}
+	// Правила из файла затирались бы ответами эндпоинта и наоборот
+	if c.SamplingFile != "" && c.SamplingURL != "" {
+		return errors.New("only one of TRACING_SAMPLING_FILE and TRACING_SAMPLING_URL can be set")
+	}
+	return nil
 }
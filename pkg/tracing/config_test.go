@@ -0,0 +1,28 @@
+package tracing_test
+
+import (
+	"otel-jaeger-learn/pkg/tracing"
+	"testing"
+)
+
+func TestConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     tracing.Config
+		wantErr bool
+	}{
+		{"defaults", tracing.Config{SpoolMaxBytes: 100}, false},
+		{"spool", tracing.Config{SpoolDir: "/tmp/spool", SpoolMaxBytes: 100}, false},
+		{"spool without limit", tracing.Config{SpoolDir: "/tmp/spool"}, true},
+		{"negative spool limit", tracing.Config{SpoolDir: "/tmp/spool", SpoolMaxBytes: -1}, true},
+		{"limit without spool", tracing.Config{SpoolMaxBytes: 0}, false},
+		{"sampling file", tracing.Config{SamplingFile: "sampling.json"}, false},
+		{"sampling url", tracing.Config{SamplingURL: "http://jaeger:5778/sampling"}, false},
+		{"sampling file and url", tracing.Config{SamplingFile: "sampling.json", SamplingURL: "http://jaeger:5778/sampling"}, true},
+	}
+	for _, tt := range tests {
+		if err := tt.cfg.Validate(); (err != nil) != tt.wantErr {
+			t.Errorf("%s: Validate() = %v, want error %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// BudgetHeader - сколько миллисекунд осталось у запроса, передаётся в каждый следующий сервис
+const BudgetHeader = "X-Request-Budget-Ms"
+
+// MiddlewareOption настраивает middleware, добавляемые AddOtelMiddleware
+type MiddlewareOption func(*middlewareOptions)
+
+type middlewareOptions struct {
+	requestBudget time.Duration
+}
+
+// WithRequestBudget sets deadline for requests that come without BudgetHeader, i.e. to the entry service.
+// Incoming budget is also capped by it, so clients can not extend it.
+func WithRequestBudget(budget time.Duration) MiddlewareOption {
+	return func(o *middlewareOptions) { o.requestBudget = budget }
+}
+
+// deadlineMiddleware применяет бюджет запроса из BudgetHeader (или бюджет по умолчанию) как дедлайн контекста
+// и записывает в серверный span, сколько бюджета было и сколько израсходовано на этом шаге
+func deadlineMiddleware(defaultBudget time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		budget, ok := parseBudget(c.GetHeader(BudgetHeader))
+		if defaultBudget > 0 && (!ok || budget > defaultBudget) {
+			budget, ok = defaultBudget, true
+		}
+		if !ok {
+			c.Next()
+			return
+		}
+
+		ctx := c.Request.Context()
+		span := trace.SpanFromContext(ctx)
+		span.SetAttributes(attribute.Int64("request.budget_ms", budget.Milliseconds()))
+
+		if budget <= 0 {
+			span.AddEvent("request budget exhausted before processing")
+			c.AbortWithStatusJSON(http.StatusGatewayTimeout, ErrorBody(ctx, "request budget exhausted"))
+			return
+		}
+
+		ctx, cancel := context.WithDeadline(ctx, start.Add(budget))
+		defer cancel()
+		c.Request = c.Request.WithContext(ctx)
+
+		c.Next()
+
+		consumed := time.Since(start)
+		span.SetAttributes(
+			attribute.Int64("request.budget_consumed_ms", consumed.Milliseconds()),
+			attribute.Int64("request.budget_remaining_ms", (budget-consumed).Milliseconds()),
+		)
+	}
+}
+
+func parseBudget(header string) (time.Duration, bool) {
+	if header == "" {
+		return 0, false
+	}
+	ms, err := strconv.ParseInt(header, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return time.Duration(ms) * time.Millisecond, true
+}
+
+// deadlineTransport передаёт оставшееся до дедлайна контекста время в BudgetHeader
+type deadlineTransport struct {
+	base http.RoundTripper
+}
+
+func (t deadlineTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	deadline, ok := req.Context().Deadline()
+	if !ok {
+		return t.base.RoundTrip(req)
+	}
+	remaining := time.Until(deadline).Milliseconds()
+	if remaining < 0 {
+		remaining = 0
+	}
+	// RoundTripper не должен менять исходный запрос
+	req = req.Clone(req.Context())
+	req.Header.Set(BudgetHeader, strconv.FormatInt(remaining, 10))
+	return t.base.RoundTrip(req)
+}
+
+// ErrorStatus returns 504 if deadline of the request ctx has passed, so the error is caused by exhausted budget,
+// otherwise it returns status
+func ErrorStatus(ctx context.Context, status int) int {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return http.StatusGatewayTimeout
+	}
+	return status
+}
@@ -0,0 +1,80 @@
+package tracing
+
+import (
+	"context"
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/baggage"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"strings"
+)
+
+const (
+	// DebugHeader - заголовок, которым поддержка включает полную трассировку и debug логи одного запроса
+	DebugHeader = "X-Debug-Trace"
+	// DebugBaggageKey - ключ baggage, с которым режим отладки передаётся по всей цепочке сервисов
+	DebugBaggageKey = "debug"
+
+	baggageHeader = "baggage"
+)
+
+// IsDebugTrace reports whether debug mode is enabled in baggage of ctx
+func IsDebugTrace(ctx context.Context) bool {
+	return isTruthy(baggage.FromContext(ctx).Member(DebugBaggageKey).Value())
+}
+
+// AddDebugHeaderMiddleware converts DebugHeader of incoming requests to debug baggage.
+// It must be added before AddOtelMiddleware, so the baggage is already there when the server span is sampled.
+func AddDebugHeaderMiddleware(r *gin.Engine) {
+	r.Use(func(c *gin.Context) {
+		if !isTruthy(c.GetHeader(DebugHeader)) {
+			c.Next()
+			return
+		}
+
+		// otelgin достаёт baggage из заголовков запроса, поэтому добавляем флаг прямо в заголовок
+		member, err := baggage.NewMember(DebugBaggageKey, "1")
+		if err == nil {
+			bag, _ := baggage.Parse(c.GetHeader(baggageHeader))
+			if bag, err = bag.SetMember(member); err == nil {
+				c.Request.Header.Set(baggageHeader, bag.String())
+			}
+		}
+		c.Next()
+	})
+}
+
+func isTruthy(value string) bool {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "1", "true", "yes", "on":
+		return true
+	}
+	return false
+}
+
+// debugSampler сэмплирует все трейсы в режиме отладки, остальные решения отдаёт root
+type debugSampler struct {
+	root sdktrace.Sampler
+}
+
+// NewDebugSampler returns sampler that always samples traces with debug baggage
+// (see IsDebugTrace) and delegates other decisions to root
+func NewDebugSampler(root sdktrace.Sampler) sdktrace.Sampler {
+	return debugSampler{root: root}
+}
+
+func (s debugSampler) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	if !IsDebugTrace(p.ParentContext) {
+		return s.root.ShouldSample(p)
+	}
+	return sdktrace.SamplingResult{
+		Decision:   sdktrace.RecordAndSample,
+		Attributes: []attribute.KeyValue{attribute.Bool("debug.trace", true)},
+		Tracestate: trace.SpanContextFromContext(p.ParentContext).TraceState(),
+	}
+}
+
+func (s debugSampler) Description() string {
+	return "DebugSampler{" + s.root.Description() + "}"
+}
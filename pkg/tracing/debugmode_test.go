@@ -0,0 +1,95 @@
+package tracing_test
+
+import (
+	"bytes"
+	"context"
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"otel-jaeger-learn/pkg/logging"
+	"otel-jaeger-learn/pkg/tracing"
+	"strings"
+	"testing"
+)
+
+func debugContext(t *testing.T) context.Context {
+	t.Helper()
+	member, err := baggage.NewMember(tracing.DebugBaggageKey, "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bag, err := baggage.New(member)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return baggage.ContextWithBaggage(context.Background(), bag)
+}
+
+func TestDebugHeaderMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	tracing.AddDebugHeaderMiddleware(router)
+
+	var debug bool
+	router.GET("/", func(c *gin.Context) {
+		ctx := propagation.Baggage{}.Extract(c.Request.Context(), propagation.HeaderCarrier(c.Request.Header))
+		debug = tracing.IsDebugTrace(ctx)
+		if got := baggage.FromContext(ctx).Member("tenant").Value(); got != "acme" {
+			t.Errorf("existing baggage member lost, tenant = %q", got)
+		}
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(tracing.DebugHeader, "1")
+	req.Header.Set("baggage", "tenant=acme")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+	if !debug {
+		t.Error("debug header was not converted to baggage")
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("baggage", "tenant=acme")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+	if debug {
+		t.Error("debug mode enabled without header")
+	}
+}
+
+func TestDebugSampler(t *testing.T) {
+	sampler := tracing.NewDebugSampler(sdktrace.NeverSample())
+
+	result := sampler.ShouldSample(sdktrace.SamplingParameters{ParentContext: debugContext(t), Name: "/bookings"})
+	if result.Decision != sdktrace.RecordAndSample {
+		t.Errorf("debug trace: decision = %v, want RecordAndSample", result.Decision)
+	}
+
+	result = sampler.ShouldSample(sdktrace.SamplingParameters{ParentContext: context.Background(), Name: "/bookings"})
+	if result.Decision != sdktrace.Drop {
+		t.Errorf("regular trace: decision = %v, want Drop", result.Decision)
+	}
+}
+
+func TestDebugLogs(t *testing.T) {
+	logging.SetDebugContextFunc(tracing.IsDebugTrace)
+	defer logging.SetDebugContextFunc(nil)
+
+	var out bytes.Buffer
+	handler := logging.NewContextLevelHandler(
+		slog.NewTextHandler(&out, &slog.HandlerOptions{Level: slog.LevelDebug}), slog.LevelInfo)
+	defer func(prev *slog.Logger) { slog.SetDefault(prev) }(slog.Default())
+	slog.SetDefault(slog.New(handler))
+
+	tracing.TraceLogger(context.Background()).Debug("regular request")
+	tracing.TraceLogger(debugContext(t)).Debug("debug request")
+
+	if strings.Contains(out.String(), "regular request") {
+		t.Error("debug record written without debug mode")
+	}
+	if !strings.Contains(out.String(), "debug request") {
+		t.Error("debug record not written in debug mode")
+	}
+}
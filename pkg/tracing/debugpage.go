@@ -0,0 +1,143 @@
+package tracing
+
+import (
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	"html/template"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// debugState - то, что показывает /debug/tracing, заполняется в InitTracer
+var debugState struct {
+	serviceName string
+	endpoint    string
+	sampler     interface{ Description() string }
+	telemetry   *exporterTelemetry
+	spanz       *spanzProcessor
+}
+
+// AddDebugRoutes registers /metrics and /debug/tracing, the latter is similar to OpenCensus zPages
+func AddDebugRoutes(r gin.IRouter) {
+	r.GET("/metrics", gin.WrapH(MetricsHandler()))
+	r.GET("/debug/tracing", debugTracingPage)
+}
+
+// isDebugPath - служебные пути, запросы к которым не трассируются
+func isDebugPath(path string) bool {
+	return path == "/metrics" || strings.HasPrefix(path, "/debug/")
+}
+
+type debugPageData struct {
+	Service     string
+	Endpoint    string
+	Sampler     string
+	Propagators []string
+	Exporter    *ExporterStats
+	Spool       *SpoolStats
+	Inflight    []SpanSummary
+	Forgotten   int64 // незавершённых span'ов не показано из-за лимита
+	Recent      []SpanSummary
+	Now         time.Time
+}
+
+func debugTracingPage(c *gin.Context) {
+	data := debugPageData{
+		Service:     debugState.serviceName,
+		Endpoint:    debugState.endpoint,
+		Propagators: otel.GetTextMapPropagator().Fields(),
+		Now:         time.Now(),
+	}
+	if debugState.sampler != nil {
+		data.Sampler = debugState.sampler.Description()
+	}
+	if debugState.telemetry != nil {
+		stats := debugState.telemetry.Stats()
+		data.Exporter = &stats
+	}
+	if stats, ok := GetSpoolStats(); ok {
+		data.Spool = &stats
+	}
+	if debugState.spanz != nil {
+		data.Inflight = debugState.spanz.Inflight()
+		data.Forgotten = debugState.spanz.Forgotten()
+		data.Recent = debugState.spanz.Recent()
+	}
+
+	c.Status(http.StatusOK)
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	if err := debugPageTemplate.Execute(c.Writer, data); err != nil {
+		_ = c.Error(err)
+	}
+}
+
+var debugPageTemplate = template.Must(template.New("debug").Funcs(template.FuncMap{
+	"ms": func(d time.Duration) string { return d.Round(time.Microsecond).String() },
+	"ts": func(t time.Time) string {
+		if t.IsZero() {
+			return "never"
+		}
+		return t.Format(time.RFC3339Nano)
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<title>{{.Service}} - tracing</title>
+<style>
+body { font-family: monospace; margin: 20px; }
+table { border-collapse: collapse; margin-bottom: 20px; }
+td, th { border: 1px solid #ccc; padding: 4px 8px; text-align: left; }
+.error { color: #c00; }
+</style>
+</head>
+<body>
+<h1>{{.Service}} tracing</h1>
+<p>{{ts .Now}}</p>
+
+<h2>Configuration</h2>
+<table>
+<tr><th>Exporter endpoint</th><td>{{.Endpoint}}</td></tr>
+<tr><th>Sampler</th><td>{{.Sampler}}</td></tr>
+<tr><th>Propagators</th><td>{{range .Propagators}}{{.}} {{end}}</td></tr>
+</table>
+
+<h2>Exporter health</h2>
+{{with .Exporter}}
+<table>
+<tr><th>Queue length (approx.)</th><td>{{.QueueLength}}</td></tr>
+<tr><th>Exported spans</th><td>{{.Exported}}</td></tr>
+<tr><th>Failed spans</th><td>{{.Failed}}</td></tr>
+<tr><th>Dropped spans (estimate)</th><td>{{.DroppedEstimate}}</td></tr>
+<tr><th>Last export</th><td>{{ts .LastExport}} ({{ms .LastLatency}})</td></tr>
+<tr><th>Last error</th><td class="error">{{ts .LastErrorTime}} {{.LastError}}</td></tr>
+</table>
+{{else}}<p>tracer is not initialized</p>{{end}}
+
+{{with .Spool}}
+<h2>Disk spool</h2>
+<table>
+<tr><th>Queued spans</th><td>{{.Queued}}</td></tr>
+<tr><th>Sent spans</th><td>{{.Sent}}</td></tr>
+<tr><th>Dropped spans</th><td>{{.Dropped}}</td></tr>
+<tr><th>Size, bytes</th><td>{{.Bytes}}</td></tr>
+</table>
+{{end}}
+
+<h2>In-flight spans ({{len .Inflight}})</h2>
+{{if .Forgotten}}<p>{{.Forgotten}} older spans that were never ended are not shown</p>{{end}}
+<table>
+<tr><th>Name</th><th>Trace ID</th><th>Span ID</th><th>Started</th><th>Running for</th></tr>
+{{range .Inflight}}<tr><td>{{.Name}}</td><td>{{.TraceID}}</td><td>{{.SpanID}}</td><td>{{ts .Start}}</td><td>{{ms .Duration}}</td></tr>
+{{end}}
+</table>
+
+<h2>Recent spans ({{len .Recent}})</h2>
+<table>
+<tr><th>Name</th><th>Trace ID</th><th>Span ID</th><th>Started</th><th>Duration</th><th>Status</th></tr>
+{{range .Recent}}<tr><td>{{.Name}}</td><td>{{.TraceID}}</td><td>{{.SpanID}}</td><td>{{ts .Start}}</td><td>{{ms .Duration}}</td><td{{if eq .Status 1}} class="error"{{end}}>{{.Status}} {{.Message}}</td></tr>
+{{end}}
+</table>
+</body>
+</html>
+`))
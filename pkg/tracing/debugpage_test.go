@@ -0,0 +1,90 @@
+package tracing
+
+import (
+	"context"
+	"github.com/gin-gonic/gin"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDebugTracingPage(t *testing.T) {
+	saved := debugState
+	t.Cleanup(func() { debugState = saved })
+
+	telemetry := newTelemetry(t)
+	spanz := newSpanzProcessor()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spanz),
+		sdktrace.WithSpanProcessor(telemetry.wrapProcessor(sdktrace.NewSimpleSpanProcessor(telemetry.wrapExporter(&stubExporter{})))))
+	endSpans(tp, "ended span")
+	_, running := tp.Tracer("test").Start(context.Background(), "running span")
+	defer running.End()
+
+	debugState.serviceName = "booking"
+	debugState.endpoint = "tempo:4318"
+	debugState.sampler = sdktrace.AlwaysSample()
+	debugState.telemetry = telemetry
+	debugState.spanz = spanz
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	AddDebugRoutes(router)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/tracing", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", rec.Code)
+	}
+	page := rec.Body.String()
+	for _, want := range []string{
+		"<h1>booking tracing</h1>",
+		"<td>tempo:4318</td>",
+		"<td>AlwaysOnSampler</td>",
+		"<tr><th>Exported spans</th><td>1</td></tr>",
+		"<tr><th>Dropped spans (estimate)</th><td>0</td></tr>",
+		"In-flight spans (1)",
+		"<td>running span</td>",
+		"Recent spans (1)",
+		"<td>ended span</td>",
+	} {
+		if !strings.Contains(page, want) {
+			t.Errorf("page does not contain %q", want)
+		}
+	}
+	// Без спула его раздела нет
+	if strings.Contains(page, "Disk spool") {
+		t.Error("page shows disk spool while spooling is disabled")
+	}
+}
+
+func TestDebugTracingPageBeforeInit(t *testing.T) {
+	saved := debugState
+	t.Cleanup(func() { debugState = saved })
+	debugState.telemetry = nil
+	debugState.spanz = nil
+	debugState.sampler = nil
+
+	rec := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(rec)
+	c.Request = httptest.NewRequest(http.MethodGet, "/debug/tracing", nil)
+	debugTracingPage(c)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "tracer is not initialized") {
+		t.Errorf("status = %d, body %q, want page saying tracer is not initialized", rec.Code, rec.Body)
+	}
+}
+
+func TestIsDebugPath(t *testing.T) {
+	for path, want := range map[string]bool{
+		"/metrics":        true,
+		"/debug/tracing":  true,
+		"/debug/pprof/":   true,
+		"/bookings":       false,
+		"/metrics/custom": false,
+		"/debugging":      false,
+	} {
+		if got := isDebugPath(path); got != want {
+			t.Errorf("isDebugPath(%q) = %v, want %v", path, got, want)
+		}
+	}
+}
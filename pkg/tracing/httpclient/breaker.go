@@ -0,0 +1,112 @@
+package httpclient
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen возвращается без отправки запроса, пока breaker хоста разомкнут
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+type breakerState int
+
+const (
+	stateClosed breakerState = iota
+	stateHalfOpen
+	stateOpen
+)
+
+func (s breakerState) String() string {
+	switch s {
+	case stateClosed:
+		return "closed"
+	case stateHalfOpen:
+		return "half-open"
+	default:
+		return "open"
+	}
+}
+
+// breaker - circuit breaker одного хоста. После failures ошибок подряд размыкается на cooldown,
+// затем пропускает один пробный запрос: успех замыкает его, ошибка снова размыкает.
+type breaker struct {
+	failures int
+	cooldown time.Duration
+
+	mu          sync.Mutex
+	state       breakerState
+	consecutive int
+	openedAt    time.Time
+	probing     bool
+}
+
+func newBreaker(failures int, cooldown time.Duration) *breaker {
+	return &breaker{failures: failures, cooldown: cooldown}
+}
+
+// allow returns ErrCircuitOpen if request must not be sent, and state transition if it happened
+func (b *breaker) allow() (from, to breakerState, err error) {
+	if b.failures <= 0 {
+		return stateClosed, stateClosed, nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	from = b.state
+	switch b.state {
+	case stateOpen:
+		if time.Since(b.openedAt) < b.cooldown {
+			return from, from, ErrCircuitOpen
+		}
+		b.state = stateHalfOpen
+		b.probing = true
+	case stateHalfOpen:
+		if b.probing {
+			return from, from, ErrCircuitOpen
+		}
+		b.probing = true
+	}
+	return from, b.state, nil
+}
+
+// record saves result of the request allowed by allow and returns state transition
+func (b *breaker) record(success bool) (from, to breakerState) {
+	if b.failures <= 0 {
+		return stateClosed, stateClosed
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	from = b.state
+	b.probing = false
+	switch {
+	case success:
+		b.state = stateClosed
+		b.consecutive = 0
+	case b.state == stateHalfOpen:
+		b.state = stateOpen
+		b.openedAt = time.Now()
+	default:
+		b.consecutive++
+		if b.consecutive >= b.failures {
+			b.state = stateOpen
+			b.openedAt = time.Now()
+			b.consecutive = 0
+		}
+	}
+	return from, b.state
+}
+
+func (b *breaker) currentState() breakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// release frees the probe slot of the request that finished without result, e.g. cancelled by caller
+func (b *breaker) release() {
+	b.mu.Lock()
+	b.probing = false
+	b.mu.Unlock()
+}
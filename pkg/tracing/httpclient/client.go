@@ -0,0 +1,318 @@
+// Package httpclient - HTTP клиент для вызовов между сервисами: трейс и X-Request-ID в заголовках,
+// таймауты, повторы идемпотентных запросов с экспоненциальной задержкой и circuit breaker на хост.
+// Каждая попытка - отдельный дочерний span otelhttp, повторы и переключения breaker'а - события
+// span'а вызывающего кода и метрики.
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+	"io"
+	"math/rand"
+	"net/http"
+	"otel-jaeger-learn/pkg/tracing"
+	"sync"
+	"time"
+)
+
+const meterName = "otel-jaeger-learn/pkg/tracing/httpclient"
+
+// Client безопасен для использования из нескольких горутин, создаётся один на сервис
+type Client struct {
+	cfg  Config
+	http *http.Client
+
+	mu       sync.Mutex
+	breakers map[string]*breaker
+
+	retries     metric.Int64Counter
+	transitions metric.Int64Counter
+}
+
+// CallOption переопределяет настройки Config для одного вызова
+type CallOption func(*callOptions)
+
+type callOptions struct {
+	timeout    time.Duration
+	maxRetries int
+	idempotent bool
+	header     http.Header
+}
+
+// Timeout sets timeout of each attempt of the call
+func Timeout(d time.Duration) CallOption {
+	return func(o *callOptions) { o.timeout = d }
+}
+
+// Retries sets max number of retries of the call, 0 disables retries
+func Retries(n int) CallOption {
+	return func(o *callOptions) { o.maxRetries = n }
+}
+
+// Idempotent allows retries of the call regardless of its method, e.g. POST with idempotency key
+func Idempotent() CallOption {
+	return func(o *callOptions) { o.idempotent = true }
+}
+
+// Header adds header to the request of the call
+func Header(key, value string) CallOption {
+	return func(o *callOptions) {
+		if o.header == nil {
+			o.header = make(http.Header)
+		}
+		o.header.Add(key, value)
+	}
+}
+
+func New(cfg Config) (*Client, error) {
+	defaults := DefaultConfig()
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaults.Timeout
+	}
+	if cfg.BackoffBase <= 0 {
+		cfg.BackoffBase = defaults.BackoffBase
+	}
+	if cfg.BackoffMax < cfg.BackoffBase {
+		cfg.BackoffMax = cfg.BackoffBase
+	}
+	if cfg.BreakerCooldown <= 0 {
+		cfg.BreakerCooldown = defaults.BreakerCooldown
+	}
+
+	// Пул соединений общий для всех хостов клиента
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if cfg.MaxIdleConnsPerHost > 0 {
+		transport.MaxIdleConnsPerHost = cfg.MaxIdleConnsPerHost
+		if transport.MaxIdleConns < cfg.MaxIdleConnsPerHost {
+			transport.MaxIdleConns = cfg.MaxIdleConnsPerHost
+		}
+	}
+	transport.MaxConnsPerHost = cfg.MaxConnsPerHost
+	if cfg.IdleConnTimeout > 0 {
+		transport.IdleConnTimeout = cfg.IdleConnTimeout
+	}
+
+	c := &Client{
+		cfg: cfg,
+		// attemptTransport внутри otelhttp, чтобы помечать span каждой попытки
+		http:     &http.Client{Transport: tracing.NewOtelTransport(attemptTransport{base: transport})},
+		breakers: make(map[string]*breaker),
+	}
+	if err := c.initMetrics(); err != nil {
+		return nil, fmt.Errorf("could not set up http client metrics: %v", err)
+	}
+	return c, nil
+}
+
+func (c *Client) initMetrics() error {
+	meter := otel.Meter(meterName)
+
+	var err error
+	c.retries, err = meter.Int64Counter("http.client.retries",
+		metric.WithDescription("Retried attempts of outgoing HTTP requests"))
+	if err != nil {
+		return err
+	}
+	c.transitions, err = meter.Int64Counter("http.client.breaker.transitions",
+		metric.WithDescription("Circuit breaker state changes, by the new state"))
+	if err != nil {
+		return err
+	}
+	_, err = meter.Int64ObservableGauge("http.client.breaker.state",
+		metric.WithDescription("Circuit breaker state per downstream host: 0 - closed, 1 - half-open, 2 - open"),
+		metric.WithInt64Callback(func(_ context.Context, o metric.Int64Observer) error {
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			for host, b := range c.breakers {
+				o.Observe(int64(b.currentState()), metric.WithAttributes(attribute.String("server.address", host)))
+			}
+			return nil
+		}))
+	return err
+}
+
+// Do sends request with retries and circuit breaker. Response body must be closed by the caller.
+// Requests are retried only if they are idempotent (by method or Idempotent option) and their body can be re-read.
+// Retried are network errors, 429, 502, 503, 504 and 409 with Retry-After: the server is still processing
+// the same idempotent request, e.g. the previous attempt timed out, and will answer it later.
+func (c *Client) Do(req *http.Request, opts ...CallOption) (*http.Response, error) {
+	o := callOptions{timeout: c.cfg.Timeout, maxRetries: c.cfg.MaxRetries}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if len(o.header) > 0 {
+		req = req.Clone(req.Context())
+		for key, values := range o.header {
+			req.Header[key] = values
+		}
+	}
+	retries := 0
+	if (o.idempotent || isIdempotent(req.Method)) && (req.Body == nil || req.Body == http.NoBody || req.GetBody != nil) {
+		retries = o.maxRetries
+	}
+
+	ctx := req.Context()
+	host := req.URL.Host
+	b := c.breaker(host)
+
+	for attempt := 0; ; attempt++ {
+		from, to, err := b.allow()
+		c.stateChanged(ctx, host, from, to)
+		if err != nil {
+			trace.SpanFromContext(ctx).AddEvent("circuit breaker rejected request",
+				trace.WithAttributes(attribute.String("server.address", host)))
+			return nil, fmt.Errorf("%s %s: %w", req.Method, host, err)
+		}
+
+		resp, err := c.attempt(req, attempt, o.timeout)
+		if ctx.Err() != nil {
+			// Вызывающий код сам отменил запрос, это не ошибка хоста
+			b.release()
+			if resp != nil {
+				resp.Body.Close()
+			}
+			return nil, ctx.Err()
+		}
+		from, to = b.record(err == nil && resp.StatusCode < http.StatusInternalServerError)
+		c.stateChanged(ctx, host, from, to)
+
+		if attempt >= retries || !shouldRetry(resp, err) {
+			return resp, err
+		}
+
+		delay := c.backoff(attempt)
+		event := []attribute.KeyValue{
+			attribute.Int("http.retry.attempt", attempt+1),
+			attribute.Int64("http.retry.delay_ms", delay.Milliseconds()),
+		}
+		if err != nil {
+			event = append(event, attribute.String("error", err.Error()))
+		} else {
+			event = append(event, attribute.Int("http.status_code", resp.StatusCode))
+			// Дочитываем тело, чтобы соединение вернулось в пул
+			_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+			resp.Body.Close()
+		}
+		trace.SpanFromContext(ctx).AddEvent("retrying request", trace.WithAttributes(event...))
+		c.retries.Add(ctx, 1, metric.WithAttributes(attribute.String("server.address", host)))
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+type attemptKey struct{}
+
+func (c *Client) attempt(req *http.Request, attempt int, timeout time.Duration) (*http.Response, error) {
+	ctx := context.WithValue(req.Context(), attemptKey{}, attempt)
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+
+	r := req.Clone(ctx)
+	if attempt > 0 && req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+		r.Body = body
+	}
+
+	resp, err := c.http.Do(r)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	// Таймаут действует и на чтение тела, контекст отменяется при его закрытии
+	resp.Body = &cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+func (c *Client) breaker(host string) *breaker {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	b, ok := c.breakers[host]
+	if !ok {
+		b = newBreaker(c.cfg.BreakerFailures, c.cfg.BreakerCooldown)
+		c.breakers[host] = b
+	}
+	return b
+}
+
+func (c *Client) stateChanged(ctx context.Context, host string, from, to breakerState) {
+	if from == to {
+		return
+	}
+	attrs := []attribute.KeyValue{
+		attribute.String("server.address", host),
+		attribute.String("circuit_breaker.from", from.String()),
+		attribute.String("circuit_breaker.state", to.String()),
+	}
+	trace.SpanFromContext(ctx).AddEvent("circuit breaker state changed", trace.WithAttributes(attrs...))
+	c.transitions.Add(ctx, 1, metric.WithAttributes(attrs[0], attrs[2]))
+}
+
+// backoff - экспоненциальная задержка с "равным" джиттером: случайное значение от половины задержки до полной,
+// чтобы повторы не шли слишком часто, но и не совпадали у разных клиентов
+func (c *Client) backoff(attempt int) time.Duration {
+	delay := c.cfg.BackoffBase << attempt
+	if delay <= 0 || delay > c.cfg.BackoffMax {
+		delay = c.cfg.BackoffMax
+	}
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+func isIdempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+func shouldRetry(resp *http.Response, err error) bool {
+	if err != nil {
+		return !errors.Is(err, context.Canceled)
+	}
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	case http.StatusConflict:
+		// Конфликт, который пройдёт сам: тот же запрос ещё выполняется
+		return resp.Header.Get("Retry-After") != ""
+	}
+	return false
+}
+
+// attemptTransport записывает номер попытки в span otelhttp
+type attemptTransport struct {
+	base http.RoundTripper
+}
+
+func (t attemptTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if attempt, _ := req.Context().Value(attemptKey{}).(int); attempt > 0 {
+		trace.SpanFromContext(req.Context()).SetAttributes(attribute.Int("http.resend_count", attempt))
+	}
+	return t.base.RoundTrip(req)
+}
+
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelOnClose) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
@@ -0,0 +1,213 @@
+package httpclient_test
+
+import (
+	"context"
+	"errors"
+	"go.opentelemetry.io/otel"
+	"net/http"
+	"net/http/httptest"
+	"otel-jaeger-learn/pkg/tracing/httpclient"
+	"otel-jaeger-learn/pkg/tracing/tracingtest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newClient(t *testing.T, cfg httpclient.Config) *httpclient.Client {
+	t.Helper()
+	cfg.BackoffBase = time.Millisecond
+	cfg.BackoffMax = 5 * time.Millisecond
+	c, err := httpclient.New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// flakyServer отвечает failures раз кодом status, затем 200 с JSON
+func flakyServer(t *testing.T, failures int32, status int) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) <= failures {
+			http.Error(w, "try later", status)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"price": 42}`))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &calls
+}
+
+type priceResponse struct {
+	Price float64 `json:"price"`
+}
+
+func TestRetriesAreChildSpans(t *testing.T) {
+	rec := tracingtest.Install(t)
+	srv, calls := flakyServer(t, 2, http.StatusServiceUnavailable)
+	c := newClient(t, httpclient.DefaultConfig())
+
+	ctx, span := otel.Tracer("test").Start(context.Background(), "caller")
+	got, err := httpclient.GetJSON[priceResponse](ctx, c, srv.URL)
+	span.End()
+	if err != nil {
+		t.Fatalf("GetJSON: %v", err)
+	}
+	if got.Price != 42 || calls.Load() != 3 {
+		t.Fatalf("price = %v after %d calls, want 42 after 3", got.Price, calls.Load())
+	}
+
+	caller := rec.Span("caller")
+	attempts := rec.SpansByName("HTTP GET")
+	if len(attempts) != 3 {
+		t.Fatalf("got %d attempt spans, want 3, trace:\n%s", len(attempts), rec.Dump())
+	}
+	for i, attempt := range attempts {
+		rec.AssertChildOf(attempt, caller)
+		if i > 0 {
+			rec.AssertAttribute(attempt, "http.resend_count", i)
+		}
+	}
+	if events := len(caller.Events); events != 2 {
+		t.Errorf("caller span has %d events, want 2 retry events", events)
+	}
+	rec.AssertEvent(caller, "retrying request")
+}
+
+func TestNonIdempotentRequestIsNotRetried(t *testing.T) {
+	tracingtest.Install(t)
+	srv, calls := flakyServer(t, 1, http.StatusServiceUnavailable)
+	c := newClient(t, httpclient.DefaultConfig())
+
+	_, err := httpclient.PostJSON[priceResponse](context.Background(), c, srv.URL, map[string]int{"id": 1})
+	var statusErr *httpclient.StatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("err = %v, want StatusError 503", err)
+	}
+	if !strings.Contains(string(statusErr.Body), "try later") {
+		t.Errorf("StatusError body = %q", statusErr.Body)
+	}
+	if calls.Load() != 1 {
+		t.Errorf("POST was sent %d times, want 1", calls.Load())
+	}
+
+	// С ключом идемпотентности POST повторяется
+	calls.Store(0)
+	if _, err := httpclient.PostJSON[priceResponse](context.Background(), c, srv.URL, map[string]int{"id": 1},
+		httpclient.Idempotent()); err != nil {
+		t.Fatalf("idempotent POST: %v", err)
+	}
+	if calls.Load() != 2 {
+		t.Errorf("idempotent POST was sent %d times, want 2", calls.Load())
+	}
+}
+
+func TestConflictIsRetriedOnlyWithRetryAfter(t *testing.T) {
+	tracingtest.Install(t)
+	for _, retryAfter := range []string{"", "1"} {
+		var calls atomic.Int32
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if calls.Add(1) == 1 {
+				if retryAfter != "" {
+					w.Header().Set("Retry-After", retryAfter)
+				}
+				http.Error(w, "in progress", http.StatusConflict)
+				return
+			}
+			_, _ = w.Write([]byte(`{"price": 42}`))
+		}))
+		c := newClient(t, httpclient.DefaultConfig())
+
+		_, err := httpclient.PostJSON[priceResponse](context.Background(), c, srv.URL, map[string]int{"id": 1}, httpclient.Idempotent())
+		srv.Close()
+		var statusErr *httpclient.StatusError
+		switch {
+		case retryAfter == "" && (!errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusConflict || calls.Load() != 1):
+			t.Errorf("409 without Retry-After: err %v after %d calls, want 409 after 1 call", err, calls.Load())
+		case retryAfter != "" && (err != nil || calls.Load() != 2):
+			t.Errorf("409 with Retry-After: err %v after %d calls, want success after 2 calls", err, calls.Load())
+		}
+	}
+}
+
+func TestCircuitBreakerOpensPerHost(t *testing.T) {
+	rec := tracingtest.Install(t)
+	broken, brokenCalls := flakyServer(t, 1000, http.StatusInternalServerError)
+	healthy, _ := flakyServer(t, 0, http.StatusOK)
+
+	cfg := httpclient.DefaultConfig()
+	cfg.BreakerFailures = 3
+	cfg.BreakerCooldown = time.Hour
+	c := newClient(t, cfg)
+
+	ctx, span := otel.Tracer("test").Start(context.Background(), "caller")
+	for i := 0; i < 3; i++ {
+		if _, err := httpclient.GetJSON[priceResponse](ctx, c, broken.URL, httpclient.Retries(0)); err == nil {
+			t.Fatal("expected error from broken server")
+		}
+	}
+	_, err := httpclient.GetJSON[priceResponse](ctx, c, broken.URL)
+	if !errors.Is(err, httpclient.ErrCircuitOpen) {
+		t.Errorf("err = %v, want ErrCircuitOpen", err)
+	}
+	if _, err := httpclient.GetJSON[priceResponse](ctx, c, healthy.URL); err != nil {
+		t.Errorf("healthy host is affected by another host breaker: %v", err)
+	}
+	span.End()
+
+	if brokenCalls.Load() != 3 {
+		t.Errorf("broken server got %d calls, want 3", brokenCalls.Load())
+	}
+	caller := rec.Span("caller")
+	rec.AssertEvent(caller, "circuit breaker state changed")
+	rec.AssertEvent(caller, "circuit breaker rejected request")
+}
+
+func TestTimeoutPerAttempt(t *testing.T) {
+	tracingtest.Install(t)
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			select {
+			case <-r.Context().Done():
+			case <-time.After(time.Second):
+			}
+			return
+		}
+		_, _ = w.Write([]byte(`{"price": 1}`))
+	}))
+	t.Cleanup(srv.Close)
+	c := newClient(t, httpclient.DefaultConfig())
+
+	got, err := httpclient.GetJSON[priceResponse](context.Background(), c, srv.URL, httpclient.Timeout(50*time.Millisecond))
+	if err != nil || got.Price != 1 {
+		t.Fatalf("GetJSON = %v, %v; want retry after timeout", got, err)
+	}
+}
+
+func TestHeaderIsSentOnEveryAttempt(t *testing.T) {
+	tracingtest.Install(t)
+	var keys []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		keys = append(keys, r.Header.Get("Idempotency-Key"))
+		if len(keys) == 1 {
+			http.Error(w, "try later", http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte(`{"price": 42}`))
+	}))
+	t.Cleanup(srv.Close)
+	c := newClient(t, httpclient.DefaultConfig())
+
+	_, err := httpclient.PostJSON[priceResponse](context.Background(), c, srv.URL, map[string]int{"id": 1},
+		httpclient.Idempotent(), httpclient.Header("Idempotency-Key", "k1"))
+	if err != nil {
+		t.Fatalf("PostJSON: %v", err)
+	}
+	if len(keys) != 2 || keys[0] != "k1" || keys[1] != "k1" {
+		t.Errorf("Idempotency-Key per attempt = %q, want k1 twice", keys)
+	}
+}
@@ -0,0 +1,30 @@
+package httpclient
+
+import "time"
+
+// Config - настройки клиента, одинаковые для всех вызовов; таймаут и повторы можно переопределить на вызов
+type Config struct {
+	Timeout             time.Duration `env:"HTTP_CLIENT_TIMEOUT" envDefault:"5s"`    // таймаут одной попытки
+	MaxRetries          int           `env:"HTTP_CLIENT_MAX_RETRIES" envDefault:"2"` // повторы только для идемпотентных запросов
+	BackoffBase         time.Duration `env:"HTTP_CLIENT_BACKOFF_BASE" envDefault:"100ms"`
+	BackoffMax          time.Duration `env:"HTTP_CLIENT_BACKOFF_MAX" envDefault:"2s"`
+	BreakerFailures     int           `env:"HTTP_CLIENT_BREAKER_FAILURES" envDefault:"5"` // ошибок подряд до размыкания, 0 - без breaker'а
+	BreakerCooldown     time.Duration `env:"HTTP_CLIENT_BREAKER_COOLDOWN" envDefault:"10s"`
+	MaxIdleConnsPerHost int           `env:"HTTP_CLIENT_MAX_IDLE_CONNS_PER_HOST" envDefault:"32"`
+	MaxConnsPerHost     int           `env:"HTTP_CLIENT_MAX_CONNS_PER_HOST" envDefault:"0"` // 0 - без лимита
+	IdleConnTimeout     time.Duration `env:"HTTP_CLIENT_IDLE_CONN_TIMEOUT" envDefault:"90s"`
+}
+
+// DefaultConfig returns config with the same values as env defaults
+func DefaultConfig() Config {
+	return Config{
+		Timeout:             5 * time.Second,
+		MaxRetries:          2,
+		BackoffBase:         100 * time.Millisecond,
+		BackoffMax:          2 * time.Second,
+		BreakerFailures:     5,
+		BreakerCooldown:     10 * time.Second,
+		MaxIdleConnsPerHost: 32,
+		IdleConnTimeout:     90 * time.Second,
+	}
+}
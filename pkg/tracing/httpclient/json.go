@@ -0,0 +1,79 @@
+package httpclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// StatusError - ответ с кодом не 2xx
+type StatusError struct {
+	Method     string
+	URL        string
+	StatusCode int
+	Body       []byte // начало тела ответа
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%s %s: unexpected status %d: %s", e.Method, e.URL, e.StatusCode, strings.TrimSpace(string(e.Body)))
+}
+
+// DoJSON sends in as JSON body (if not nil) and decodes JSON response to out (if not nil).
+// Non 2xx responses are returned as *StatusError.
+func (c *Client) DoJSON(ctx context.Context, method, url string, in, out any, opts ...CallOption) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return fmt.Errorf("marshal request: %w", err)
+		}
+		// bytes.Reader позволяет http.NewRequest задать GetBody, без него нельзя повторить запрос
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return err
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.Do(req, opts...)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 4<<10))
+		return &StatusError{Method: method, URL: url, StatusCode: resp.StatusCode, Body: data}
+	}
+	if out == nil {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decode response of %s %s: %w", method, url, err)
+	}
+	return nil
+}
+
+// GetJSON sends GET request and decodes JSON response to T
+func GetJSON[T any](ctx context.Context, c *Client, url string, opts ...CallOption) (T, error) {
+	var out T
+	err := c.DoJSON(ctx, http.MethodGet, url, nil, &out, opts...)
+	return out, err
+}
+
+// PostJSON sends in as JSON body and decodes JSON response to T
+func PostJSON[T any](ctx context.Context, c *Client, url string, in any, opts ...CallOption) (T, error) {
+	var out T
+	err := c.DoJSON(ctx, http.MethodPost, url, in, &out, opts...)
+	return out, err
+}
@@ -0,0 +1,228 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"log/slog"
+	"otel-jaeger-learn/pkg/logging"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const leakStackDepth = 32
+
+// LeakedSpan описывает span, который был начат, но так и не завершён через End()
+type LeakedSpan struct {
+	Name      string
+	TraceID   string
+	SpanID    string
+	StartTime time.Time
+	Age       time.Duration
+	Stack     string // стек вызовов в момент создания span'а
+}
+
+func (l LeakedSpan) String() string {
+	return fmt.Sprintf("span %q (trace %s, span %s) not ended after %s, started at:\n%s",
+		l.Name, l.TraceID, l.SpanID, l.Age.Round(time.Millisecond), l.Stack)
+}
+
+// TestingT is the subset of testing.TB used by LeakDetector.AssertNoLeaks
+type TestingT interface {
+	Helper()
+	Errorf(format string, args ...any)
+}
+
+type spanKey struct {
+	traceID trace.TraceID
+	spanID  trace.SpanID
+}
+
+type trackedSpan struct {
+	name     string
+	sc       trace.SpanContext
+	start    time.Time
+	pcs      []uintptr
+	reported bool
+}
+
+// LeakDetector is a debug span processor that tracks started but not ended spans.
+// Spans older than maxAge are reported once by a background check, all remaining
+// spans are reported on Shutdown.
+type LeakDetector struct {
+	maxAge time.Duration
+	report func([]LeakedSpan)
+
+	mu    sync.Mutex
+	spans map[spanKey]*trackedSpan
+
+	stopOnce sync.Once
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+var _ sdktrace.SpanProcessor = (*LeakDetector)(nil)
+
+// NewLeakDetector creates LeakDetector, if report is nil leaks are written to the default logger.
+// maxAge <= 0 disables the background check, leaks are reported only on Shutdown.
+func NewLeakDetector(maxAge time.Duration, report func([]LeakedSpan)) *LeakDetector {
+	if report == nil {
+		report = logLeaks
+	}
+	d := &LeakDetector{
+		maxAge: maxAge,
+		report: report,
+		spans:  make(map[spanKey]*trackedSpan),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+
+	if maxAge > 0 {
+		go d.checkLoop()
+	} else {
+		close(d.done)
+	}
+
+	return d
+}
+
+func (d *LeakDetector) OnStart(_ context.Context, s sdktrace.ReadWriteSpan) {
+	pcs := make([]uintptr, leakStackDepth)
+	// skip: [Callers, OnStart], кадры самого sdk отфильтрует formatStack
+	n := runtime.Callers(2, pcs)
+
+	d.mu.Lock()
+	d.spans[keyOf(s.SpanContext())] = &trackedSpan{
+		name:  s.Name(),
+		sc:    s.SpanContext(),
+		start: s.StartTime(),
+		pcs:   pcs[:n],
+	}
+	d.mu.Unlock()
+}
+
+func (d *LeakDetector) OnEnd(s sdktrace.ReadOnlySpan) {
+	d.mu.Lock()
+	delete(d.spans, keyOf(s.SpanContext()))
+	d.mu.Unlock()
+}
+
+// Shutdown stops background check and reports every span that is still not ended
+func (d *LeakDetector) Shutdown(ctx context.Context) error {
+	d.stopOnce.Do(func() { close(d.stop) })
+
+	select {
+	case <-d.done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	if leaks := d.Leaks(); len(leaks) > 0 {
+		d.report(leaks)
+	}
+	return nil
+}
+
+func (d *LeakDetector) ForceFlush(context.Context) error {
+	return nil
+}
+
+// Leaks returns all spans that are started but not ended yet, oldest first
+func (d *LeakDetector) Leaks() []LeakedSpan {
+	return d.collect(time.Now(), 0, false)
+}
+
+// AssertNoLeaks fails the test for every span that is still not ended
+func (d *LeakDetector) AssertNoLeaks(t TestingT) {
+	t.Helper()
+	for _, leak := range d.Leaks() {
+		t.Errorf("leaked %s", leak)
+	}
+}
+
+func (d *LeakDetector) checkLoop() {
+	defer close(d.done)
+
+	interval := d.maxAge / 2
+	if interval < 100*time.Millisecond {
+		interval = 100 * time.Millisecond
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-d.stop:
+			return
+		case now := <-ticker.C:
+			// Каждый span репортится фоновой проверкой только один раз
+			if leaks := d.collect(now, d.maxAge, true); len(leaks) > 0 {
+				d.report(leaks)
+			}
+		}
+	}
+}
+
+func (d *LeakDetector) collect(now time.Time, minAge time.Duration, markReported bool) []LeakedSpan {
+	d.mu.Lock()
+	var tracked []trackedSpan
+	for _, s := range d.spans {
+		if now.Sub(s.start) < minAge || (markReported && s.reported) {
+			continue
+		}
+		if markReported {
+			s.reported = true
+		}
+		tracked = append(tracked, *s)
+	}
+	d.mu.Unlock()
+
+	sort.Slice(tracked, func(i, j int) bool { return tracked[i].start.Before(tracked[j].start) })
+
+	leaks := make([]LeakedSpan, 0, len(tracked))
+	for _, s := range tracked {
+		leaks = append(leaks, LeakedSpan{
+			Name:      s.name,
+			TraceID:   s.sc.TraceID().String(),
+			SpanID:    s.sc.SpanID().String(),
+			StartTime: s.start,
+			Age:       now.Sub(s.start),
+			Stack:     formatStack(s.pcs),
+		})
+	}
+	return leaks
+}
+
+func keyOf(sc trace.SpanContext) spanKey {
+	return spanKey{traceID: sc.TraceID(), spanID: sc.SpanID()}
+}
+
+func formatStack(pcs []uintptr) string {
+	var sb strings.Builder
+	frames := runtime.CallersFrames(pcs)
+	for {
+		frame, more := frames.Next()
+		if !strings.HasPrefix(frame.Function, "go.opentelemetry.io/otel/sdk/") {
+			fmt.Fprintf(&sb, "\t%s\n\t\t%s:%d\n", frame.Function, frame.File, frame.Line)
+		}
+		if !more {
+			break
+		}
+	}
+	return sb.String()
+}
+
+func logLeaks(leaks []LeakedSpan) {
+	for _, leak := range leaks {
+		logging.Warn("span leak detected",
+			slog.String("span", leak.Name),
+			slog.String("traceID", leak.TraceID),
+			slog.String("spanID", leak.SpanID),
+			slog.Duration("age", leak.Age),
+			slog.String("stack", leak.Stack))
+	}
+}
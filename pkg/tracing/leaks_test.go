@@ -0,0 +1,90 @@
+package tracing_test
+
+import (
+	"context"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"otel-jaeger-learn/pkg/tracing"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// leakReports собирает отчёты LeakDetector
+type leakReports struct {
+	mu      sync.Mutex
+	reports [][]tracing.LeakedSpan
+}
+
+func (r *leakReports) report(leaks []tracing.LeakedSpan) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.reports = append(r.reports, leaks)
+}
+
+func (r *leakReports) names() [][]string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var names [][]string
+	for _, leaks := range r.reports {
+		var batch []string
+		for _, leak := range leaks {
+			batch = append(batch, leak.Name)
+		}
+		names = append(names, batch)
+	}
+	return names
+}
+
+func TestLeakDetectorReportsOldSpanOnce(t *testing.T) {
+	var reports leakReports
+	detector := tracing.NewLeakDetector(50*time.Millisecond, reports.report)
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(detector))
+	tracer := tp.Tracer("leaks")
+
+	_, leaked := tracer.Start(context.Background(), "leaked")
+	_, ended := tracer.Start(context.Background(), "ended")
+	ended.End()
+
+	// Фоновая проверка идёт раз в 100ms, за три интервала span должен быть отмечен ровно один раз
+	time.Sleep(350 * time.Millisecond)
+	if got := reports.names(); len(got) != 1 || len(got[0]) != 1 || got[0][0] != "leaked" {
+		t.Fatalf("background reports = %v, want one report of span leaked", got)
+	}
+
+	if err := tp.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	// При остановке репортятся все незавершённые span'ы, в том числе уже отмеченные фоновой проверкой
+	got := reports.names()
+	if len(got) != 2 || len(got[1]) != 1 || got[1][0] != "leaked" {
+		t.Fatalf("reports after shutdown = %v, want leaked span reported again", got)
+	}
+	leaked.End()
+}
+
+func TestLeakDetectorReportsOnShutdownOnly(t *testing.T) {
+	var reports leakReports
+	detector := tracing.NewLeakDetector(0, reports.report)
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(detector))
+	tracer := tp.Tracer("leaks")
+
+	_, first := tracer.Start(context.Background(), "first")
+	time.Sleep(time.Millisecond)
+	_, second := tracer.Start(context.Background(), "second")
+	_, ended := tracer.Start(context.Background(), "ended")
+	ended.End()
+
+	if got := reports.names(); len(got) != 0 {
+		t.Fatalf("reports before shutdown = %v, want none with maxAge 0", got)
+	}
+	if err := tp.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	got := reports.names()
+	if len(got) != 1 || strings.Join(got[0], ",") != "first,second" {
+		t.Fatalf("reports = %v, want first and second, oldest first", got)
+	}
+	first.End()
+	second.End()
+}
@@ -0,0 +1,32 @@
+package tracing
+
+import (
+	"fmt"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/prometheus"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+	"net/http"
+)
+
+// meterName - имя, под которым pkg/tracing и его обёртки регистрируют свои метрики
+const meterName = "otel-jaeger-learn/pkg/tracing"
+
+// initMeterProvider устанавливает глобальный MeterProvider, метрики которого отдаются по /metrics в формате Prometheus
+func initMeterProvider(res *resource.Resource) error {
+	exporter, err := prometheus.New()
+	if err != nil {
+		return fmt.Errorf("could not create prometheus exporter: %v", err)
+	}
+	otel.SetMeterProvider(sdkmetric.NewMeterProvider(
+		sdkmetric.WithReader(exporter),
+		sdkmetric.WithResource(res),
+	))
+	return nil
+}
+
+// MetricsHandler returns handler that serves metrics in Prometheus format
+func MetricsHandler() http.Handler {
+	return promhttp.Handler()
+}
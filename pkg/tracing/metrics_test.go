@@ -0,0 +1,50 @@
+package tracing
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/metric/noop"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+)
+
+func TestMetricsHandlerServesExporterTelemetry(t *testing.T) {
+	// Экспортер регистрируется в реестре Prometheus по умолчанию, на время теста он подменяется пустым
+	registerer, gatherer := prometheus.DefaultRegisterer, prometheus.DefaultGatherer
+	registry := prometheus.NewRegistry()
+	prometheus.DefaultRegisterer, prometheus.DefaultGatherer = registry, registry
+	t.Cleanup(func() {
+		prometheus.DefaultRegisterer, prometheus.DefaultGatherer = registerer, gatherer
+		otel.SetMeterProvider(noop.NewMeterProvider())
+	})
+	if err := initMeterProvider(resource.Empty()); err != nil {
+		t.Fatal(err)
+	}
+
+	telemetry := newTelemetry(t)
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(
+		telemetry.wrapProcessor(sdktrace.NewSimpleSpanProcessor(telemetry.wrapExporter(&stubExporter{})))))
+	endSpans(tp, "first", "second")
+
+	rec := httptest.NewRecorder()
+	MetricsHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", rec.Code)
+	}
+	body := rec.Body.String()
+	for _, want := range []string{
+		`tracing_spans_exported_total\{[^}]*\} 2`,
+		`tracing_spans_failed_total\{[^}]*\} 0`,
+		`tracing_spans_dropped_estimate_total\{[^}]*\} 0`,
+		`tracing_queue_length\{[^}]*\} 0`,
+		`tracing_export_duration_seconds_count\{[^}]*\} 2`,
+	} {
+		if !regexp.MustCompile(want).MatchString(body) {
+			t.Errorf("metrics do not match %q:\n%s", want, body)
+		}
+	}
+}
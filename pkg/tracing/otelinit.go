@@ -14,23 +14,53 @@ import (
 	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 	semconv "go.opentelemetry.io/otel/semconv/v1.10.0"
 	"net/http"
+	"otel-jaeger-learn/pkg/logging"
 )
 
-func AddOtelMiddleware(r *gin.Engine, serviceName string) {
+var (
+	tracerProvider *sdktrace.TracerProvider
+	spool          *spoolClient
+	stopSampling   context.CancelFunc = func() {}
+)
+
+func AddOtelMiddleware(r *gin.Engine, serviceName string, opts ...MiddlewareOption) {
+	var o middlewareOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
 	// Middleware который будет создавать новый или брать из заголовков трейс при каждом запросе
-	r.Use(otelgin.Middleware(serviceName))
+	// Служебные /metrics и /debug/* не трассируем
+	r.Use(otelgin.Middleware(serviceName, otelgin.WithFilter(func(req *http.Request) bool {
+		return !isDebugPath(req.URL.Path)
+	})))
+	// X-Request-ID, X-Trace-Id и traceparent в ответе
+	r.Use(requestIDMiddleware())
+	// Дедлайн запроса из X-Request-Budget-Ms, передаётся дальше клиентом из NewOtelTransport
+	r.Use(deadlineMiddleware(o.requestBudget))
 }
 
 func NewOtelHttpClient() *http.Client {
 	// Клиент который будет передавать трейс в запросе (нужно глобально установить propagator)
+	// и X-Request-ID входящего запроса
 	return &http.Client{
-		Transport: otelhttp.NewTransport(http.DefaultTransport),
+		Transport: NewOtelTransport(http.DefaultTransport),
 	}
 }
 
+// NewOtelTransport wraps base transport so it creates client span and passes trace, X-Request-ID
+// and remaining deadline of ctx
+func NewOtelTransport(base http.RoundTripper) http.RoundTripper {
+	return otelhttp.NewTransport(requestIDTransport{base: deadlineTransport{base: base}})
+}
+
 func InitTracer(cfg Config, serviceName string) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+
 	// Создаём экспортер в Tempo
-	exporter, err := newTempoExporter(cfg.TempoAddr)
+	exporter, err := newTempoExporter(cfg)
 	if err != nil {
 		return err
 	}
@@ -45,13 +75,56 @@ func InitTracer(cfg Config, serviceName string) error {
 		return fmt.Errorf("could not set up resource: %v", err)
 	}
 
-	// Создание трейсер провайдера, с Jaeger, который принимает все span'ы (AlwaysSample)
-	tp := sdktrace.NewTracerProvider(
-		sdktrace.WithBatcher(exporter),
-		sdktrace.WithSampler(sdktrace.AlwaysSample()),
-		sdktrace.WithResource(res),
+	// Метрики самого экспорта span'ов, отдаются по /metrics
+	if err := initMeterProvider(res); err != nil {
+		return err
+	}
+	telemetry, err := newExporterTelemetry()
+	if err != nil {
+		return fmt.Errorf("could not set up exporter telemetry: %v", err)
+	}
+	if err := registerSpoolMetrics(); err != nil {
+		return fmt.Errorf("could not set up spool telemetry: %v", err)
+	}
+	batcher := sdktrace.NewBatchSpanProcessor(telemetry.wrapExporter(exporter),
+		sdktrace.WithMaxQueueSize(batchMaxQueueSize),
+		sdktrace.WithMaxExportBatchSize(batchMaxExportBatchSize),
 	)
+
+	// Сэмплер с правилами, которые можно менять на лету (по умолчанию принимает все span'ы)
+	ruleSampler, err := newRuleSampler(cfg, serviceName)
+	if err != nil {
+		return err
+	}
+	// Дочерние span'ы следуют решению родителя, правила применяются только к корневым.
+	// Запросы в режиме отладки сэмплируются всегда, даже если родитель не сэмплирован
+	sampler := NewDebugSampler(sdktrace.ParentBased(ruleSampler))
+
+	// Создание трейсер провайдера с экспортом в Tempo
+	spanz := newSpanzProcessor()
+	opts := []sdktrace.TracerProviderOption{
+		sdktrace.WithSpanProcessor(telemetry.wrapProcessor(batcher)),
+		sdktrace.WithSpanProcessor(spanz),
+		sdktrace.WithSpanProcessor(ruleSampler),
+		sdktrace.WithSampler(sampler),
+		sdktrace.WithResource(res),
+	}
+	// Детектор утечек span'ов, включается только для отладки
+	if cfg.LeakDetectAge > 0 {
+		opts = append(opts, sdktrace.WithSpanProcessor(NewLeakDetector(cfg.LeakDetectAge, nil)))
+	}
+	tp := sdktrace.NewTracerProvider(opts...)
 	otel.SetTracerProvider(tp)
+	tracerProvider = tp
+
+	debugState.serviceName = serviceName
+	debugState.endpoint = cfg.TempoAddr
+	debugState.sampler = sampler
+	debugState.telemetry = telemetry
+	debugState.spanz = spanz
+
+	// debug логи для запросов в режиме отладки, независимо от LOG_LEVEL
+	logging.SetDebugContextFunc(IsDebugTrace)
 
 	// Установка Propagator'а для корректного распространения трейса через запросы в другие сервисы
 	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
@@ -59,10 +132,72 @@ func InitTracer(cfg Config, serviceName string) error {
 	return nil
 }
 
-func newTempoExporter(addr string) (sdktrace.SpanExporter, error) {
-	client := otlptracehttp.NewClient(
-		otlptracehttp.WithEndpoint(addr), // otlp http port
-		otlptracehttp.WithInsecure(),     // HTTP instead of HTTPS
-	)
+// Shutdown flushes remaining spans and stops the tracer provider created by InitTracer
+func Shutdown(ctx context.Context) error {
+	stopSampling()
+	if tracerProvider == nil {
+		return nil
+	}
+	return tracerProvider.Shutdown(ctx)
+}
+
+// newRuleSampler создаёт сэмплер и запускает обновление правил из файла или удалённого эндпоинта
+func newRuleSampler(cfg Config, serviceName string) (*RuleSampler, error) {
+	rules := SamplingRules{DefaultRatio: cfg.SamplingRatio}
+	if cfg.SamplingFile != "" {
+		var err error
+		if rules, err = LoadSamplingFile(cfg.SamplingFile); err != nil {
+			return nil, err
+		}
+	}
+
+	sampler, err := NewRuleSampler(serviceName, rules)
+	if err != nil {
+		return nil, fmt.Errorf("could not set up sampler: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopSampling = cancel
+	if cfg.SamplingFile != "" {
+		go WatchSamplingFile(ctx, cfg.SamplingFile, cfg.SamplingPoll, sampler)
+	}
+	if cfg.SamplingURL != "" {
+		go PollRemoteSampling(ctx, cfg.SamplingURL, cfg.SamplingPoll, sampler)
+	}
+	return sampler, nil
+}
+
+func newTempoExporter(cfg Config) (sdktrace.SpanExporter, error) {
+	opts := []otlptracehttp.Option{
+		otlptracehttp.WithEndpoint(cfg.TempoAddr), // otlp http port
+		otlptracehttp.WithInsecure(),              // HTTP instead of HTTPS
+	}
+	if cfg.SpoolDir == "" {
+		return otlptrace.New(context.TODO(), otlptracehttp.NewClient(opts...))
+	}
+
+	// Повторы делает буфер на диске, встроенные ретраи клиента только задерживали бы батчер
+	opts = append(opts, otlptracehttp.WithRetry(otlptracehttp.RetryConfig{Enabled: false}))
+	client, err := newSpoolClient(otlptracehttp.NewClient(opts...), cfg.SpoolDir, cfg.SpoolMaxBytes)
+	if err != nil {
+		return nil, err
+	}
+	spool = client
 	return otlptrace.New(context.TODO(), client)
 }
+
+// GetExporterStats returns counters of the span export pipeline, ok is false if tracer is not initialized
+func GetExporterStats() (stats ExporterStats, ok bool) {
+	if debugState.telemetry == nil {
+		return ExporterStats{}, false
+	}
+	return debugState.telemetry.Stats(), true
+}
+
+// GetSpoolStats returns counters of the disk spool, ok is false if spooling is disabled
+func GetSpoolStats() (stats SpoolStats, ok bool) {
+	if spool == nil {
+		return SpoolStats{}, false
+	}
+	return spool.Stats(), true
+}
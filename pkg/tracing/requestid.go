@@ -0,0 +1,108 @@
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"net/http"
+)
+
+const (
+	// RequestIDHeader - ID запроса, который клиент может передать сам, иначе он генерируется
+	RequestIDHeader = "X-Request-ID"
+	// TraceIDHeader - ID трейса в ответе, его клиент отдаёт поддержке
+	TraceIDHeader = "X-Trace-Id"
+
+	requestIDAttr = "http.request_id"
+
+	maxRequestIDLength = 128
+)
+
+type requestIDKey struct{}
+
+// ContextWithRequestID returns copy of ctx with request ID
+func ContextWithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, requestID)
+}
+
+// RequestIDFromContext returns request ID set by the request ID middleware, or empty string
+func RequestIDFromContext(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDKey{}).(string)
+	return requestID
+}
+
+// requestIDMiddleware принимает или генерирует X-Request-ID, записывает его в span и контекст,
+// и возвращает в ответе X-Request-ID, X-Trace-Id и traceparent. Должен идти после otelgin.
+func requestIDMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestID := c.GetHeader(RequestIDHeader)
+		if !validRequestID(requestID) {
+			requestID = newRequestID()
+		}
+
+		ctx := ContextWithRequestID(c.Request.Context(), requestID)
+		c.Request = c.Request.WithContext(ctx)
+
+		// Заголовки ставим до обработчика, после записи тела их уже не добавить
+		c.Header(RequestIDHeader, requestID)
+		span := trace.SpanFromContext(ctx)
+		if span.SpanContext().IsValid() {
+			span.SetAttributes(attribute.String(requestIDAttr, requestID))
+			c.Header(TraceIDHeader, span.SpanContext().TraceID().String())
+			propagation.TraceContext{}.Inject(ctx, propagation.HeaderCarrier(c.Writer.Header()))
+		}
+
+		c.Next()
+	}
+}
+
+// validRequestID пропускает только короткие ID из печатных ASCII символов, чтобы не тащить мусор в логи
+func validRequestID(requestID string) bool {
+	if requestID == "" || len(requestID) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(requestID); i++ {
+		if requestID[i] < 0x21 || requestID[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// ErrorBody returns JSON body for error responses with trace and request IDs, so clients can pass them to support
+func ErrorBody(ctx context.Context, msg string) gin.H {
+	body := gin.H{"error": msg}
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		body["trace_id"] = sc.TraceID().String()
+	}
+	if requestID := RequestIDFromContext(ctx); requestID != "" {
+		body["request_id"] = requestID
+	}
+	return body
+}
+
+// requestIDTransport передаёт X-Request-ID из контекста в исходящие запросы
+type requestIDTransport struct {
+	base http.RoundTripper
+}
+
+func (t requestIDTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	requestID := RequestIDFromContext(req.Context())
+	if requestID == "" || req.Header.Get(RequestIDHeader) != "" {
+		return t.base.RoundTrip(req)
+	}
+	// RoundTripper не должен менять исходный запрос
+	req = req.Clone(req.Context())
+	req.Header.Set(RequestIDHeader, requestID)
+	return t.base.RoundTrip(req)
+}
@@ -0,0 +1,228 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// SamplingRules - правила сэмплирования, которые можно менять без перезапуска сервиса
+type SamplingRules struct {
+	DefaultRatio float64            `json:"default_ratio"`
+	Services     map[string]float64 `json:"services,omitempty"`   // доля по имени сервиса, важнее default_ratio
+	Operations   map[string]float64 `json:"operations,omitempty"` // доля по имени span'а, важнее services
+	ErrorBoost   *ErrorBoost        `json:"error_boost,omitempty"`
+}
+
+// ErrorBoost - после span'а с ошибкой операция с тем же именем сэмплируется с долей Ratio в течение Window
+type ErrorBoost struct {
+	Ratio  float64  `json:"ratio"`
+	Window Duration `json:"window"`
+}
+
+// Duration - time.Duration, который в JSON записывается строкой вида "1m30s"
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// Validate checks that all ratios are in [0, 1]
+func (r SamplingRules) Validate() error {
+	check := func(name string, ratio float64) error {
+		if ratio < 0 || ratio > 1 {
+			return fmt.Errorf("sampling ratio %s = %v is out of [0, 1]", name, ratio)
+		}
+		return nil
+	}
+
+	if err := check("default_ratio", r.DefaultRatio); err != nil {
+		return err
+	}
+	for name, ratio := range r.Services {
+		if err := check("services."+name, ratio); err != nil {
+			return err
+		}
+	}
+	for name, ratio := range r.Operations {
+		if err := check("operations."+name, ratio); err != nil {
+			return err
+		}
+	}
+	if r.ErrorBoost != nil {
+		if err := check("error_boost.ratio", r.ErrorBoost.Ratio); err != nil {
+			return err
+		}
+		if r.ErrorBoost.Window <= 0 {
+			return fmt.Errorf("error_boost.window must be positive")
+		}
+	}
+	return nil
+}
+
+// compiledRules - правила с заранее созданными семплерами под каждую долю
+type compiledRules struct {
+	rules      SamplingRules
+	service    sdktrace.Sampler
+	operations map[string]sdktrace.Sampler
+	boost      sdktrace.Sampler
+}
+
+// RuleSampler сэмплирует по правилам SamplingRules, правила заменяются через Update на лету.
+// RuleSampler также является SpanProcessor: он видит завершённые с ошибкой span'ы для ErrorBoost,
+// поэтому его нужно зарегистрировать в TracerProvider через WithSpanProcessor.
+type RuleSampler struct {
+	serviceName string
+	rules       atomic.Pointer[compiledRules]
+
+	mu      sync.Mutex
+	boosted map[string]time.Time // имя span'а -> до какого момента действует ErrorBoost
+}
+
+var (
+	_ sdktrace.Sampler       = (*RuleSampler)(nil)
+	_ sdktrace.SpanProcessor = (*RuleSampler)(nil)
+)
+
+// NewRuleSampler creates sampler for the service with initial rules
+func NewRuleSampler(serviceName string, rules SamplingRules) (*RuleSampler, error) {
+	s := &RuleSampler{
+		serviceName: serviceName,
+		boosted:     make(map[string]time.Time),
+	}
+	if err := s.Update(rules); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Update atomically replaces sampling rules
+func (s *RuleSampler) Update(rules SamplingRules) error {
+	if err := rules.Validate(); err != nil {
+		return err
+	}
+
+	serviceRatio := rules.DefaultRatio
+	if ratio, ok := rules.Services[s.serviceName]; ok {
+		serviceRatio = ratio
+	}
+	compiled := &compiledRules{
+		rules:      rules,
+		service:    sdktrace.TraceIDRatioBased(serviceRatio),
+		operations: make(map[string]sdktrace.Sampler, len(rules.Operations)),
+	}
+	for name, ratio := range rules.Operations {
+		compiled.operations[name] = sdktrace.TraceIDRatioBased(ratio)
+	}
+	if rules.ErrorBoost != nil {
+		compiled.boost = sdktrace.TraceIDRatioBased(rules.ErrorBoost.Ratio)
+	}
+
+	s.rules.Store(compiled)
+	return nil
+}
+
+// Rules returns current rules
+func (s *RuleSampler) Rules() SamplingRules {
+	return s.rules.Load().rules
+}
+
+func (s *RuleSampler) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	compiled := s.rules.Load()
+
+	sampler := compiled.service
+	if opSampler, ok := compiled.operations[p.Name]; ok {
+		sampler = opSampler
+	}
+
+	result := sampler.ShouldSample(p)
+	if result.Decision == sdktrace.Drop && compiled.boost != nil && s.isBoosted(p.Name) {
+		result = compiled.boost.ShouldSample(p)
+	}
+	return result
+}
+
+func (s *RuleSampler) Description() string {
+	rules := s.Rules()
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "RuleSampler{service=%s, default=%g", s.serviceName, rules.DefaultRatio)
+	writeRatios(&sb, "services", rules.Services)
+	writeRatios(&sb, "operations", rules.Operations)
+	if rules.ErrorBoost != nil {
+		fmt.Fprintf(&sb, ", error_boost=%g for %s", rules.ErrorBoost.Ratio, time.Duration(rules.ErrorBoost.Window))
+	}
+	sb.WriteString("}")
+	return sb.String()
+}
+
+func (s *RuleSampler) OnStart(context.Context, sdktrace.ReadWriteSpan) {}
+
+func (s *RuleSampler) OnEnd(span sdktrace.ReadOnlySpan) {
+	boost := s.rules.Load().rules.ErrorBoost
+	if boost == nil || span.Status().Code != codes.Error {
+		return
+	}
+
+	s.mu.Lock()
+	s.boosted[span.Name()] = time.Now().Add(time.Duration(boost.Window))
+	s.mu.Unlock()
+}
+
+func (s *RuleSampler) Shutdown(context.Context) error   { return nil }
+func (s *RuleSampler) ForceFlush(context.Context) error { return nil }
+
+func (s *RuleSampler) isBoosted(name string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	until, ok := s.boosted[name]
+	if !ok {
+		return false
+	}
+	if time.Now().After(until) {
+		delete(s.boosted, name)
+		return false
+	}
+	return true
+}
+
+func writeRatios(sb *strings.Builder, name string, ratios map[string]float64) {
+	if len(ratios) == 0 {
+		return
+	}
+	keys := make([]string, 0, len(ratios))
+	for k := range ratios {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	fmt.Fprintf(sb, ", %s={", name)
+	for i, k := range keys {
+		if i > 0 {
+			sb.WriteString(", ")
+		}
+		fmt.Fprintf(sb, "%s=%g", k, ratios[k])
+	}
+	sb.WriteString("}")
+}
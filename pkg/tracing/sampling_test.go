@@ -0,0 +1,179 @@
+package tracing_test
+
+import (
+	"context"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"net/http"
+	"os"
+	"otel-jaeger-learn/pkg/tracing"
+	"otel-jaeger-learn/pkg/tracing/tracingtest"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func decide(t *testing.T, sampler sdktrace.Sampler, name string) sdktrace.SamplingDecision {
+	t.Helper()
+	traceID := trace.TraceID{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 1}
+	return sampler.ShouldSample(sdktrace.SamplingParameters{
+		ParentContext: context.Background(),
+		TraceID:       traceID,
+		Name:          name,
+	}).Decision
+}
+
+func TestRuleSamplerOverrides(t *testing.T) {
+	sampler, err := tracing.NewRuleSampler("bookings", tracing.SamplingRules{
+		DefaultRatio: 0,
+		Services:     map[string]float64{"bookings": 1},
+		Operations:   map[string]float64{"/health": 0},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := decide(t, sampler, "/add-booking"); got != sdktrace.RecordAndSample {
+		t.Errorf("service override: decision = %v, want RecordAndSample", got)
+	}
+	if got := decide(t, sampler, "/health"); got != sdktrace.Drop {
+		t.Errorf("operation override: decision = %v, want Drop", got)
+	}
+
+	if err := sampler.Update(tracing.SamplingRules{DefaultRatio: 0}); err != nil {
+		t.Fatal(err)
+	}
+	if got := decide(t, sampler, "/add-booking"); got != sdktrace.Drop {
+		t.Errorf("after update: decision = %v, want Drop", got)
+	}
+
+	if err := sampler.Update(tracing.SamplingRules{DefaultRatio: 2}); err == nil {
+		t.Error("expected error for ratio out of range")
+	}
+}
+
+func TestRuleSamplerErrorBoost(t *testing.T) {
+	sampler, err := tracing.NewRuleSampler("bookings", tracing.SamplingRules{
+		DefaultRatio: 0,
+		ErrorBoost:   &tracing.ErrorBoost{Ratio: 1, Window: tracing.Duration(time.Minute)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSampler(sdktrace.AlwaysSample()), sdktrace.WithSpanProcessor(sampler))
+	defer provider.Shutdown(context.Background())
+
+	if got := decide(t, sampler, "/add-booking"); got != sdktrace.Drop {
+		t.Fatalf("before error: decision = %v, want Drop", got)
+	}
+
+	_, span := provider.Tracer("test").Start(context.Background(), "/add-booking")
+	span.SetStatus(codes.Error, "boom")
+	span.End()
+
+	if got := decide(t, sampler, "/add-booking"); got != sdktrace.RecordAndSample {
+		t.Errorf("after error: decision = %v, want RecordAndSample", got)
+	}
+	if got := decide(t, sampler, "/booking-price"); got != sdktrace.Drop {
+		t.Errorf("other operation: decision = %v, want Drop", got)
+	}
+}
+
+func TestFetchRemoteSampling(t *testing.T) {
+	server := tracingtest.NewSamplingServer(t, tracingtest.Probabilistic(0, map[string]float64{"/add-booking": 1}))
+	sampler, err := tracing.NewRuleSampler("bookings", tracing.SamplingRules{DefaultRatio: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := tracing.FetchRemoteSampling(context.Background(), http.DefaultClient, server.URL, sampler); err != nil {
+		t.Fatal(err)
+	}
+
+	rules := sampler.Rules()
+	if rules.DefaultRatio != 0 || rules.Operations["/add-booking"] != 1 {
+		t.Errorf("unexpected rules after fetch: %+v", rules)
+	}
+	if requests := server.Requests(); len(requests) != 1 || requests[0] != "bookings" {
+		t.Errorf("unexpected requests: %v", requests)
+	}
+}
+
+func TestRemoteSamplingKeepsLocalOnlyRules(t *testing.T) {
+	boost := &tracing.ErrorBoost{Ratio: 1, Window: tracing.Duration(time.Minute)}
+	current := tracing.SamplingRules{
+		DefaultRatio: 1,
+		Services:     map[string]float64{"price-calcs": 0.5},
+		Operations:   map[string]float64{"/stale": 0.1},
+		ErrorBoost:   boost,
+	}
+	strategy := tracing.JaegerSamplingStrategy{OperationSampling: &tracing.JaegerPerOperationRate{
+		DefaultSamplingProbability: 0.2,
+		PerOperationStrategies: []tracing.JaegerOperationStrategy{
+			{Operation: "/add-booking", ProbabilisticSampling: tracing.JaegerProbabilistic{SamplingRate: 1}},
+		},
+	}}
+
+	rules, err := strategy.Rules(current)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := tracing.SamplingRules{
+		DefaultRatio: 0.2,
+		Services:     map[string]float64{"price-calcs": 0.5},
+		Operations:   map[string]float64{"/add-booking": 1},
+		ErrorBoost:   boost,
+	}
+	if !reflect.DeepEqual(rules, want) {
+		t.Errorf("rules = %+v, want %+v", rules, want)
+	}
+	// Правила сэмплера не меняются через результат
+	rules.Services["price-calcs"] = 0
+	if current.Services["price-calcs"] != 0.5 {
+		t.Error("merged rules share services map with current rules")
+	}
+}
+
+func TestWatchSamplingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sampling.json")
+	if err := os.WriteFile(path, []byte(`{"default_ratio": 1}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	rules, err := tracing.LoadSamplingFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sampler, err := tracing.NewRuleSampler("bookings", rules)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go tracing.WatchSamplingFile(ctx, path, 10*time.Millisecond, sampler)
+
+	newRules := `{"default_ratio": 0.25, "error_boost": {"ratio": 1, "window": "30s"}}`
+	if err := os.WriteFile(path, []byte(newRules), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Горутина наблюдателя могла запомнить mtime уже нового файла, а mtime файловой системы
+	// бывает грубым, поэтому сдвигаем его вперёд, пока правила не перечитаются
+	future := time.Now()
+	deadline := time.Now().Add(2 * time.Second)
+	for sampler.Rules().DefaultRatio != 0.25 {
+		if time.Now().After(deadline) {
+			t.Fatalf("rules were not reloaded, got %+v", sampler.Rules())
+		}
+		future = future.Add(time.Second)
+		if err := os.Chtimes(path, future, future); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if boost := sampler.Rules().ErrorBoost; boost == nil || time.Duration(boost.Window) != 30*time.Second {
+		t.Errorf("unexpected error boost: %+v", boost)
+	}
+}
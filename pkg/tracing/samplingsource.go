@@ -0,0 +1,179 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"otel-jaeger-learn/pkg/logging"
+	"strings"
+	"time"
+)
+
+// JaegerSamplingStrategy - ответ Jaeger-совместимого эндпоинта удалённого сэмплирования (GET ?service=name)
+type JaegerSamplingStrategy struct {
+	StrategyType          any                     `json:"strategyType,omitempty"` // "PROBABILISTIC" или 0, зависит от версии Jaeger
+	ProbabilisticSampling *JaegerProbabilistic    `json:"probabilisticSampling,omitempty"`
+	RateLimitingSampling  *JaegerRateLimiting     `json:"rateLimitingSampling,omitempty"`
+	OperationSampling     *JaegerPerOperationRate `json:"operationSampling,omitempty"`
+}
+
+type JaegerProbabilistic struct {
+	SamplingRate float64 `json:"samplingRate"`
+}
+
+type JaegerRateLimiting struct {
+	MaxTracesPerSecond int `json:"maxTracesPerSecond"`
+}
+
+type JaegerPerOperationRate struct {
+	DefaultSamplingProbability float64                   `json:"defaultSamplingProbability"`
+	PerOperationStrategies     []JaegerOperationStrategy `json:"perOperationStrategies,omitempty"`
+}
+
+type JaegerOperationStrategy struct {
+	Operation             string              `json:"operation"`
+	ProbabilisticSampling JaegerProbabilistic `json:"probabilisticSampling"`
+}
+
+// Rules merges Jaeger strategy into current rules: default and per-operation ratios are replaced
+// by the strategy, services and error boost are kept since Jaeger has no such settings.
+// Rate limiting strategies are not supported.
+func (s JaegerSamplingStrategy) Rules(current SamplingRules) (SamplingRules, error) {
+	rules := SamplingRules{ErrorBoost: current.ErrorBoost}
+	if len(current.Services) > 0 {
+		rules.Services = make(map[string]float64, len(current.Services))
+		for name, ratio := range current.Services {
+			rules.Services[name] = ratio
+		}
+	}
+
+	switch {
+	case s.OperationSampling != nil:
+		rules.DefaultRatio = s.OperationSampling.DefaultSamplingProbability
+		if len(s.OperationSampling.PerOperationStrategies) > 0 {
+			rules.Operations = make(map[string]float64, len(s.OperationSampling.PerOperationStrategies))
+		}
+		for _, op := range s.OperationSampling.PerOperationStrategies {
+			rules.Operations[op.Operation] = op.ProbabilisticSampling.SamplingRate
+		}
+	case s.ProbabilisticSampling != nil:
+		rules.DefaultRatio = s.ProbabilisticSampling.SamplingRate
+	case s.RateLimitingSampling != nil:
+		return SamplingRules{}, fmt.Errorf("rate limiting sampling strategy is not supported")
+	default:
+		return SamplingRules{}, fmt.Errorf("empty sampling strategy")
+	}
+
+	return rules, rules.Validate()
+}
+
+// LoadSamplingFile reads SamplingRules from JSON file
+func LoadSamplingFile(path string) (SamplingRules, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return SamplingRules{}, err
+	}
+	var rules SamplingRules
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return SamplingRules{}, fmt.Errorf("could not parse sampling file %s: %w", path, err)
+	}
+	return rules, rules.Validate()
+}
+
+// WatchSamplingFile reloads rules from the file every time it is modified, until ctx is done.
+// Invalid files are logged and ignored, the sampler keeps previous rules.
+func WatchSamplingFile(ctx context.Context, path string, interval time.Duration, sampler *RuleSampler) {
+	var lastMod time.Time
+	if info, err := os.Stat(path); err == nil {
+		lastMod = info.ModTime()
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		info, err := os.Stat(path)
+		if err != nil || !info.ModTime().After(lastMod) {
+			continue
+		}
+		lastMod = info.ModTime()
+
+		rules, err := LoadSamplingFile(path)
+		if err == nil {
+			err = sampler.Update(rules)
+		}
+		if err != nil {
+			logging.ErrorErr("could not reload sampling rules", err, slog.String("file", path))
+			continue
+		}
+		logging.Info("sampling rules reloaded", slog.String("file", path), slog.String("sampler", sampler.Description()))
+	}
+}
+
+// PollRemoteSampling polls Jaeger-compatible sampling endpoint every interval, until ctx is done
+func PollRemoteSampling(ctx context.Context, endpoint string, interval time.Duration, sampler *RuleSampler) {
+	// Запрос к эндпоинту сэмплирования сам не трассируется
+	client := &http.Client{Timeout: interval}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := FetchRemoteSampling(ctx, client, endpoint, sampler); err != nil && ctx.Err() == nil {
+			logging.ErrorErr("could not fetch sampling strategy", err, slog.String("url", endpoint))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// FetchRemoteSampling requests strategy for the sampler service once and applies it
+func FetchRemoteSampling(ctx context.Context, client *http.Client, endpoint string, sampler *RuleSampler) error {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return err
+	}
+	query := u.Query()
+	query.Set("service", sampler.serviceName)
+	u.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("unexpected status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var strategy JaegerSamplingStrategy
+	if err := json.NewDecoder(resp.Body).Decode(&strategy); err != nil {
+		return fmt.Errorf("could not decode sampling strategy: %w", err)
+	}
+	rules, err := strategy.Rules(sampler.Rules())
+	if err != nil {
+		return err
+	}
+	return sampler.Update(rules)
+}
@@ -0,0 +1,324 @@
+package tracing
+
+import (
+	"container/list"
+	"context"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// Значения по умолчанию BatchSpanProcessor, с ними он и создаётся в InitTracer
+	batchMaxQueueSize       = sdktrace.DefaultMaxQueueSize
+	batchMaxExportBatchSize = sdktrace.DefaultMaxExportBatchSize
+
+	recentSpansLimit   = 100
+	inflightSpansLimit = 1000
+)
+
+// ExporterStats - состояние экспорта span'ов
+type ExporterStats struct {
+	QueueLength int64 // примерное число span'ов в очереди батчера
+	Exported    int64 // span'ов принято бэкендом
+	Failed      int64 // span'ов в батчах, которые бэкенд не принял
+	// Оценка числа span'ов, выброшенных батчером из-за переполненной очереди: батчер сам их не считает,
+	// поэтому выброшенным считается span, завершённый при QueueLength не меньше очереди и батча вместе
+	DroppedEstimate int64
+	LastExport      time.Time
+	LastLatency     time.Duration
+	LastError       string
+	LastErrorTime   time.Time
+}
+
+// exporterTelemetry считает span'ы на пути батчер -> экспортер -> бэкенд.
+// Сам BatchSpanProcessor счётчики не отдаёт, поэтому длина очереди и число выброшенных
+// span'ов вычисляются по span'ам, отданным в батчер и вернувшимся из экспортера.
+type exporterTelemetry struct {
+	enqueued        atomic.Int64
+	exported        atomic.Int64
+	failed          atomic.Int64
+	droppedEstimate atomic.Int64
+
+	mu            sync.Mutex
+	lastExport    time.Time
+	lastLatency   time.Duration
+	lastError     string
+	lastErrorTime time.Time
+
+	exportDuration metric.Float64Histogram
+}
+
+func newExporterTelemetry() (*exporterTelemetry, error) {
+	t := &exporterTelemetry{}
+	meter := otel.Meter(meterName)
+
+	var err error
+	t.exportDuration, err = meter.Float64Histogram("tracing.export.duration",
+		metric.WithDescription("Duration of span batch export to the trace backend"),
+		metric.WithUnit("s"),
+		metric.WithExplicitBucketBoundaries(0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5, 10, 30))
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = meter.Int64ObservableGauge("tracing.queue.length",
+		metric.WithDescription("Approximate number of spans waiting in the batch span processor queue"),
+		metric.WithInt64Callback(func(_ context.Context, o metric.Int64Observer) error {
+			o.Observe(t.queueLength())
+			return nil
+		}))
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = meter.Int64ObservableCounter("tracing.spans.exported",
+		metric.WithDescription("Spans accepted by the trace backend"),
+		metric.WithInt64Callback(func(_ context.Context, o metric.Int64Observer) error {
+			o.Observe(t.exported.Load())
+			return nil
+		}))
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = meter.Int64ObservableCounter("tracing.spans.failed",
+		metric.WithDescription("Spans in batches rejected by the trace backend"),
+		metric.WithInt64Callback(func(_ context.Context, o metric.Int64Observer) error {
+			o.Observe(t.failed.Load())
+			return nil
+		}))
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = meter.Int64ObservableCounter("tracing.spans.dropped_estimate",
+		metric.WithDescription("Estimated number of spans dropped by the batch span processor because its queue was full, inferred from the queue length"),
+		metric.WithInt64Callback(func(_ context.Context, o metric.Int64Observer) error {
+			o.Observe(t.droppedEstimate.Load())
+			return nil
+		}))
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = meter.Float64ObservableGauge("tracing.export.last_error_timestamp",
+		metric.WithDescription("Unix time of the last failed export, 0 if there were no errors"),
+		metric.WithUnit("s"),
+		metric.WithFloat64Callback(func(_ context.Context, o metric.Float64Observer) error {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			if !t.lastErrorTime.IsZero() {
+				o.Observe(float64(t.lastErrorTime.UnixNano()) / 1e9)
+			} else {
+				o.Observe(0)
+			}
+			return nil
+		}))
+	if err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+func (t *exporterTelemetry) queueLength() int64 {
+	return t.enqueued.Load() - t.exported.Load() - t.failed.Load()
+}
+
+// Stats returns snapshot of the counters
+func (t *exporterTelemetry) Stats() ExporterStats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return ExporterStats{
+		QueueLength:     t.queueLength(),
+		Exported:        t.exported.Load(),
+		Failed:          t.failed.Load(),
+		DroppedEstimate: t.droppedEstimate.Load(),
+		LastExport:      t.lastExport,
+		LastLatency:     t.lastLatency,
+		LastError:       t.lastError,
+		LastErrorTime:   t.lastErrorTime,
+	}
+}
+
+// wrapExporter возвращает экспортер, который считает отправленные span'ы и время экспорта
+func (t *exporterTelemetry) wrapExporter(exporter sdktrace.SpanExporter) sdktrace.SpanExporter {
+	return &instrumentedExporter{SpanExporter: exporter, telemetry: t}
+}
+
+// wrapProcessor возвращает процессор, который считает span'ы, попавшие в очередь батчера
+func (t *exporterTelemetry) wrapProcessor(processor sdktrace.SpanProcessor) sdktrace.SpanProcessor {
+	return &queueProcessor{SpanProcessor: processor, telemetry: t}
+}
+
+type instrumentedExporter struct {
+	sdktrace.SpanExporter
+	telemetry *exporterTelemetry
+}
+
+func (e *instrumentedExporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	start := time.Now()
+	err := e.SpanExporter.ExportSpans(ctx, spans)
+	latency := time.Since(start)
+
+	t := e.telemetry
+	t.exportDuration.Record(ctx, latency.Seconds())
+
+	t.mu.Lock()
+	t.lastExport = start
+	t.lastLatency = latency
+	if err != nil {
+		t.lastError = err.Error()
+		t.lastErrorTime = start
+	}
+	t.mu.Unlock()
+
+	if err != nil {
+		t.failed.Add(int64(len(spans)))
+	} else {
+		t.exported.Add(int64(len(spans)))
+	}
+	return err
+}
+
+type queueProcessor struct {
+	sdktrace.SpanProcessor
+	telemetry *exporterTelemetry
+}
+
+func (p *queueProcessor) OnEnd(s sdktrace.ReadOnlySpan) {
+	if s.SpanContext().IsSampled() {
+		// Батчер без WithBlocking выбрасывает span, когда заполнены очередь и текущий батч
+		if p.telemetry.queueLength() >= batchMaxQueueSize+batchMaxExportBatchSize {
+			p.telemetry.droppedEstimate.Add(1)
+		} else {
+			p.telemetry.enqueued.Add(1)
+		}
+	}
+	p.SpanProcessor.OnEnd(s)
+}
+
+// SpanSummary - краткая информация о span'е для страницы /debug/tracing
+type SpanSummary struct {
+	Name     string
+	TraceID  string
+	SpanID   string
+	Start    time.Time
+	Duration time.Duration
+	Status   codes.Code
+	Message  string
+}
+
+// spanzProcessor хранит начатые span'ы и последние завершённые, как zPages в OpenCensus.
+// Незавершённых span'ов хранится не больше inflightSpansLimit: утёкшие span'ы никогда не завершатся,
+// поэтому при переполнении забывается самый давно начатый
+type spanzProcessor struct {
+	mu            sync.Mutex
+	inflight      map[spanKey]*list.Element // значения элементов - inflightSpan
+	inflightOrder *list.List                // в порядке начала, старые первыми
+	forgotten     int64                     // незавершённых span'ов вытеснено из inflight
+	recent        []SpanSummary             // кольцевой буфер
+	next          int
+}
+
+type inflightSpan struct {
+	key     spanKey
+	summary SpanSummary
+}
+
+func newSpanzProcessor() *spanzProcessor {
+	return &spanzProcessor{
+		inflight:      make(map[spanKey]*list.Element),
+		inflightOrder: list.New(),
+		recent:        make([]SpanSummary, 0, recentSpansLimit),
+	}
+}
+
+func (p *spanzProcessor) OnStart(_ context.Context, s sdktrace.ReadWriteSpan) {
+	summary := SpanSummary{
+		Name:    s.Name(),
+		TraceID: s.SpanContext().TraceID().String(),
+		SpanID:  s.SpanContext().SpanID().String(),
+		Start:   s.StartTime(),
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.inflightOrder.Len() >= inflightSpansLimit {
+		oldest := p.inflightOrder.Front()
+		p.inflightOrder.Remove(oldest)
+		delete(p.inflight, oldest.Value.(inflightSpan).key)
+		p.forgotten++
+	}
+	key := keyOf(s.SpanContext())
+	p.inflight[key] = p.inflightOrder.PushBack(inflightSpan{key: key, summary: summary})
+}
+
+func (p *spanzProcessor) OnEnd(s sdktrace.ReadOnlySpan) {
+	summary := SpanSummary{
+		Name:     s.Name(),
+		TraceID:  s.SpanContext().TraceID().String(),
+		SpanID:   s.SpanContext().SpanID().String(),
+		Start:    s.StartTime(),
+		Duration: s.EndTime().Sub(s.StartTime()),
+		Status:   s.Status().Code,
+		Message:  s.Status().Description,
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	key := keyOf(s.SpanContext())
+	if elem, ok := p.inflight[key]; ok {
+		p.inflightOrder.Remove(elem)
+		delete(p.inflight, key)
+	}
+	if len(p.recent) < recentSpansLimit {
+		p.recent = append(p.recent, summary)
+	} else {
+		p.recent[p.next] = summary
+	}
+	p.next = (p.next + 1) % recentSpansLimit
+}
+
+func (p *spanzProcessor) Shutdown(context.Context) error   { return nil }
+func (p *spanzProcessor) ForceFlush(context.Context) error { return nil }
+
+// Inflight returns started but not ended spans, oldest first
+func (p *spanzProcessor) Inflight() []SpanSummary {
+	p.mu.Lock()
+	spans := make([]SpanSummary, 0, p.inflightOrder.Len())
+	for elem := p.inflightOrder.Front(); elem != nil; elem = elem.Next() {
+		s := elem.Value.(inflightSpan).summary
+		s.Duration = time.Since(s.Start)
+		spans = append(spans, s)
+	}
+	p.mu.Unlock()
+
+	sort.SliceStable(spans, func(i, j int) bool { return spans[i].Start.Before(spans[j].Start) })
+	return spans
+}
+
+// Forgotten returns number of not ended spans evicted because of the in-flight limit
+func (p *spanzProcessor) Forgotten() int64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.forgotten
+}
+
+// Recent returns last ended spans, newest first
+func (p *spanzProcessor) Recent() []SpanSummary {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	spans := make([]SpanSummary, 0, len(p.recent))
+	for i := 1; i <= len(p.recent); i++ {
+		spans = append(spans, p.recent[(p.next-i+len(p.recent))%len(p.recent)])
+	}
+	return spans
+}
@@ -0,0 +1,146 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"reflect"
+	"testing"
+)
+
+// stubExporter принимает span'ы, пока не задана err
+type stubExporter struct {
+	err error
+}
+
+func (e *stubExporter) ExportSpans(context.Context, []sdktrace.ReadOnlySpan) error { return e.err }
+func (e *stubExporter) Shutdown(context.Context) error                             { return nil }
+
+func newTelemetry(t *testing.T) *exporterTelemetry {
+	t.Helper()
+	telemetry, err := newExporterTelemetry()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return telemetry
+}
+
+func endSpans(tp *sdktrace.TracerProvider, names ...string) {
+	for _, name := range names {
+		_, span := tp.Tracer("test").Start(context.Background(), name)
+		span.End()
+	}
+}
+
+func TestExporterTelemetryCountsExportedAndFailedSpans(t *testing.T) {
+	telemetry := newTelemetry(t)
+	exporter := &stubExporter{}
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(
+		telemetry.wrapProcessor(sdktrace.NewSimpleSpanProcessor(telemetry.wrapExporter(exporter)))))
+
+	endSpans(tp, "first", "second")
+	exporter.err = errors.New("backend unavailable")
+	endSpans(tp, "third")
+	// Несэмплированные span'ы в батчер не попадают
+	unsampled := sdktrace.NewTracerProvider(sdktrace.WithSampler(sdktrace.NeverSample()),
+		sdktrace.WithSpanProcessor(telemetry.wrapProcessor(sdktrace.NewSimpleSpanProcessor(telemetry.wrapExporter(exporter)))))
+	endSpans(unsampled, "unsampled")
+
+	stats := telemetry.Stats()
+	if stats.Exported != 2 || stats.Failed != 1 || stats.QueueLength != 0 || stats.DroppedEstimate != 0 {
+		t.Errorf("stats = %+v, want 2 exported and 1 failed span", stats)
+	}
+	if stats.LastError != "backend unavailable" || stats.LastErrorTime.IsZero() || stats.LastExport != stats.LastErrorTime {
+		t.Errorf("last error = %q at %v, last export at %v, want failed last export", stats.LastError, stats.LastErrorTime, stats.LastExport)
+	}
+}
+
+func TestQueueProcessorEstimatesDropsWhenQueueIsFull(t *testing.T) {
+	telemetry := newTelemetry(t)
+	batcher := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(telemetry.wrapProcessor(batcher)))
+
+	// Очередь и текущий батч заполнены, экспорт ещё не вернулся
+	full := int64(batchMaxQueueSize + batchMaxExportBatchSize)
+	telemetry.enqueued.Store(full - 1)
+	endSpans(tp, "last queued", "dropped")
+
+	stats := telemetry.Stats()
+	if stats.QueueLength != full || stats.DroppedEstimate != 1 {
+		t.Errorf("queue length = %d, dropped estimate = %d, want %d and 1", stats.QueueLength, stats.DroppedEstimate, full)
+	}
+	// Решение о выбрасывании принимает сам батчер, он получает все span'ы
+	if got := len(batcher.Ended()); got != 2 {
+		t.Errorf("batcher got %d spans, want 2", got)
+	}
+}
+
+func summaryNames(spans []SpanSummary) []string {
+	var names []string
+	for _, s := range spans {
+		names = append(names, s.Name)
+	}
+	return names
+}
+
+func TestSpanzProcessorTracksInflightAndRecentSpans(t *testing.T) {
+	spanz := newSpanzProcessor()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spanz))
+	tracer := tp.Tracer("test")
+
+	_, first := tracer.Start(context.Background(), "first")
+	_, second := tracer.Start(context.Background(), "second")
+	if got := summaryNames(spanz.Inflight()); !reflect.DeepEqual(got, []string{"first", "second"}) {
+		t.Errorf("inflight = %q, want first and second, oldest first", got)
+	}
+	first.End()
+	second.End()
+	if got := summaryNames(spanz.Inflight()); len(got) != 0 {
+		t.Errorf("inflight after End = %q, want none", got)
+	}
+	if got := summaryNames(spanz.Recent()); !reflect.DeepEqual(got, []string{"second", "first"}) {
+		t.Errorf("recent = %q, want second and first, newest first", got)
+	}
+
+	// Кольцевой буфер хранит только последние recentSpansLimit span'ов
+	for i := 0; i < recentSpansLimit+5; i++ {
+		endSpans(tp, fmt.Sprint(i))
+	}
+	recent := summaryNames(spanz.Recent())
+	if len(recent) != recentSpansLimit || recent[0] != fmt.Sprint(recentSpansLimit+4) || recent[recentSpansLimit-1] != "5" {
+		t.Errorf("recent = %d spans from %q to %q, want %d from newest to 5", len(recent), recent[0], recent[len(recent)-1], recentSpansLimit)
+	}
+}
+
+func TestSpanzProcessorForgetsOldestInflightSpansOverLimit(t *testing.T) {
+	spanz := newSpanzProcessor()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spanz))
+	tracer := tp.Tracer("test")
+
+	var first, last trace.Span
+	for i := 0; i < inflightSpansLimit+2; i++ {
+		_, span := tracer.Start(context.Background(), fmt.Sprint(i))
+		if i == 0 {
+			first = span
+		}
+		last = span
+	}
+
+	inflight := summaryNames(spanz.Inflight())
+	if len(inflight) != inflightSpansLimit || inflight[0] != "2" || spanz.Forgotten() != 2 {
+		t.Fatalf("inflight = %d spans from %q, forgotten = %d, want %d from 2 and 2 forgotten",
+			len(inflight), inflight[0], spanz.Forgotten(), inflightSpansLimit)
+	}
+	// Забытый span при завершении попадает в последние, как обычно
+	first.End()
+	last.End()
+	if got := len(spanz.Inflight()); got != inflightSpansLimit-1 {
+		t.Errorf("%d inflight spans after End, want %d", got, inflightSpansLimit-1)
+	}
+	if got := summaryNames(spanz.Recent()); !reflect.DeepEqual(got, []string{fmt.Sprint(inflightSpansLimit + 1), "0"}) {
+		t.Errorf("recent = %q, want last and first spans", got)
+	}
+}
@@ -0,0 +1,41 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// ShutdownTimeout - сколько Serve ждёт завершения текущих запросов и отправки оставшихся span'ов
+const ShutdownTimeout = 10 * time.Second
+
+// Serve запускает HTTP сервер на addr и останавливает его по SIGINT/SIGTERM: сервер дожидается текущих запросов,
+// затем Shutdown отправляет оставшиеся span'ы (или сохраняет их в буфер на диске) и сообщает о незавершённых
+func Serve(addr string, handler http.Handler) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	return serve(ctx, &http.Server{Addr: addr, Handler: handler})
+}
+
+func serve(ctx context.Context, srv *http.Server) error {
+	errs := make(chan error, 1)
+	go func() { errs <- srv.ListenAndServe() }()
+
+	var err error
+	select {
+	case err = <-errs:
+		// Сервер не запустился, span'ы всё равно нужно отправить
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), ShutdownTimeout)
+	defer cancel()
+	if err == nil {
+		err = srv.Shutdown(shutdownCtx)
+	}
+	return errors.Join(err, Shutdown(shutdownCtx))
+}
@@ -0,0 +1,366 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
+	"go.opentelemetry.io/otel/metric"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/proto"
+	"log/slog"
+	"math/rand"
+	"os"
+	"otel-jaeger-learn/pkg/logging"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	spoolFileExt       = ".otlp"
+	spoolReplayTimeout = 10 * time.Second
+)
+
+// Задержки повтора, переменные для тестов
+var (
+	spoolMinBackoff = time.Second
+	spoolMaxBackoff = time.Minute
+)
+
+// SpoolStats - счётчики дискового буфера span'ов
+type SpoolStats struct {
+	Queued  int64 // span'ов сейчас лежит на диске
+	Sent    int64 // span'ов доставлено в бэкенд (сразу или после повтора)
+	Dropped int64 // span'ов выброшено из-за лимита размера или битых файлов
+	Bytes   int64 // размер буфера на диске
+}
+
+type spoolFile struct {
+	name  string
+	spans int64
+	size  int64
+}
+
+// spoolClient оборачивает OTLP клиент: батчи, которые не удалось отправить, сохраняются
+// в директорию и отправляются повторно с экспоненциальной задержкой, когда бэкенд снова доступен
+type spoolClient struct {
+	client   otlptrace.Client
+	dir      string
+	maxBytes int64
+
+	mu    sync.Mutex
+	files []spoolFile // от старых к новым, без файла, который сейчас отправляется повторно
+	bytes int64       // размер всех файлов на диске, включая отправляемый
+	seq   uint64
+	// Размер файла, который сейчас отправляется повторно
+	replaying int64
+
+	queued  atomic.Int64
+	sent    atomic.Int64
+	dropped atomic.Int64
+
+	wake chan struct{}
+	stop chan struct{}
+	done chan struct{}
+}
+
+var _ otlptrace.Client = (*spoolClient)(nil)
+
+func newSpoolClient(client otlptrace.Client, dir string, maxBytes int64) (*spoolClient, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("could not create spool dir: %w", err)
+	}
+	s := &spoolClient{
+		client:   client,
+		dir:      dir,
+		maxBytes: maxBytes,
+		wake:     make(chan struct{}, 1),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	// Батчи, оставшиеся с прошлого запуска, будут отправлены после старта
+	if err := s.loadFiles(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *spoolClient) Start(ctx context.Context) error {
+	if err := s.client.Start(ctx); err != nil {
+		return err
+	}
+	go s.replayLoop()
+	return nil
+}
+
+func (s *spoolClient) Stop(ctx context.Context) error {
+	close(s.stop)
+	select {
+	case <-s.done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return s.client.Stop(ctx)
+}
+
+func (s *spoolClient) UploadTraces(ctx context.Context, protoSpans []*tracepb.ResourceSpans) error {
+	// Пока на диске есть батчи, бэкенд считаем недоступным и сразу пишем в буфер
+	if s.queued.Load() == 0 {
+		err := s.client.UploadTraces(ctx, protoSpans)
+		if err == nil {
+			s.sent.Add(countSpans(protoSpans))
+			return nil
+		}
+		logging.Warn("trace export failed, spooling batch to disk", slog.String("error", err.Error()))
+	}
+
+	if err := s.spool(protoSpans); err != nil {
+		return err
+	}
+	s.notify()
+	return nil
+}
+
+// Stats возвращает текущие счётчики буфера
+func (s *spoolClient) Stats() SpoolStats {
+	s.mu.Lock()
+	bytes := s.bytes
+	s.mu.Unlock()
+
+	return SpoolStats{
+		Queued:  s.queued.Load(),
+		Sent:    s.sent.Load(),
+		Dropped: s.dropped.Load(),
+		Bytes:   bytes,
+	}
+}
+
+func (s *spoolClient) spool(protoSpans []*tracepb.ResourceSpans) error {
+	spans := countSpans(protoSpans)
+	data, err := proto.Marshal(&tracepb.TracesData{ResourceSpans: protoSpans})
+	if err != nil {
+		s.dropped.Add(spans)
+		return fmt.Errorf("could not marshal spans: %w", err)
+	}
+	size := int64(len(data))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Отправляемый сейчас файл не вытесняется, поэтому его место недоступно
+	if size > s.maxBytes-s.replaying {
+		s.dropped.Add(spans)
+		return fmt.Errorf("batch of %d bytes exceeds spool limit", size)
+	}
+
+	// Освобождаем место, выбрасывая самые старые батчи
+	for s.bytes+size > s.maxBytes && len(s.files) > 0 {
+		file := s.files[0]
+		s.files = s.files[1:]
+		s.releaseLocked(file, true)
+	}
+
+	s.seq++
+	// Количество span'ов в имени файла, чтобы не читать файл при подсчёте
+	name := fmt.Sprintf("%020d-%06d-%d%s", time.Now().UnixNano(), s.seq%1000000, spans, spoolFileExt)
+	if err := os.WriteFile(filepath.Join(s.dir, name), data, 0644); err != nil {
+		s.dropped.Add(spans)
+		return fmt.Errorf("could not write spool file: %w", err)
+	}
+
+	s.files = append(s.files, spoolFile{name: name, spans: spans, size: size})
+	s.bytes += size
+	s.queued.Add(spans)
+	return nil
+}
+
+func (s *spoolClient) replayLoop() {
+	defer close(s.done)
+
+	backoff := spoolMinBackoff
+	for {
+		file, ok := s.take()
+		if !ok {
+			select {
+			case <-s.stop:
+				return
+			case <-s.wake:
+				continue
+			}
+		}
+
+		if err := s.replay(file); err != nil {
+			s.putBack(file)
+			logging.Warn("trace spool replay failed",
+				slog.String("error", err.Error()),
+				slog.Duration("retry_in", backoff))
+
+			select {
+			case <-s.stop:
+				return
+			case <-time.After(jitter(backoff)):
+			}
+			backoff = min(backoff*2, spoolMaxBackoff)
+			continue
+		}
+		backoff = spoolMinBackoff
+	}
+}
+
+func (s *spoolClient) replay(file spoolFile) error {
+	data, err := os.ReadFile(filepath.Join(s.dir, file.name))
+	if err != nil {
+		logging.ErrorErr("dropping unreadable spool file", err, slog.String("file", file.name))
+		s.release(file, true)
+		return nil
+	}
+
+	var traces tracepb.TracesData
+	if err := proto.Unmarshal(data, &traces); err != nil {
+		logging.ErrorErr("dropping corrupted spool file", err, slog.String("file", file.name))
+		s.release(file, true)
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), spoolReplayTimeout)
+	defer cancel()
+	if err := s.client.UploadTraces(ctx, traces.GetResourceSpans()); err != nil {
+		return err
+	}
+
+	s.sent.Add(file.spans)
+	s.release(file, false)
+	return nil
+}
+
+// take снимает с очереди самый старый файл, чтобы его не выбросило вытеснение, пока он отправляется
+func (s *spoolClient) take() (spoolFile, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.files) == 0 {
+		return spoolFile{}, false
+	}
+	file := s.files[0]
+	s.files = s.files[1:]
+	s.replaying = file.size
+	return file, true
+}
+
+// putBack возвращает в начало очереди файл, который не удалось отправить
+func (s *spoolClient) putBack(file spoolFile) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.files = append([]spoolFile{file}, s.files...)
+	s.replaying = 0
+}
+
+// release удаляет файл, уже снятый с очереди, drop - span'ы из него потеряны, а не отправлены
+func (s *spoolClient) release(file spoolFile, drop bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.replaying = 0
+	s.releaseLocked(file, drop)
+}
+
+func (s *spoolClient) releaseLocked(file spoolFile, drop bool) {
+	s.bytes -= file.size
+	s.queued.Add(-file.spans)
+	if drop {
+		s.dropped.Add(file.spans)
+	}
+	if err := os.Remove(filepath.Join(s.dir, file.name)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		logging.ErrorErr("could not remove spool file", err, slog.String("file", file.name))
+	}
+}
+
+func (s *spoolClient) loadFiles() error {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return fmt.Errorf("could not read spool dir: %w", err)
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), spoolFileExt) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		parts := strings.Split(strings.TrimSuffix(entry.Name(), spoolFileExt), "-")
+		spans, err := strconv.ParseInt(parts[len(parts)-1], 10, 64)
+		if err != nil {
+			continue
+		}
+		s.files = append(s.files, spoolFile{name: entry.Name(), spans: spans, size: info.Size()})
+		s.bytes += info.Size()
+		s.queued.Add(spans)
+	}
+
+	// Имена начинаются с времени, поэтому сортировка по имени - это порядок записи
+	sort.Slice(s.files, func(i, j int) bool { return s.files[i].name < s.files[j].name })
+	return nil
+}
+
+func (s *spoolClient) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// registerSpoolMetrics регистрирует счётчики буфера, если он включён
+func registerSpoolMetrics() error {
+	if spool == nil {
+		return nil
+	}
+	meter := otel.Meter(meterName)
+
+	_, err := meter.Int64ObservableGauge("tracing.spool.queued",
+		metric.WithDescription("Spans waiting in the disk spool"),
+		metric.WithInt64Callback(func(_ context.Context, o metric.Int64Observer) error {
+			o.Observe(spool.queued.Load())
+			return nil
+		}))
+	if err != nil {
+		return err
+	}
+	_, err = meter.Int64ObservableCounter("tracing.spool.sent",
+		metric.WithDescription("Spans delivered through the spooling client"),
+		metric.WithInt64Callback(func(_ context.Context, o metric.Int64Observer) error {
+			o.Observe(spool.sent.Load())
+			return nil
+		}))
+	if err != nil {
+		return err
+	}
+	_, err = meter.Int64ObservableCounter("tracing.spool.dropped",
+		metric.WithDescription("Spans dropped by the disk spool"),
+		metric.WithInt64Callback(func(_ context.Context, o metric.Int64Observer) error {
+			o.Observe(spool.dropped.Load())
+			return nil
+		}))
+	return err
+}
+
+func countSpans(protoSpans []*tracepb.ResourceSpans) int64 {
+	var n int64
+	for _, rs := range protoSpans {
+		for _, ss := range rs.GetScopeSpans() {
+			n += int64(len(ss.GetSpans()))
+		}
+	}
+	return n
+}
+
+// jitter возвращает d +-20%, чтобы сервисы не ретраили одновременно
+func jitter(d time.Duration) time.Duration {
+	delta := int64(d) / 5
+	return time.Duration(int64(d) - delta + rand.Int63n(2*delta+1))
+}
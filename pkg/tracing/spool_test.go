@@ -0,0 +1,250 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/proto"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClient - OTLP клиент, первые fail вызовов UploadTraces которого завершаются ошибкой
+type fakeClient struct {
+	mu       sync.Mutex
+	fail     int
+	attempts []time.Time
+	uploaded []string // имена первых span'ов доставленных батчей
+}
+
+func (c *fakeClient) Start(context.Context) error { return nil }
+func (c *fakeClient) Stop(context.Context) error  { return nil }
+
+func (c *fakeClient) UploadTraces(_ context.Context, protoSpans []*tracepb.ResourceSpans) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.attempts = append(c.attempts, time.Now())
+	if c.fail != 0 {
+		c.fail--
+		return errors.New("backend unavailable")
+	}
+	c.uploaded = append(c.uploaded, protoSpans[0].GetScopeSpans()[0].GetSpans()[0].GetName())
+	return nil
+}
+
+func (c *fakeClient) delivered() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string(nil), c.uploaded...)
+}
+
+// batch возвращает батч из spans span'ов, батчи с одинаковым числом span'ов и длиной name одного размера
+func batch(name string, spans int) []*tracepb.ResourceSpans {
+	var ss tracepb.ScopeSpans
+	for i := 0; i < spans; i++ {
+		ss.Spans = append(ss.Spans, &tracepb.Span{Name: name, TraceId: make([]byte, 16), SpanId: make([]byte, 8)})
+	}
+	return []*tracepb.ResourceSpans{{ScopeSpans: []*tracepb.ScopeSpans{&ss}}}
+}
+
+func batchSize(t *testing.T, protoSpans []*tracepb.ResourceSpans) int64 {
+	t.Helper()
+	data, err := proto.Marshal(&tracepb.TracesData{ResourceSpans: protoSpans})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return int64(len(data))
+}
+
+func spoolFiles(t *testing.T, dir string) int {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return len(entries)
+}
+
+// waitStats ждёт, пока счётчики буфера не станут want
+func waitStats(t *testing.T, s *spoolClient, want SpoolStats) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for s.Stats() != want {
+		if time.Now().After(deadline) {
+			t.Fatalf("spool stats = %+v, want %+v", s.Stats(), want)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func newTestSpool(t *testing.T, client *fakeClient, dir string, maxBytes int64) *spoolClient {
+	t.Helper()
+	s, err := newSpoolClient(client, dir, maxBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func startSpool(t *testing.T, s *spoolClient) {
+	t.Helper()
+	if err := s.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Stop(context.Background()) })
+}
+
+func TestSpoolEvictsOldestBatchesOverLimit(t *testing.T) {
+	dir := t.TempDir()
+	size := batchSize(t, batch("a", 2))
+	// Без Start повторной отправки нет, батчи только копятся
+	s := newTestSpool(t, &fakeClient{fail: -1}, dir, 2*size)
+
+	for _, name := range []string{"a", "b", "c"} {
+		if err := s.UploadTraces(context.Background(), batch(name, 2)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got, want := s.Stats(), (SpoolStats{Queued: 4, Dropped: 2, Bytes: 2 * size}); got != want {
+		t.Errorf("stats = %+v, want %+v", got, want)
+	}
+	if got := spoolFiles(t, dir); got != 2 {
+		t.Errorf("%d files in spool dir, want 2", got)
+	}
+
+	// Батч больше всего лимита не пишется
+	if err := s.UploadTraces(context.Background(), batch("huge", 5)); err == nil {
+		t.Error("batch over spool limit was accepted")
+	}
+	if got := s.Stats().Dropped; got != 7 {
+		t.Errorf("dropped = %d, want 7", got)
+	}
+}
+
+func TestSpoolDoesNotEvictReplayingFile(t *testing.T) {
+	dir := t.TempDir()
+	size := batchSize(t, batch("a", 1))
+	client := &fakeClient{fail: -1}
+	s := newTestSpool(t, client, dir, 2*size)
+
+	for _, name := range []string{"a", "b"} {
+		if err := s.UploadTraces(context.Background(), batch(name, 1)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Первый файл отправляется повторно, вытеснение выбрасывает второй
+	replaying, _ := s.take()
+	if err := s.UploadTraces(context.Background(), batch("c", 1)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, replaying.name)); err != nil {
+		t.Fatalf("replaying file was evicted: %v", err)
+	}
+	// Без места отправляемого файла батч не помещается, он выбрасывается и ничего не вытесняет
+	if err := s.UploadTraces(context.Background(), batch("d", 2)); err == nil {
+		t.Error("batch that fits only without replaying file was accepted")
+	}
+
+	client.fail = 0
+	if err := s.replay(replaying); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := s.Stats(), (SpoolStats{Queued: 1, Sent: 1, Dropped: 3, Bytes: size}); got != want {
+		t.Errorf("stats = %+v, want %+v", got, want)
+	}
+}
+
+func TestSpoolReplayBacksOff(t *testing.T) {
+	minBackoff, maxBackoff := spoolMinBackoff, spoolMaxBackoff
+	spoolMinBackoff, spoolMaxBackoff = 20*time.Millisecond, 60*time.Millisecond
+	t.Cleanup(func() { spoolMinBackoff, spoolMaxBackoff = minBackoff, maxBackoff })
+
+	// Первая отправка и три повтора неудачные
+	client := &fakeClient{fail: 4}
+	s := newTestSpool(t, client, t.TempDir(), 1<<20)
+	startSpool(t, s)
+
+	if err := s.UploadTraces(context.Background(), batch("first", 3)); err != nil {
+		t.Fatal(err)
+	}
+	waitStats(t, s, SpoolStats{Sent: 3})
+
+	client.mu.Lock()
+	attempts := client.attempts
+	client.mu.Unlock()
+	if len(attempts) != 5 {
+		t.Fatalf("%d upload attempts, want 5", len(attempts))
+	}
+	// После неудачных повторов задержка удваивается до максимума, jitter - не больше 20%
+	for i, want := range []time.Duration{20 * time.Millisecond, 40 * time.Millisecond, 60 * time.Millisecond} {
+		if gap := attempts[i+2].Sub(attempts[i+1]); gap < want*4/5 {
+			t.Errorf("retry #%d after %v, want at least %v", i+1, gap, want*4/5)
+		}
+	}
+}
+
+func TestSpoolReplaysFilesLeftAfterRestart(t *testing.T) {
+	dir := t.TempDir()
+	first := newTestSpool(t, &fakeClient{fail: -1}, dir, 1<<20)
+	for i, name := range []string{"first", "second", "third"} {
+		if err := first.UploadTraces(context.Background(), batch(name, i+1)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	bytes := first.Stats().Bytes
+
+	client := &fakeClient{}
+	restarted := newTestSpool(t, client, dir, 1<<20)
+	if got, want := restarted.Stats(), (SpoolStats{Queued: 6, Bytes: bytes}); got != want {
+		t.Fatalf("stats after restart = %+v, want %+v", got, want)
+	}
+	startSpool(t, restarted)
+	waitStats(t, restarted, SpoolStats{Sent: 6})
+	if got, want := client.delivered(), []string{"first", "second", "third"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("replayed batches = %q, want %q in order of writing", got, want)
+	}
+	if got := spoolFiles(t, dir); got != 0 {
+		t.Errorf("%d files left in spool dir", got)
+	}
+}
+
+func TestSpoolDropsCorruptedFiles(t *testing.T) {
+	dir := t.TempDir()
+	data, err := proto.Marshal(&tracepb.TracesData{ResourceSpans: batch("truncated", 4)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string][]byte{
+		fmt.Sprintf("%020d-%06d-%d%s", 1, 1, 2, spoolFileExt): []byte("not protobuf"),
+		fmt.Sprintf("%020d-%06d-%d%s", 2, 2, 4, spoolFileExt): data[:len(data)-3],
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), content, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Без числа span'ов в имени файл не из буфера и пропускается
+	if err := os.WriteFile(filepath.Join(dir, "notes"+spoolFileExt), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	client := &fakeClient{}
+	s := newTestSpool(t, client, dir, 1<<20)
+	startSpool(t, s)
+	if err := s.UploadTraces(context.Background(), batch("valid", 1)); err != nil {
+		t.Fatal(err)
+	}
+	// Пока на диске есть батчи, новый батч тоже идёт через буфер
+	waitStats(t, s, SpoolStats{Sent: 1, Dropped: 6})
+	if got := client.delivered(); !reflect.DeepEqual(got, []string{"valid"}) {
+		t.Errorf("delivered batches = %q, want only the valid one", got)
+	}
+	if got := spoolFiles(t, dir); got != 1 {
+		t.Errorf("%d files in spool dir, want only the unrelated one", got)
+	}
+}
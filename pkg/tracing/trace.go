@@ -74,11 +74,16 @@ func NewSpan(ctx context.Context, name string) (context.Context, Span) {
 }
 
 // TraceLogger returns logger with traceID if there is span in context
-// otherwise it returns default logger
+// otherwise it returns default logger. Logger has requestID field if it is in ctx,
+// and writes debug logs if debug mode is enabled for ctx.
 func TraceLogger(ctx context.Context) *logging.Logger {
+	logger := logging.GetDefault()
+	if requestID := RequestIDFromContext(ctx); requestID != "" {
+		logger = logger.With(slog.String("requestID", requestID))
+	}
 	span := trace.SpanFromContext(ctx)
-	if !span.IsRecording() {
-		return logging.GetDefault()
+	if span.IsRecording() {
+		logger = logger.With(slog.String("traceID", span.SpanContext().TraceID().String()))
 	}
-	return logging.NewWith(slog.String("traceID", span.SpanContext().TraceID().String()))
+	return logger.WithContext(ctx)
 }
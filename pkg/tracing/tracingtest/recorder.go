@@ -0,0 +1,362 @@
+// Package tracingtest records spans in memory so tests can assert on the traces
+// produced by handlers without a running Tempo.
+package tracingtest
+
+import (
+	"context"
+	"fmt"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"log/slog"
+	"otel-jaeger-learn/pkg/tracing"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+const shutdownTimeout = 5 * time.Second
+
+// Span is an ended span captured by Recorder
+type Span struct {
+	tracetest.SpanStub
+}
+
+// ID returns span id of the span
+func (s Span) ID() trace.SpanID {
+	return s.SpanContext.SpanID()
+}
+
+// TraceID returns trace id of the span
+func (s Span) TraceID() trace.TraceID {
+	return s.SpanContext.TraceID()
+}
+
+// Attr returns value of the span attribute with the given key
+func (s Span) Attr(key string) (attribute.Value, bool) {
+	for _, kv := range s.Attributes {
+		if string(kv.Key) == key {
+			return kv.Value, true
+		}
+	}
+	return attribute.Value{}, false
+}
+
+// Event returns the first span event with the given name
+func (s Span) Event(name string) (sdktrace.Event, bool) {
+	for _, e := range s.Events {
+		if e.Name == name {
+			return e, true
+		}
+	}
+	return sdktrace.Event{}, false
+}
+
+// EventAttr returns the event attribute as tracing.Span.AddEvent records attr:
+// a string attribute with the value in slog "key=value" form
+func EventAttr(attr slog.Attr) attribute.KeyValue {
+	return attribute.String(attr.Key, attr.String())
+}
+
+// EventValue returns value of the attribute key of an event recorded by tracing.Span.AddEvent,
+// without the "key=" prefix
+func EventValue(event sdktrace.Event, key string) (string, bool) {
+	for _, kv := range event.Attributes {
+		if string(kv.Key) == key {
+			return strings.TrimPrefix(kv.Value.Emit(), key+"="), true
+		}
+	}
+	return "", false
+}
+
+// Recorder keeps every span ended while it is installed
+type Recorder struct {
+	t        testing.TB
+	exporter *tracetest.InMemoryExporter
+	leaks    *tracing.LeakDetector
+	provider *sdktrace.TracerProvider
+}
+
+// Install replaces global TracerProvider and propagator with in-memory ones for the duration of the test.
+// On cleanup the test fails if some span was started but not ended, and the previous globals are restored.
+func Install(t testing.TB) *Recorder {
+	t.Helper()
+
+	exporter := tracetest.NewInMemoryExporter()
+	leaks := tracing.NewLeakDetector(0, func([]tracing.LeakedSpan) {})
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithSyncer(exporter),
+		sdktrace.WithSpanProcessor(leaks),
+		sdktrace.WithSampler(sdktrace.AlwaysSample()),
+	)
+
+	prevProvider := otel.GetTracerProvider()
+	prevPropagator := otel.GetTextMapPropagator()
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	t.Cleanup(func() {
+		leaks.AssertNoLeaks(t)
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		_ = provider.Shutdown(ctx)
+		otel.SetTracerProvider(prevProvider)
+		otel.SetTextMapPropagator(prevPropagator)
+	})
+
+	return &Recorder{t: t, exporter: exporter, leaks: leaks, provider: provider}
+}
+
+// Provider returns installed TracerProvider, useful for instrumentations that take it explicitly
+func (r *Recorder) Provider() *sdktrace.TracerProvider {
+	return r.provider
+}
+
+// Reset forgets all recorded spans
+func (r *Recorder) Reset() {
+	r.exporter.Reset()
+}
+
+// Spans returns all ended spans in the order they were ended
+func (r *Recorder) Spans() []Span {
+	stubs := r.exporter.GetSpans()
+	spans := make([]Span, 0, len(stubs))
+	for _, stub := range stubs {
+		spans = append(spans, Span{SpanStub: stub})
+	}
+	return spans
+}
+
+// SpansByName returns all ended spans with the given name
+func (r *Recorder) SpansByName(name string) []Span {
+	var found []Span
+	for _, s := range r.Spans() {
+		if s.Name == name {
+			found = append(found, s)
+		}
+	}
+	return found
+}
+
+// Span returns the only ended span with the given name, the test fails if there is none or more than one
+func (r *Recorder) Span(name string) Span {
+	r.t.Helper()
+	found := r.SpansByName(name)
+	if len(found) != 1 {
+		r.t.Fatalf("expected exactly one span %q, got %d; recorded spans:\n%s", name, len(found), r.Dump())
+	}
+	return found[0]
+}
+
+// WaitForSpan waits until span with the given name is ended and returns it.
+// Server spans are ended after the response is written, so the client may see the response earlier.
+func (r *Recorder) WaitForSpan(name string, timeout time.Duration) Span {
+	r.t.Helper()
+	deadline := time.Now().Add(timeout)
+	for {
+		if found := r.SpansByName(name); len(found) > 0 {
+			return found[0]
+		}
+		if time.Now().After(deadline) {
+			r.t.Fatalf("span %q was not ended within %s; recorded spans:\n%s", name, timeout, r.Dump())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// Trace returns all spans of the trace
+func (r *Recorder) Trace(traceID trace.TraceID) []Span {
+	var found []Span
+	for _, s := range r.Spans() {
+		if s.TraceID() == traceID {
+			found = append(found, s)
+		}
+	}
+	return found
+}
+
+// TraceIDs returns ids of all recorded traces in order of appearance
+func (r *Recorder) TraceIDs() []trace.TraceID {
+	var ids []trace.TraceID
+	seen := make(map[trace.TraceID]bool)
+	for _, s := range r.Spans() {
+		if !seen[s.TraceID()] {
+			seen[s.TraceID()] = true
+			ids = append(ids, s.TraceID())
+		}
+	}
+	return ids
+}
+
+// Roots returns spans whose parent was not recorded (remote parents count as missing)
+func (r *Recorder) Roots() []Span {
+	spans := r.Spans()
+	known := make(map[trace.SpanID]bool, len(spans))
+	for _, s := range spans {
+		known[s.ID()] = true
+	}
+
+	var roots []Span
+	for _, s := range spans {
+		if !s.Parent.IsValid() || !known[s.Parent.SpanID()] {
+			roots = append(roots, s)
+		}
+	}
+	return roots
+}
+
+// Parent returns recorded parent of the span
+func (r *Recorder) Parent(s Span) (Span, bool) {
+	if !s.Parent.IsValid() {
+		return Span{}, false
+	}
+	for _, p := range r.Spans() {
+		if p.ID() == s.Parent.SpanID() && p.TraceID() == s.TraceID() {
+			return p, true
+		}
+	}
+	return Span{}, false
+}
+
+// Children returns direct children of the span ordered by start time
+func (r *Recorder) Children(parent Span) []Span {
+	var children []Span
+	for _, s := range r.Spans() {
+		if s.Parent.SpanID() == parent.ID() && s.TraceID() == parent.TraceID() {
+			children = append(children, s)
+		}
+	}
+	sort.SliceStable(children, func(i, j int) bool { return children[i].StartTime.Before(children[j].StartTime) })
+	return children
+}
+
+// Descendants returns all spans below the given one, depth first
+func (r *Recorder) Descendants(parent Span) []Span {
+	var found []Span
+	for _, child := range r.Children(parent) {
+		found = append(found, child)
+		found = append(found, r.Descendants(child)...)
+	}
+	return found
+}
+
+// Dump returns printable trees of all recorded traces
+func (r *Recorder) Dump() string {
+	var sb strings.Builder
+	for _, root := range r.Roots() {
+		r.writeTree(&sb, root, 0)
+	}
+	return sb.String()
+}
+
+func (r *Recorder) writeTree(sb *strings.Builder, s Span, depth int) {
+	fmt.Fprintf(sb, "%s%s [%s] %s\n", strings.Repeat("  ", depth), s.Name, s.SpanKind, s.Status.Code)
+	for _, child := range r.Children(s) {
+		r.writeTree(sb, child, depth+1)
+	}
+}
+
+// AssertChildOf fails the test if child is not a direct child of parent
+func (r *Recorder) AssertChildOf(child, parent Span) {
+	r.t.Helper()
+	if child.TraceID() != parent.TraceID() || child.Parent.SpanID() != parent.ID() {
+		r.t.Errorf("span %q is not a child of %q; recorded spans:\n%s", child.Name, parent.Name, r.Dump())
+	}
+}
+
+// AssertSingleTrace fails the test if recorded spans belong to more than one trace and returns its id
+func (r *Recorder) AssertSingleTrace() trace.TraceID {
+	r.t.Helper()
+	ids := r.TraceIDs()
+	if len(ids) != 1 {
+		r.t.Fatalf("expected exactly one trace, got %d; recorded spans:\n%s", len(ids), r.Dump())
+	}
+	return ids[0]
+}
+
+// AssertAttribute fails the test if the span has no attribute key with value want
+func (r *Recorder) AssertAttribute(s Span, key string, want any) {
+	r.t.Helper()
+	got, ok := s.Attr(key)
+	if !ok {
+		r.t.Errorf("span %q has no attribute %q", s.Name, key)
+		return
+	}
+	if !valueEqual(got, want) {
+		r.t.Errorf("span %q attribute %q = %v, want %v", s.Name, key, got.AsInterface(), want)
+	}
+}
+
+// AssertEvent fails the test if the span has no event name with all the given attributes and returns the event
+func (r *Recorder) AssertEvent(s Span, name string, attrs ...attribute.KeyValue) sdktrace.Event {
+	r.t.Helper()
+	event, ok := s.Event(name)
+	if !ok {
+		r.t.Errorf("span %q has no event %q", s.Name, name)
+		return event
+	}
+
+	for _, want := range attrs {
+		found := false
+		for _, got := range event.Attributes {
+			if got.Key == want.Key {
+				found = true
+				if got.Value != want.Value {
+					r.t.Errorf("span %q event %q attribute %q = %v, want %v",
+						s.Name, name, want.Key, got.Value.AsInterface(), want.Value.AsInterface())
+				}
+			}
+		}
+		if !found {
+			r.t.Errorf("span %q event %q has no attribute %q", s.Name, name, want.Key)
+		}
+	}
+	return event
+}
+
+// AssertNoEvent fails the test if the span has event name
+func (r *Recorder) AssertNoEvent(s Span, name string) {
+	r.t.Helper()
+	if _, ok := s.Event(name); ok {
+		r.t.Errorf("span %q has unexpected event %q", s.Name, name)
+	}
+}
+
+// AssertStatus fails the test if the span status code is not code
+func (r *Recorder) AssertStatus(s Span, code codes.Code) {
+	r.t.Helper()
+	if s.Status.Code != code {
+		r.t.Errorf("span %q status = %s (%q), want %s", s.Name, s.Status.Code, s.Status.Description, code)
+	}
+}
+
+// AssertLinked fails the test if the span has no link to target
+func (r *Recorder) AssertLinked(s Span, target trace.SpanContext) {
+	r.t.Helper()
+	for _, link := range s.Links {
+		if link.SpanContext.TraceID() == target.TraceID() && link.SpanContext.SpanID() == target.SpanID() {
+			return
+		}
+	}
+	r.t.Errorf("span %q has no link to trace %s span %s", s.Name, target.TraceID(), target.SpanID())
+}
+
+func valueEqual(got attribute.Value, want any) bool {
+	switch w := want.(type) {
+	case attribute.Value:
+		return got == w
+	case int:
+		want = int64(w)
+	case int32:
+		want = int64(w)
+	case float32:
+		want = float64(w)
+	}
+	return reflect.DeepEqual(got.AsInterface(), want)
+}
@@ -0,0 +1,64 @@
+package tracingtest
+
+import (
+	"context"
+	"errors"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"log/slog"
+	"otel-jaeger-learn/pkg/tracing"
+	"testing"
+)
+
+func TestRecorderCapturesSpanTree(t *testing.T) {
+	rec := Install(t)
+
+	ctx, parent := tracing.NewSpan(context.Background(), "parent")
+	_, child := tracing.NewSpan(ctx, "child")
+	child.AddEvent("Price Calculated", slog.Float64("price", 10.5))
+	child.AddError("db error", errors.New("boom"))
+	child.End()
+	parent.End()
+
+	traceID := rec.AssertSingleTrace()
+	p := rec.Span("parent")
+	c := rec.Span("child")
+
+	rec.AssertChildOf(c, p)
+	rec.AssertEvent(c, "Price Calculated", EventAttr(slog.Float64("price", 10.5)))
+	event, _ := c.Event("Price Calculated")
+	if v, _ := EventValue(event, "price"); v != "10.5" {
+		t.Errorf("EventValue(price) = %q, want 10.5", v)
+	}
+	rec.AssertEvent(c, "db error", attribute.String("error", "boom"))
+	rec.AssertStatus(c, codes.Error)
+	rec.AssertStatus(p, codes.Unset)
+
+	if len(rec.Roots()) != 1 || rec.Roots()[0].Name != "parent" {
+		t.Errorf("unexpected roots:\n%s", rec.Dump())
+	}
+	if got := len(rec.Trace(traceID)); got != 2 {
+		t.Errorf("trace has %d spans, want 2", got)
+	}
+}
+
+func TestLeakDetectorReportsUnendedSpan(t *testing.T) {
+	detector := tracing.NewLeakDetector(0, nil)
+	rec := Install(t)
+	rec.Provider().RegisterSpanProcessor(detector)
+
+	_, leaked := tracing.NewSpan(context.Background(), "leaked")
+	_, ended := tracing.NewSpan(context.Background(), "ended")
+	ended.End()
+
+	leaks := detector.Leaks()
+	if len(leaks) != 1 || leaks[0].Name != "leaked" {
+		t.Fatalf("expected one leaked span, got %v", leaks)
+	}
+	if leaks[0].Stack == "" {
+		t.Error("leaked span has no creation stack")
+	}
+
+	leaked.End()
+	detector.AssertNoLeaks(t)
+}
@@ -0,0 +1,84 @@
+package tracingtest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"otel-jaeger-learn/pkg/tracing"
+	"sync"
+	"testing"
+)
+
+// SamplingServer - фейковый Jaeger-совместимый эндпоинт удалённого сэмплирования
+type SamplingServer struct {
+	URL string
+
+	mu         sync.Mutex
+	strategies map[string]tracing.JaegerSamplingStrategy
+	requests   []string
+}
+
+// NewSamplingServer starts sampling server that returns strategy for any service, it is closed on test cleanup
+func NewSamplingServer(t testing.TB, strategy tracing.JaegerSamplingStrategy) *SamplingServer {
+	t.Helper()
+	s := &SamplingServer{strategies: map[string]tracing.JaegerSamplingStrategy{"": strategy}}
+
+	srv := httptest.NewServer(http.HandlerFunc(s.handle))
+	t.Cleanup(srv.Close)
+	s.URL = srv.URL + "/sampling"
+	return s
+}
+
+// SetStrategy replaces strategy for the service, empty service means any service
+func (s *SamplingServer) SetStrategy(service string, strategy tracing.JaegerSamplingStrategy) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.strategies[service] = strategy
+}
+
+// Requests returns service names from all received requests
+func (s *SamplingServer) Requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.requests...)
+}
+
+func (s *SamplingServer) handle(w http.ResponseWriter, r *http.Request) {
+	service := r.URL.Query().Get("service")
+
+	s.mu.Lock()
+	s.requests = append(s.requests, service)
+	strategy, ok := s.strategies[service]
+	if !ok {
+		strategy, ok = s.strategies[""]
+	}
+	s.mu.Unlock()
+
+	if !ok || service == "" {
+		http.Error(w, "unknown service", http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(strategy)
+}
+
+// Probabilistic returns strategy that samples ratio of traces with optional per operation ratios
+func Probabilistic(ratio float64, operations map[string]float64) tracing.JaegerSamplingStrategy {
+	strategy := tracing.JaegerSamplingStrategy{
+		StrategyType:          "PROBABILISTIC",
+		ProbabilisticSampling: &tracing.JaegerProbabilistic{SamplingRate: ratio},
+	}
+	if len(operations) == 0 {
+		return strategy
+	}
+
+	strategy.OperationSampling = &tracing.JaegerPerOperationRate{DefaultSamplingProbability: ratio}
+	for op, opRatio := range operations {
+		strategy.OperationSampling.PerOperationStrategies = append(strategy.OperationSampling.PerOperationStrategies,
+			tracing.JaegerOperationStrategy{
+				Operation:             op,
+				ProbabilisticSampling: tracing.JaegerProbabilistic{SamplingRate: opRatio},
+			})
+	}
+	return strategy
+}
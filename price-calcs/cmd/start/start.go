@@ -1,14 +1,19 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"log"
 	"otel-jaeger-learn/pkg/logging"
+	"otel-jaeger-learn/pkg/shedding"
 	"otel-jaeger-learn/pkg/tracing"
 	"price-calcs/config"
 	"price-calcs/handler"
+	"price-calcs/pricing"
+	"price-calcs/rates"
 	"price-calcs/storage/pricespg"
+	"time"
 )
 
 func main() {
@@ -27,20 +32,67 @@ func main() {
 	router := gin.Default()
 	// Будет принимать из запроса или создавать новый трейс при каждом запросе
 	tracing.AddOtelMiddleware(router, "price-calcs")
+	// /metrics и страница /debug/tracing с состоянием экспорта span'ов
+	tracing.AddDebugRoutes(router)
+	// Ограничение одновременных запросов, /metrics и /debug/tracing зарегистрированы раньше и не ограничиваются
+	if err := shedding.AddMiddleware(router, cfg.SheddingCfg); err != nil {
+		log.Fatalf("failed to set up load shedding: %v", err)
+	}
 
 	bookingStorage, err := pricespg.NewStorage(cfg.PgAddr, cfg.PgDb, cfg.PgUser, cfg.PgPass)
 	if err != nil {
 		log.Panicf("fail to create storage: %v", err)
 	}
 
-	priceHandler := handler.NewPricesHnd(bookingStorage)
+	rules, err := loadPricingRules(cfg, bookingStorage)
+	if err != nil {
+		log.Fatalf("failed to load pricing rules: %v", err)
+	}
+
+	var rateProvider rates.Provider = bookingStorage
+	if cfg.CurrencyRatesFile != "" {
+		if rateProvider, err = rates.LoadFile(cfg.CurrencyRatesFile); err != nil {
+			log.Fatalf("failed to load currency rates: %v", err)
+		}
+	}
+
+	priceHandler, err := handler.NewPricesHnd(bookingStorage, rules, rateProvider, cfg)
+	if err != nil {
+		log.Fatalf("failed to create price handler: %v", err)
+	}
 
 	// Routes
-	router.GET("/booking-price", func(c *gin.Context) { priceHandler.GetBookingPrice(c) })
+	handler.RegisterRoutes(router, priceHandler)
 
-	// Start HTTP server
+	// Start HTTP server, по SIGINT/SIGTERM он останавливается и отправляет оставшиеся span'ы
 	addr := fmt.Sprintf(":%s", cfg.HttpPort)
-	if err := router.Run(addr); err != nil {
-		log.Fatalf("failed to start HTTP server: %v", err)
+	if err := tracing.Serve(addr, router); err != nil {
+		log.Fatalf("HTTP server stopped with error: %v", err)
+	}
+}
+
+// loadPricingRules берёт правила из PRICING_RULES_FILE, иначе из таблицы pricing_rules, иначе pricing.DefaultRules
+func loadPricingRules(cfg config.Config, storage *pricespg.Storage) (*pricing.Engine, error) {
+	loc, err := time.LoadLocation(cfg.PricingTimezone)
+	if err != nil {
+		return nil, err
+	}
+
+	var rules []pricing.RuleConfig
+	source := "table pricing_rules"
+	if cfg.PricingRulesFile != "" {
+		source = cfg.PricingRulesFile
+		rules, err = pricing.LoadFile(cfg.PricingRulesFile)
+	} else {
+		rules, err = storage.GetPricingRules(context.Background())
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(rules) == 0 {
+		source = "defaults"
+		rules = pricing.DefaultRules()
 	}
+	log.Printf("pricing rules: %d from %s", len(rules), source)
+	return pricing.NewEngine(rules, loc)
 }
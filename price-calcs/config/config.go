@@ -4,17 +4,28 @@ import (
 	"github.com/caarlos0/env/v11"
 	"log"
 	"otel-jaeger-learn/pkg/logging"
+	"otel-jaeger-learn/pkg/quote"
+	"otel-jaeger-learn/pkg/shedding"
 	"otel-jaeger-learn/pkg/tracing"
 )
 
 type Config struct {
-	HttpPort   string `env:"HTTP_PORT" envDefault:"8080"`
-	PgUser     string `env:"PG_USER" envDefault:"postgres"`
-	PgPass     string `env:"PG_PASS" envDefault:"postgres"`
-	PgAddr     string `env:"PG_ADDR" envDefault:"localhost:5432"`
-	PgDb       string `env:"PG_DB" envDefault:"postgres"`
-	LoggingCfg logging.Config
-	TracingCfg tracing.Config
+	HttpPort string `env:"HTTP_PORT" envDefault:"8080"`
+	PgUser   string `env:"PG_USER" envDefault:"postgres"`
+	PgPass   string `env:"PG_PASS" envDefault:"postgres"`
+	PgAddr   string `env:"PG_ADDR" envDefault:"localhost:5432"`
+	PgDb     string `env:"PG_DB" envDefault:"postgres"`
+	// JSON со списком правил расчёта цены; если не задан - правила из таблицы pricing_rules,
+	// а если и она пуста - pricing.DefaultRules
+	PricingRulesFile string `env:"PRICING_RULES_FILE"`
+	// Часовой пояс, в котором правилам surge задано время суток и дни недели
+	PricingTimezone string `env:"PRICING_TIMEZONE" envDefault:"UTC"`
+	// JSON со списком курсов валют; если не задан - курсы из таблицы currency_rates
+	CurrencyRatesFile string `env:"CURRENCY_RATES_FILE"`
+	QuoteCfg          quote.Config
+	LoggingCfg        logging.Config
+	TracingCfg        tracing.Config
+	SheddingCfg       shedding.Config
 }
 
 func LoadConfig() Config {
@@ -1,63 +1,174 @@
 package handler
 
 import (
-	"fmt"
+	"context"
+	"errors"
 	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"log/slog"
-	"math/rand"
 	"net/http"
-	"otel-jaeger-learn/pkg/logging"
+	"otel-jaeger-learn/pkg/money"
+	"otel-jaeger-learn/pkg/quote"
 	"otel-jaeger-learn/pkg/tracing"
+	"price-calcs/config"
+	"price-calcs/pricing"
+	"price-calcs/rates"
 	"price-calcs/storage/pricespg"
+	"strconv"
+	"sync/atomic"
+	"time"
 )
 
+// Storage - хранилище цен и скидок водителей (pricespg.Storage или фейк в тестах)
+type Storage interface {
+	GetDriverPrice(ctx context.Context, driverId string) (money.Money, error)
+	GetDriverDiscounts(ctx context.Context, driverId string) ([]int, error)
+}
+
 type PricesHnd struct {
-	db *pricespg.Storage
+	db     Storage
+	cfg    config.Config
+	quotes *quote.Signer
+	rules  *pricing.Engine
+	rates  rates.Provider
+	// Счётчик выбора водителя, если он не задан в запросе
+	nextDriver atomic.Uint64
+}
+
+func NewPricesHnd(db Storage, rules *pricing.Engine, rates rates.Provider, cfg config.Config) (*PricesHnd, error) {
+	quotes, err := quote.NewSigner(cfg.QuoteCfg.Key)
+	if err != nil {
+		return nil, err
+	}
+	return &PricesHnd{db: db, cfg: cfg, quotes: quotes, rules: rules, rates: rates}, nil
 }
 
-func NewPricesHnd(db *pricespg.Storage) *PricesHnd {
-	return &PricesHnd{db: db}
+// pickDriver выбирает водителей по кругу: 1, 2, ..., DRIVERS_COUNT, 1, ...
+func (b *PricesHnd) pickDriver() string {
+	n := b.nextDriver.Add(1) - 1
+	return pricespg.NthDriver(n)
 }
 
 func (b *PricesHnd) GetBookingPrice(c *gin.Context) {
 	ctx := c.Request.Context()
-	logging.Debug("GetBookingPrice()")
+	tracing.TraceLogger(ctx).Debug("GetBookingPrice()")
 
 	// Создаём новый span на основе текущего контекста
 	spanCtx, span := tracing.NewSpan(ctx, "Booking Price Calculation")
 	defer span.End() // Обязательно, иначе будет висеть в памяти
 
-	// Рандомный водятел
-	driverId := fmt.Sprint(rand.Intn(pricespg.DRIVERS_COUNT))
+	currency, ok := requestedCurrency(c, &span)
+	if !ok {
+		return
+	}
+	driverId, _, breakdown, ok := b.calcPrice(c, spanCtx, &span)
+	if !ok {
+		return
+	}
+	// Как и в предложении, цена переводится по курсу на момент расчёта
+	price, rate, ok := b.convertPrice(c, spanCtx, &span, breakdown.Total, currency, time.Now())
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"price": price, "original_price": breakdown.Total, "rate": rate.Value, "driver_id": driverId, "breakdown": breakdown})
+}
+
+// calcPrice считает цену водителя из запроса (driver_id, если не задан - выбираем сами) по правилам расчёта
+// на время бронирования из запроса (time, RFC3339, по умолчанию - сейчас) и возвращает это время.
+// При ошибке отвечает клиенту сам и возвращает ok = false
+func (b *PricesHnd) calcPrice(c *gin.Context, spanCtx context.Context, span *tracing.Span) (driverId string, at time.Time, breakdown pricing.Breakdown, ok bool) {
+	ctx := c.Request.Context()
+
+	// Водитель из запроса, если не задан - выбираем сами
+	driverId = c.Query("driver_id")
+	if driverId == "" {
+		driverId = b.pickDriver()
+		span.AddEvent("driver picked", slog.String("driver.id", driverId))
+	} else if _, err := strconv.Atoi(driverId); err != nil {
+		span.AddError("invalid driver id", err)
+		c.JSON(http.StatusBadRequest, tracing.ErrorBody(ctx, "invalid driver id"))
+		return "", at, breakdown, false
+	}
+	trace.SpanFromContext(spanCtx).SetAttributes(attribute.String("driver.id", driverId))
+
+	at = time.Now()
+	if raw := c.Query("time"); raw != "" {
+		var err error
+		if at, err = time.Parse(time.RFC3339, raw); err != nil {
+			span.AddError("invalid booking time", err)
+			c.JSON(http.StatusBadRequest, tracing.ErrorBody(ctx, "invalid time, want RFC3339"))
+			return "", at, breakdown, false
+		}
+	}
+
+	price, ok := b.driverPrice(c, spanCtx, span, driverId)
+	if !ok {
+		return "", at, breakdown, false
+	}
+	discounts, ok := b.driverDiscounts(c, spanCtx, span, driverId)
+	if !ok {
+		return "", at, breakdown, false
+	}
+
+	breakdown = evaluate(span, b.rules, pricing.Input{BasePrice: price, Discounts: discounts, Time: at})
+	return driverId, at, breakdown, true
+}
+
+// driverPrice читает цену водителя из базы, при ошибке отвечает клиенту сам
+func (b *PricesHnd) driverPrice(c *gin.Context, spanCtx context.Context, span *tracing.Span, driverId string) (money.Money, bool) {
+	ctx := c.Request.Context()
 
 	// Получем цену водителя из базы данных
 	price, err := b.db.GetDriverPrice(spanCtx, driverId)
+	if errors.Is(err, pricespg.ErrDriverNotFound) {
+		span.AddEvent("driver not found")
+		c.JSON(http.StatusNotFound, tracing.ErrorBody(ctx, "driver not found"))
+		return money.Money{}, false
+	}
 	if err != nil {
 		// Добавляем информацию об ошибке в span
 		span.AddError("db.GetDriverPrice returns error", err)
-		logging.ErrorErr("db.GetDriverPrice returns error", err)
+		tracing.TraceLogger(ctx).ErrorErr("db.GetDriverPrice returns error", err)
 
-		c.JSON(http.StatusInternalServerError, gin.H{"message": "db.GetDriverPrice returns error"})
+		c.JSON(tracing.ErrorStatus(ctx, http.StatusInternalServerError), tracing.ErrorBody(ctx, "db.GetDriverPrice returns error"))
+		return money.Money{}, false
 	}
+	return price, true
+}
+
+// driverDiscounts читает скидки водителя из базы, при ошибке отвечает клиенту сам
+func (b *PricesHnd) driverDiscounts(c *gin.Context, spanCtx context.Context, span *tracing.Span, driverId string) ([]int, bool) {
+	ctx := c.Request.Context()
 
 	// Получаем скидки водителя из базы данных
 	discounts, err := b.db.GetDriverDiscounts(spanCtx, driverId)
 	if err != nil {
 		// Добавляем информацию об ошибке в span
 		span.AddError("db.GetDriverDiscounts returns error", err)
-		logging.ErrorErr("db.GetDriverDiscounts returns error", err)
+		tracing.TraceLogger(ctx).ErrorErr("db.GetDriverDiscounts returns error", err)
 
-		c.JSON(http.StatusInternalServerError, gin.H{"message": "db.GetDriverDiscounts returns error"})
+		c.JSON(tracing.ErrorStatus(ctx, http.StatusInternalServerError), tracing.ErrorBody(ctx, "db.GetDriverDiscounts returns error"))
+		return nil, false
 	}
+	return discounts, true
+}
 
-	// Вычисляем общую цену
-	totalPrice := price
-	for _, discount := range discounts {
-		totalPrice -= float64(discount)
+// evaluate считает цену по правилам, каждое сработавшее правило - событие в span'е
+func evaluate(span *tracing.Span, rules *pricing.Engine, in pricing.Input) pricing.Breakdown {
+	breakdown := rules.Evaluate(in)
+	for _, step := range breakdown.Steps {
+		span.AddEvent("pricing rule applied",
+			slog.String("pricing.rule", step.Rule),
+			slog.String("pricing.rule_type", step.Type),
+			slog.String("price.before", step.Before.String()),
+			slog.String("price.after", step.After.String()))
 	}
 
 	// Добавляем информацию что цена посчитана в span и добавляем цену в атрибуты
-	span.AddEvent("Price Calculated", slog.Float64("price", price))
-
-	c.JSON(http.StatusOK, gin.H{"price": totalPrice})
+	span.AddEvent("Price Calculated",
+		slog.Float64("price", breakdown.Total.Float64()),
+		slog.String("price.currency", breakdown.Total.Currency),
+		slog.String("price.base", breakdown.Base.String()))
+	return breakdown
 }
@@ -0,0 +1,127 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"log/slog"
+	"net/http"
+	"otel-jaeger-learn/pkg/money"
+	"otel-jaeger-learn/pkg/quote"
+	"otel-jaeger-learn/pkg/tracing"
+	"price-calcs/pricing"
+	"price-calcs/rates"
+	"time"
+)
+
+// quoteResponse - предложение цены с расшифровкой и его подписанный токен, который клиент передаёт при бронировании
+type quoteResponse struct {
+	quote.Quote
+	Breakdown pricing.Breakdown `json:"breakdown"`
+	Token     string            `json:"token"`
+}
+
+// GetBookingQuote считает цену как GetBookingPrice и выдаёт её подписанным предложением на QUOTE_TTL.
+// Время бронирования time обязательно: цена зависит от него, и booking принимает предложение только на это время.
+// Если задан currency, цена переводится в эту валюту по курсу, действующему на момент выдачи предложения
+func (b *PricesHnd) GetBookingQuote(c *gin.Context) {
+	ctx := c.Request.Context()
+	spanCtx, span := tracing.NewSpan(ctx, "Booking Quote")
+	defer span.End()
+
+	currency, ok := requestedCurrency(c, &span)
+	if !ok {
+		return
+	}
+
+	if c.Query("time") == "" {
+		span.AddEvent("booking time is missing")
+		c.JSON(http.StatusBadRequest, tracing.ErrorBody(ctx, "time is required"))
+		return
+	}
+
+	driverId, at, breakdown, ok := b.calcPrice(c, spanCtx, &span)
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	price, rate, ok := b.convertPrice(c, spanCtx, &span, breakdown.Total, currency, now)
+	if !ok {
+		return
+	}
+
+	q := quote.Quote{
+		ID:            quote.NewID(),
+		DriverID:      driverId,
+		Time:          at.UTC(),
+		Price:         price,
+		OriginalPrice: breakdown.Total,
+		Rate:          rate.Value,
+		ExpiresAt:     now.Add(b.cfg.QuoteCfg.TTL).UTC().Truncate(time.Second),
+	}
+	token, err := b.quotes.Sign(q)
+	if err != nil {
+		span.AddError("signing quote", err)
+		c.JSON(http.StatusInternalServerError, tracing.ErrorBody(ctx, "signing quote"))
+		return
+	}
+
+	trace.SpanFromContext(spanCtx).SetAttributes(attribute.String("quote.id", q.ID))
+	span.AddEvent("quote issued",
+		slog.String("quote.id", q.ID),
+		slog.String("quote.expires_at", q.ExpiresAt.Format(time.RFC3339)))
+	c.JSON(http.StatusOK, quoteResponse{Quote: q, Breakdown: breakdown, Token: token})
+}
+
+// requestedCurrency возвращает валюту из параметра currency (пустая - валюта водителя),
+// при неверном коде отвечает клиенту сам и возвращает ok = false
+func requestedCurrency(c *gin.Context, span *tracing.Span) (string, bool) {
+	currency := c.Query("currency")
+	if currency == "" {
+		return "", true
+	}
+	if err := money.ValidateCurrency(currency); err != nil {
+		span.AddEvent("invalid currency", slog.String("currency", currency))
+		c.JSON(http.StatusBadRequest, tracing.ErrorBody(c.Request.Context(), "invalid currency, want ISO 4217 code"))
+		return "", false
+	}
+	return currency, true
+}
+
+// convertPrice переводит цену в валюту currency (пустая - валюта цены) по курсу на момент at.
+// Курс пишется в атрибуты span'а; при ошибке отвечает клиенту сам и возвращает ok = false
+func (b *PricesHnd) convertPrice(c *gin.Context, spanCtx context.Context, span *tracing.Span, price money.Money, currency string, at time.Time) (money.Money, rates.Rate, bool) {
+	ctx := c.Request.Context()
+
+	if currency == "" || currency == price.Currency {
+		return price, rates.Rate{From: price.Currency, To: price.Currency, Value: 1}, true
+	}
+	rate, err := b.rates.GetRate(spanCtx, price.Currency, currency, at)
+	if errors.Is(err, rates.ErrNoRate) {
+		span.AddError("no conversion rate", err)
+		c.JSON(http.StatusUnprocessableEntity, tracing.ErrorBody(ctx, err.Error()))
+		return price, rate, false
+	}
+	if err != nil {
+		span.AddError("rates.GetRate returns error", err)
+		tracing.TraceLogger(ctx).ErrorErr("rates.GetRate returns error", err)
+		c.JSON(tracing.ErrorStatus(ctx, http.StatusInternalServerError), tracing.ErrorBody(ctx, "rates.GetRate returns error"))
+		return price, rate, false
+	}
+
+	converted := price.Convert(rate.Value, currency)
+	trace.SpanFromContext(spanCtx).SetAttributes(
+		attribute.String("currency.from", rate.From),
+		attribute.String("currency.to", rate.To),
+		attribute.Float64("currency.rate", rate.Value),
+		attribute.String("currency.rate_effective_from", rate.EffectiveFrom.Format(time.RFC3339)),
+	)
+	span.AddEvent("price converted",
+		slog.String("price.original", price.String()),
+		slog.String("price.converted", converted.String()),
+		slog.Float64("currency.rate", rate.Value))
+	return converted, rate, true
+}
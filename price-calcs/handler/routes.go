@@ -0,0 +1,10 @@
+package handler
+
+import "github.com/gin-gonic/gin"
+
+// RegisterRoutes регистрирует маршруты сервиса price-calcs
+func RegisterRoutes(router gin.IRouter, priceHandler *PricesHnd) {
+	router.GET("/booking-price", func(c *gin.Context) { priceHandler.GetBookingPrice(c) })
+	router.GET("/booking-quote", func(c *gin.Context) { priceHandler.GetBookingQuote(c) })
+	router.POST("/price-simulate", func(c *gin.Context) { priceHandler.SimulatePrice(c) })
+}
@@ -0,0 +1,103 @@
+package handler
+
+import (
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"net/http"
+	"otel-jaeger-learn/pkg/money"
+	"otel-jaeger-learn/pkg/tracing"
+	"price-calcs/pricing"
+	"strconv"
+	"time"
+)
+
+// Откуда взяты правила симуляции
+const (
+	rulesSourceCurrent = "current"
+	rulesSourceRequest = "request"
+)
+
+// simulateRequest - тело POST /price-simulate. Не заданные поля берутся как при обычном расчёте:
+// цена и скидки - водителя driver_id из базы, время - текущее, правила - действующие
+type simulateRequest struct {
+	DriverID  string               `json:"driver_id"`
+	Time      time.Time            `json:"time"`
+	BasePrice *money.Money         `json:"base_price"` // {"amount": "1000", "currency": "RUB"}
+	Discounts []int                `json:"discounts"`  // [] - без скидок водителя
+	Rules     []pricing.RuleConfig `json:"rules"`
+}
+
+// SimulatePrice считает цену для гипотетических водителя, времени и правил, ничего не сохраняя,
+// чтобы проверить изменение правил до выкатки
+func (b *PricesHnd) SimulatePrice(c *gin.Context) {
+	ctx := c.Request.Context()
+	spanCtx, span := tracing.NewSpan(ctx, "Price Simulation")
+	defer span.End()
+
+	var req simulateRequest
+	dec := json.NewDecoder(c.Request.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		span.AddError("invalid simulation request", err)
+		c.JSON(http.StatusBadRequest, tracing.ErrorBody(ctx, err.Error()))
+		return
+	}
+	if req.DriverID == "" && req.BasePrice == nil {
+		c.JSON(http.StatusBadRequest, tracing.ErrorBody(ctx, "driver_id or base_price is required"))
+		return
+	}
+	if req.DriverID != "" {
+		if _, err := strconv.Atoi(req.DriverID); err != nil {
+			span.AddError("invalid driver id", err)
+			c.JSON(http.StatusBadRequest, tracing.ErrorBody(ctx, "invalid driver id"))
+			return
+		}
+	}
+
+	rules, source := b.rules, rulesSourceCurrent
+	if req.Rules != nil {
+		var err error
+		if rules, err = b.rules.WithRules(req.Rules); err != nil {
+			span.AddError("invalid pricing rules", err)
+			c.JSON(http.StatusUnprocessableEntity, tracing.ErrorBody(ctx, err.Error()))
+			return
+		}
+		source = rulesSourceRequest
+	}
+	trace.SpanFromContext(spanCtx).SetAttributes(
+		attribute.String("driver.id", req.DriverID),
+		attribute.String("pricing.rules_source", source),
+	)
+
+	in := pricing.Input{Discounts: req.Discounts, Time: req.Time}
+	if in.Time.IsZero() {
+		in.Time = time.Now()
+	}
+	if req.BasePrice != nil {
+		in.BasePrice = *req.BasePrice
+	} else {
+		price, ok := b.driverPrice(c, spanCtx, &span, req.DriverID)
+		if !ok {
+			return
+		}
+		in.BasePrice = price
+	}
+	if in.Discounts == nil && req.DriverID != "" {
+		discounts, ok := b.driverDiscounts(c, spanCtx, &span, req.DriverID)
+		if !ok {
+			return
+		}
+		in.Discounts = discounts
+	}
+
+	breakdown := evaluate(&span, rules, in)
+	c.JSON(http.StatusOK, gin.H{
+		"driver_id": req.DriverID,
+		"time":      in.Time.UTC().Format(time.RFC3339),
+		"price":     breakdown.Total,
+		"breakdown": breakdown,
+		"rules":     source,
+	})
+}
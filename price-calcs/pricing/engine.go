@@ -0,0 +1,102 @@
+package pricing
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"otel-jaeger-learn/pkg/money"
+	"time"
+)
+
+// DefaultMinFare - минимальная цена правил по умолчанию в валюте цены водителя
+const DefaultMinFare = 300
+
+// DefaultRules - прежний расчёт (цена водителя минус его скидки), но не ниже DefaultMinFare,
+// чтобы скидки не делали поездку бесплатной
+func DefaultRules() []RuleConfig {
+	return []RuleConfig{
+		{Type: TypeDriverDiscounts},
+		{Type: TypeMinFare, Amount: DefaultMinFare},
+	}
+}
+
+// Step - сработавшее правило и его влияние на цену
+type Step struct {
+	Rule   string      `json:"rule"`
+	Type   string      `json:"type"`
+	Before money.Money `json:"before"`
+	After  money.Money `json:"after"`
+	Effect money.Money `json:"effect"` // After - Before, скидки отрицательные
+}
+
+// Breakdown - из чего сложилась цена: базовая цена водителя, сработавшие правила по порядку и итог
+type Breakdown struct {
+	Base  money.Money `json:"base"`
+	Steps []Step      `json:"steps"`
+	Total money.Money `json:"total"`
+}
+
+type compiledRule struct {
+	name, typ string
+	rule      rule
+}
+
+// Engine применяет правила в порядке, в котором они заданы
+type Engine struct {
+	rules []compiledRule
+	loc   *time.Location
+}
+
+// NewEngine проверяет правила, время для надбавок считается в loc
+func NewEngine(rules []RuleConfig, loc *time.Location) (*Engine, error) {
+	e := &Engine{loc: loc}
+	for i, cfg := range rules {
+		compiled, err := cfg.compile(loc)
+		if err != nil {
+			return nil, fmt.Errorf("pricing rule #%d (%s): %w", i+1, cfg.Type, err)
+		}
+		name := cfg.Name
+		if name == "" {
+			name = cfg.Type
+		}
+		e.rules = append(e.rules, compiledRule{name: name, typ: cfg.Type, rule: compiled})
+	}
+	return e, nil
+}
+
+// LoadFile читает правила из JSON файла со списком RuleConfig. Неизвестные поля - ошибка,
+// чтобы опечатка в файле не превращалась в молча пропущенное условие
+func LoadFile(path string) ([]RuleConfig, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	dec := json.NewDecoder(f)
+	dec.DisallowUnknownFields()
+	var rules []RuleConfig
+	if err := dec.Decode(&rules); err != nil {
+		return nil, fmt.Errorf("parse pricing rules %s: %w", path, err)
+	}
+	return rules, nil
+}
+
+// WithRules создаёт движок с другими правилами в том же часовом поясе, например чтобы проверить их до выкатки
+func (e *Engine) WithRules(rules []RuleConfig) (*Engine, error) {
+	return NewEngine(rules, e.loc)
+}
+
+// Evaluate считает цену и возвращает, какие правила сработали и как изменили цену
+func (e *Engine) Evaluate(in Input) Breakdown {
+	b := Breakdown{Base: in.BasePrice, Steps: []Step{}, Total: in.BasePrice}
+	for _, r := range e.rules {
+		after, applied := r.rule.apply(b.Total, in)
+		if !applied {
+			continue
+		}
+		b.Steps = append(b.Steps, Step{Rule: r.name, Type: r.typ, Before: b.Total, After: after, Effect: after.Sub(b.Total)})
+		b.Total = after
+	}
+	return b
+}
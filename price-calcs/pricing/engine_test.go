@@ -0,0 +1,232 @@
+package pricing_test
+
+import (
+	"os"
+	"otel-jaeger-learn/pkg/money"
+	"path/filepath"
+	"price-calcs/pricing"
+	"strings"
+	"testing"
+	"time"
+)
+
+func rub(major int64) money.Money { return money.FromMajor(major, "RUB") }
+
+// evaluate считает цену base на время at по правилам rules в часовом поясе loc
+func evaluate(t *testing.T, loc *time.Location, base money.Money, at time.Time, rules ...pricing.RuleConfig) pricing.Breakdown {
+	t.Helper()
+	engine, err := pricing.NewEngine(rules, loc)
+	if err != nil {
+		t.Fatalf("NewEngine: %v", err)
+	}
+	return engine.Evaluate(pricing.Input{BasePrice: base, Time: at})
+}
+
+func TestSurgeWindow(t *testing.T) {
+	// 2030-01-04 - пятница
+	day := time.Date(2030, 1, 4, 0, 0, 0, 0, time.UTC)
+	cases := []struct {
+		name     string
+		from, to string
+		at       time.Duration // от начала дня
+		applied  bool
+	}{
+		{"inside", "18:00", "21:00", 18 * time.Hour, true},
+		{"end is exclusive", "18:00", "21:00", 21 * time.Hour, false},
+		{"before", "18:00", "21:00", 17*time.Hour + 59*time.Minute, false},
+		{"wraps midnight, evening", "22:00", "02:00", 23*time.Hour + 30*time.Minute, true},
+		{"wraps midnight, night", "22:00", "02:00", time.Hour + 59*time.Minute, true},
+		{"wraps midnight, end", "22:00", "02:00", 2 * time.Hour, false},
+		{"wraps midnight, day", "22:00", "02:00", 12 * time.Hour, false},
+		{"until end of day", "20:00", "24:00", 23*time.Hour + 59*time.Minute, true},
+		{"whole day", "", "", 0, true},
+	}
+	for _, tc := range cases {
+		surge := pricing.RuleConfig{Type: pricing.TypeSurge, Multiplier: 1.5, From: tc.from, To: tc.to}
+		want := rub(1000)
+		if tc.applied {
+			want = rub(1500)
+		}
+		if got := evaluate(t, time.UTC, rub(1000), day.Add(tc.at), surge).Total; got != want {
+			t.Errorf("%s: %s-%s at %s = %s, want %s", tc.name, tc.from, tc.to, tc.at, got, want)
+		}
+	}
+}
+
+func TestSurgeWeekdaysInPricingTimezone(t *testing.T) {
+	msk := time.FixedZone("MSK", 3*60*60)
+	surge := pricing.RuleConfig{Type: pricing.TypeSurge, Multiplier: 2, Weekdays: []string{"sat", "Sun"}, From: "00:00", To: "03:00"}
+	cases := []struct {
+		name    string
+		at      time.Time
+		applied bool
+	}{
+		// Пятница 22:00 UTC - уже суббота 01:00 по Москве
+		{"saturday in MSK, friday in UTC", time.Date(2030, 1, 4, 22, 0, 0, 0, time.UTC), true},
+		{"sunday night", time.Date(2030, 1, 5, 23, 30, 0, 0, time.UTC), true},
+		// Воскресенье 22:00 UTC - понедельник 01:00 по Москве
+		{"monday in MSK, sunday in UTC", time.Date(2030, 1, 6, 22, 0, 0, 0, time.UTC), false},
+		{"saturday afternoon", time.Date(2030, 1, 5, 12, 0, 0, 0, time.UTC), false},
+	}
+	for _, tc := range cases {
+		want := rub(1000)
+		if tc.applied {
+			want = rub(2000)
+		}
+		if got := evaluate(t, msk, rub(1000), tc.at, surge).Total; got != want {
+			t.Errorf("%s: price = %s, want %s", tc.name, got, want)
+		}
+	}
+}
+
+func TestRoundModes(t *testing.T) {
+	cases := []struct {
+		mode  string
+		price money.Money
+		want  money.Money
+	}{
+		{"nearest", money.New(123450, "RUB"), rub(1230)},
+		{"nearest", money.New(123500, "RUB"), rub(1240)}, // половина - от нуля
+		{"", money.New(123600, "RUB"), rub(1240)},        // по умолчанию nearest
+		{"up", money.New(123001, "RUB"), rub(1240)},
+		{"down", money.New(123999, "RUB"), rub(1230)},
+		{"up", rub(1230), rub(1230)},
+		{"down", money.New(-123001, "RUB"), rub(-1240)},
+		{"nearest", money.New(-123500, "RUB"), rub(-1240)},
+	}
+	for _, tc := range cases {
+		b := evaluate(t, time.UTC, tc.price, time.Time{}, pricing.RuleConfig{Type: pricing.TypeRound, Step: 10, Mode: tc.mode})
+		if b.Total != tc.want {
+			t.Errorf("round %q %s = %s, want %s", tc.mode, tc.price, b.Total, tc.want)
+		}
+		if applied := len(b.Steps) == 1; applied != (tc.price != tc.want) {
+			t.Errorf("round %q %s: steps %+v, want a step only if the price changed", tc.mode, tc.price, b.Steps)
+		}
+	}
+
+	// Шаг меньше копейки не меняет цену
+	if b := evaluate(t, time.UTC, money.New(123456, "RUB"), time.Time{}, pricing.RuleConfig{Type: pricing.TypeRound, Step: 0.001}); len(b.Steps) != 0 {
+		t.Errorf("round to 0.001 RUB: steps %+v, want none", b.Steps)
+	}
+}
+
+func TestRuleOrder(t *testing.T) {
+	percent := pricing.RuleConfig{Type: pricing.TypeDiscount, Percent: 10}
+	fixed := pricing.RuleConfig{Type: pricing.TypeDiscount, Amount: 100}
+	floor := pricing.RuleConfig{Type: pricing.TypeMinFare, Amount: 500}
+	ceiling := pricing.RuleConfig{Type: pricing.TypeCap, Amount: 400}
+
+	cases := []struct {
+		name  string
+		rules []pricing.RuleConfig
+		base  int64
+		want  int64
+	}{
+		{"percent then fixed", []pricing.RuleConfig{percent, fixed}, 1000, 800},
+		{"fixed then percent", []pricing.RuleConfig{fixed, percent}, 1000, 810},
+		// Противоречащие минимальная цена и ограничение: побеждает последнее
+		{"min fare then cap", []pricing.RuleConfig{floor, ceiling}, 300, 400},
+		{"cap then min fare", []pricing.RuleConfig{ceiling, floor}, 300, 500},
+		{"cap then min fare, above both", []pricing.RuleConfig{ceiling, floor}, 1000, 500},
+		{"discount below min fare", []pricing.RuleConfig{fixed, floor}, 550, 500},
+	}
+	for _, tc := range cases {
+		if got := evaluate(t, time.UTC, rub(tc.base), time.Time{}, tc.rules...).Total; got != rub(tc.want) {
+			t.Errorf("%s: %d = %s, want %d", tc.name, tc.base, got, tc.want)
+		}
+	}
+}
+
+func TestBreakdownSteps(t *testing.T) {
+	engine, err := pricing.NewEngine([]pricing.RuleConfig{
+		{Name: "night", Type: pricing.TypeSurge, Multiplier: 1.2, From: "22:00", To: "06:00"},
+		{Type: pricing.TypeDriverDiscounts},
+		{Type: pricing.TypeMinFare, Amount: 300},
+	}, time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Днём надбавки нет, скидки водителя 100 + 50
+	b := engine.Evaluate(pricing.Input{BasePrice: rub(1000), Discounts: []int{100, 50}, Time: time.Date(2030, 1, 4, 12, 0, 0, 0, time.UTC)})
+	want := []pricing.Step{{Rule: "driver_discounts", Type: pricing.TypeDriverDiscounts, Before: rub(1000), After: rub(850), Effect: rub(-150)}}
+	if b.Base != rub(1000) || b.Total != rub(850) || len(b.Steps) != 1 || b.Steps[0] != want[0] {
+		t.Errorf("breakdown = %+v, want %+v", b, want)
+	}
+}
+
+func TestDefaultRulesFloorAtMinFare(t *testing.T) {
+	engine, err := pricing.NewEngine(pricing.DefaultRules(), time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := engine.Evaluate(pricing.Input{BasePrice: rub(50), Discounts: []int{30, 40}})
+	if b.Total != rub(pricing.DefaultMinFare) {
+		t.Errorf("price = %s, want %d", b.Total, pricing.DefaultMinFare)
+	}
+}
+
+func TestInvalidRules(t *testing.T) {
+	cases := []struct {
+		rule pricing.RuleConfig
+		err  string
+	}{
+		{pricing.RuleConfig{Type: "bonus"}, `unknown rule type "bonus"`},
+		{pricing.RuleConfig{Type: pricing.TypeSurge}, "multiplier must be positive"},
+		{pricing.RuleConfig{Type: pricing.TypeSurge, Multiplier: 1.2, Weekdays: []string{"friday"}}, `unknown weekday "friday"`},
+		{pricing.RuleConfig{Type: pricing.TypeSurge, Multiplier: 1.2, From: "25:00"}, `invalid time of day "25:00"`},
+		{pricing.RuleConfig{Type: pricing.TypeSurge, Multiplier: 1.2, To: "18:60"}, `invalid time of day "18:60"`},
+		{pricing.RuleConfig{Type: pricing.TypeSurge, Multiplier: 1.2, From: "25:99x"}, `invalid time of day "25:99x"`},
+		{pricing.RuleConfig{Type: pricing.TypeSurge, Multiplier: 1.2, From: "18:00x"}, `invalid time of day "18:00x"`},
+		{pricing.RuleConfig{Type: pricing.TypeSurge, Multiplier: 1.2, To: "24:01"}, `invalid time of day "24:01"`},
+		{pricing.RuleConfig{Type: pricing.TypeDiscount}, "exactly one of percent and amount"},
+		{pricing.RuleConfig{Type: pricing.TypeDiscount, Percent: 10, Amount: 100}, "exactly one of percent and amount"},
+		{pricing.RuleConfig{Type: pricing.TypeDiscount, Percent: 120}, "discount must be in [0, 100] percent"},
+		{pricing.RuleConfig{Type: pricing.TypeMinFare, Amount: -1}, "amount must not be negative"},
+		{pricing.RuleConfig{Type: pricing.TypeCap}, "amount must be positive"},
+		{pricing.RuleConfig{Type: pricing.TypeRound}, "step must be positive"},
+		{pricing.RuleConfig{Type: pricing.TypeRound, Step: 10, Mode: "ceil"}, `unknown round mode "ceil"`},
+	}
+	for _, tc := range cases {
+		// Номер правила в ошибке - по порядку в списке
+		_, err := pricing.NewEngine([]pricing.RuleConfig{{Type: pricing.TypeDriverDiscounts}, tc.rule}, time.UTC)
+		if err == nil || !strings.Contains(err.Error(), "pricing rule #2") || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("NewEngine(%+v) = %v, want rule #2 error %q", tc.rule, err, tc.err)
+		}
+	}
+}
+
+func TestLoadFile(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	rules, err := pricing.LoadFile(write("rules.json", `[{"type":"surge", "multiplier":1.2, "weekdays":["fri"], "from":"18:00", "to":"21:00"}, {"type":"min_fare", "amount":300}]`))
+	if err != nil {
+		t.Fatalf("LoadFile: %v", err)
+	}
+	if len(rules) != 2 || rules[0].Multiplier != 1.2 || rules[0].Weekdays[0] != "fri" || rules[1].Amount != 300 {
+		t.Errorf("rules = %+v, want surge and min_fare from the file", rules)
+	}
+
+	cases := []struct {
+		name, content, err string
+	}{
+		// Опечатка в поле не должна молча отключать условие
+		{"unknown field", `[{"type":"surge", "multiplier":1.2, "weekday":["fri"]}]`, `unknown field "weekday"`},
+		{"not a list", `{"type":"cap", "amount":100}`, "parse pricing rules"},
+		{"wrong type", `[{"type":"cap", "amount":"100"}]`, "parse pricing rules"},
+	}
+	for _, tc := range cases {
+		if _, err := pricing.LoadFile(write(tc.name+".json", tc.content)); err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("%s: LoadFile = %v, want error %q", tc.name, err, tc.err)
+		}
+	}
+	if _, err := pricing.LoadFile(filepath.Join(dir, "missing.json")); !os.IsNotExist(err) {
+		t.Errorf("LoadFile of missing file = %v, want not exist", err)
+	}
+}
@@ -0,0 +1,235 @@
+// Package pricing - правила расчёта цены: надбавки по времени, скидки, минимальная цена, ограничение и округление.
+// Правила применяются по порядку, каждое к результату предыдущего
+package pricing
+
+import (
+	"fmt"
+	"otel-jaeger-learn/pkg/money"
+	"strings"
+	"time"
+)
+
+// Типы правил
+const (
+	TypeSurge           = "surge"            // умножение на multiplier в дни weekdays с from до to
+	TypeDiscount        = "discount"         // скидка percent процентов или amount
+	TypeDriverDiscounts = "driver_discounts" // скидки водителя из базы, каждая - фиксированная сумма
+	TypeMinFare         = "min_fare"         // цена не ниже amount
+	TypeCap             = "cap"              // цена не выше amount
+	TypeRound           = "round"            // округление до step: nearest, up или down
+)
+
+// RuleConfig - правило в файле PRICING_RULES_FILE или строке таблицы pricing_rules
+type RuleConfig struct {
+	Name string `json:"name,omitempty"` // для событий span'а, по умолчанию - тип
+	Type string `json:"type"`
+
+	Multiplier float64  `json:"multiplier,omitempty"`
+	Weekdays   []string `json:"weekdays,omitempty"` // mon, tue, ..., sun; пусто - все дни
+	From       string   `json:"from,omitempty"`     // HH:MM, время бронирования в PRICING_TIMEZONE
+	To         string   `json:"to,omitempty"`       // HH:MM, не включительно; меньше from - интервал через полночь
+
+	Percent float64 `json:"percent,omitempty"`
+	Amount  float64 `json:"amount,omitempty"` // в валюте цены водителя
+
+	Step float64 `json:"step,omitempty"`
+	Mode string  `json:"mode,omitempty"`
+}
+
+// Input - всё, от чего может зависеть цена
+type Input struct {
+	BasePrice money.Money
+	Discounts []int
+	// Время бронирования, по нему выбираются надбавки
+	Time time.Time
+}
+
+// rule применяет правило к цене и сообщает, сработало ли оно
+type rule interface {
+	apply(price money.Money, in Input) (money.Money, bool)
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// compile проверяет правило и собирает его
+func (c RuleConfig) compile(loc *time.Location) (rule, error) {
+	switch c.Type {
+	case TypeSurge:
+		if c.Multiplier <= 0 {
+			return nil, fmt.Errorf("multiplier must be positive")
+		}
+		s := surge{multiplier: c.Multiplier, loc: loc, from: 0, to: 24 * 60}
+		for _, day := range c.Weekdays {
+			wd, ok := weekdays[strings.ToLower(day)]
+			if !ok {
+				return nil, fmt.Errorf("unknown weekday %q", day)
+			}
+			s.days |= 1 << wd
+		}
+		var err error
+		if c.From != "" {
+			if s.from, err = parseClock(c.From); err != nil {
+				return nil, err
+			}
+		}
+		if c.To != "" {
+			if s.to, err = parseClock(c.To); err != nil {
+				return nil, err
+			}
+		}
+		return s, nil
+	case TypeDiscount:
+		if (c.Percent == 0) == (c.Amount == 0) {
+			return nil, fmt.Errorf("exactly one of percent and amount must be set")
+		}
+		if c.Percent < 0 || c.Percent > 100 || c.Amount < 0 {
+			return nil, fmt.Errorf("discount must be in [0, 100] percent or a positive amount")
+		}
+		return discount{percent: c.Percent, amount: c.Amount}, nil
+	case TypeDriverDiscounts:
+		return driverDiscounts{}, nil
+	case TypeMinFare:
+		if c.Amount < 0 {
+			return nil, fmt.Errorf("amount must not be negative")
+		}
+		return minFare(c.Amount), nil
+	case TypeCap:
+		if c.Amount <= 0 {
+			return nil, fmt.Errorf("amount must be positive")
+		}
+		return priceCap(c.Amount), nil
+	case TypeRound:
+		if c.Step <= 0 {
+			return nil, fmt.Errorf("step must be positive")
+		}
+		switch c.Mode {
+		case "", "nearest", "up", "down":
+			return round{step: c.Step, mode: c.Mode}, nil
+		default:
+			return nil, fmt.Errorf("unknown round mode %q", c.Mode)
+		}
+	default:
+		return nil, fmt.Errorf("unknown rule type %q", c.Type)
+	}
+}
+
+// parseClock разбирает HH:MM в минуты от начала дня, 24:00 - конец дня
+func parseClock(s string) (int, error) {
+	if s == "24:00" {
+		return 24 * 60, nil
+	}
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day %q, want HH:MM", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+type surge struct {
+	multiplier float64
+	days       uint8 // битовая маска time.Weekday, 0 - все дни
+	from, to   int   // минуты от начала дня
+	loc        *time.Location
+}
+
+func (s surge) apply(price money.Money, in Input) (money.Money, bool) {
+	t := in.Time.In(s.loc)
+	if s.days != 0 && s.days&(1<<t.Weekday()) == 0 {
+		return price, false
+	}
+	minute := t.Hour()*60 + t.Minute()
+	inWindow := s.from <= minute && minute < s.to
+	if s.to < s.from {
+		inWindow = minute >= s.from || minute < s.to
+	}
+	if !inWindow {
+		return price, false
+	}
+	return price.Mul(s.multiplier), true
+}
+
+type discount struct {
+	percent, amount float64
+}
+
+func (d discount) apply(price money.Money, _ Input) (money.Money, bool) {
+	if d.percent > 0 {
+		return price.Mul(1 - d.percent/100), true
+	}
+	return price.Sub(money.FromFloat(d.amount, price.Currency)), true
+}
+
+type driverDiscounts struct{}
+
+func (driverDiscounts) apply(price money.Money, in Input) (money.Money, bool) {
+	if len(in.Discounts) == 0 {
+		return price, false
+	}
+	for _, d := range in.Discounts {
+		price = price.Sub(money.FromMajor(int64(d), price.Currency))
+	}
+	return price, true
+}
+
+type minFare float64
+
+func (m minFare) apply(price money.Money, _ Input) (money.Money, bool) {
+	floor := money.FromFloat(float64(m), price.Currency)
+	if price.Cmp(floor) >= 0 {
+		return price, false
+	}
+	return floor, true
+}
+
+type priceCap float64
+
+func (c priceCap) apply(price money.Money, _ Input) (money.Money, bool) {
+	ceiling := money.FromFloat(float64(c), price.Currency)
+	if price.Cmp(ceiling) <= 0 {
+		return price, false
+	}
+	return ceiling, true
+}
+
+type round struct {
+	step float64
+	mode string
+}
+
+func (r round) apply(price money.Money, _ Input) (money.Money, bool) {
+	step := money.FromFloat(r.step, price.Currency).Amount
+	if step <= 0 {
+		// Шаг меньше минимальной единицы валюты, округлять нечего
+		return price, false
+	}
+	q, rem := price.Amount/step, price.Amount%step
+	switch {
+	case rem == 0:
+	case r.mode == "up":
+		if rem > 0 {
+			q++
+		}
+	case r.mode == "down":
+		if rem < 0 {
+			q--
+		}
+	case 2*abs(rem) >= step: // nearest, половина - от нуля
+		if rem > 0 {
+			q++
+		} else {
+			q--
+		}
+	}
+	rounded := money.New(q*step, price.Currency)
+	return rounded, rounded != price
+}
+
+func abs(x int64) int64 {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
@@ -0,0 +1,90 @@
+// Package rates - курсы конвертации валют, каждый действует с даты EffectiveFrom до следующего курса той же пары
+package rates
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrNoRate - для пары валют нет курса, действующего на запрошенный момент
+var ErrNoRate = errors.New("no conversion rate")
+
+// Rate - курс: единица From стоит Value единиц To начиная с EffectiveFrom
+type Rate struct {
+	From          string    `json:"from"`
+	To            string    `json:"to"`
+	Value         float64   `json:"rate"`
+	EffectiveFrom time.Time `json:"effective_from"`
+}
+
+// Provider - источник курсов: таблица currency_rates (pricespg.Storage) или файл (Static)
+type Provider interface {
+	// GetRate возвращает последний курс from -> to с EffectiveFrom не позже at
+	GetRate(ctx context.Context, from, to string, at time.Time) (Rate, error)
+}
+
+// Static - курсы, заданные при старте, например из файла CURRENCY_RATES_FILE
+type Static struct {
+	// Курсы пары по возрастанию EffectiveFrom
+	rates map[[2]string][]Rate
+}
+
+// RateDigits - сколько знаков после точки может быть у курса, как у колонок rate в currency_rates и bookings
+const RateDigits = 10
+
+// NewStatic проверяет курсы: валюты заданы, курс положительный и не длиннее RateDigits знаков после точки,
+// чтобы он сохранялся в бронировании без округления
+func NewStatic(rates []Rate) (*Static, error) {
+	s := &Static{rates: make(map[[2]string][]Rate)}
+	for i, r := range rates {
+		if r.From == "" || r.To == "" {
+			return nil, fmt.Errorf("rate #%d: from and to currencies are required", i+1)
+		}
+		if r.Value <= 0 {
+			return nil, fmt.Errorf("rate #%d (%s -> %s): rate must be positive", i+1, r.From, r.To)
+		}
+		if _, frac, _ := strings.Cut(strconv.FormatFloat(r.Value, 'f', -1, 64), "."); len(frac) > RateDigits {
+			return nil, fmt.Errorf("rate #%d (%s -> %s): rate %v has more than %d decimal places", i+1, r.From, r.To, r.Value, RateDigits)
+		}
+		pair := [2]string{r.From, r.To}
+		s.rates[pair] = append(s.rates[pair], r)
+	}
+	for _, pairRates := range s.rates {
+		sort.Slice(pairRates, func(i, j int) bool { return pairRates[i].EffectiveFrom.Before(pairRates[j].EffectiveFrom) })
+	}
+	return s, nil
+}
+
+// LoadFile читает курсы из JSON файла со списком Rate, неизвестные поля - ошибка, как и в файле правил цены
+func LoadFile(path string) (*Static, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	dec := json.NewDecoder(f)
+	dec.DisallowUnknownFields()
+	var rates []Rate
+	if err := dec.Decode(&rates); err != nil {
+		return nil, fmt.Errorf("parse currency rates %s: %w", path, err)
+	}
+	return NewStatic(rates)
+}
+
+func (s *Static) GetRate(_ context.Context, from, to string, at time.Time) (Rate, error) {
+	pairRates := s.rates[[2]string{from, to}]
+	// Первый курс, который ещё не действует на момент at, предыдущий - искомый
+	i := sort.Search(len(pairRates), func(i int) bool { return pairRates[i].EffectiveFrom.After(at) })
+	if i == 0 {
+		return Rate{}, fmt.Errorf("%w from %s to %s at %s", ErrNoRate, from, to, at.Format(time.RFC3339))
+	}
+	return pairRates[i-1], nil
+}
@@ -0,0 +1,120 @@
+// Package pricesmem - хранилище цен в памяти, повторяет API pricespg для тестов
+package pricesmem
+
+import (
+	"context"
+	"fmt"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.22.0"
+	"go.opentelemetry.io/otel/trace"
+	"otel-jaeger-learn/pkg/money"
+	"price-calcs/storage/pricespg"
+	"sync"
+	"time"
+)
+
+const tracerName = "price-calcs/storage/pricesmem"
+
+// Currency - валюта цен, заданных через NewStorage и SetDriver
+const Currency = "RUB"
+
+type Storage struct {
+	mu        sync.Mutex
+	prices    map[string]money.Money
+	discounts map[string][]int
+	latency   time.Duration
+}
+
+// NewStorage создает хранилище с теми же водителями, что заводит pricespg (pricespg.NthDriver), с одинаковыми ценой и скидками
+func NewStorage(price float64, discounts ...int) *Storage {
+	s := &Storage{
+		prices:    make(map[string]money.Money),
+		discounts: make(map[string][]int),
+	}
+	for i := uint64(0); i < pricespg.DRIVERS_COUNT; i++ {
+		s.SetDriver(pricespg.NthDriver(i), price, discounts...)
+	}
+	return s
+}
+
+// SetDriver задаёт цену водителя в Currency и его скидки
+func (s *Storage) SetDriver(driverId string, price float64, discounts ...int) {
+	s.SetDriverPrice(driverId, money.FromFloat(price, Currency), discounts...)
+}
+
+// SetDriverPrice задаёт цену водителя в любой валюте и его скидки
+func (s *Storage) SetDriverPrice(driverId string, price money.Money, discounts ...int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.prices[driverId] = price
+	s.discounts[driverId] = append([]int(nil), discounts...)
+}
+
+// SetLatency задаёт время выполнения каждого запроса, как у медленной базы; запрос прерывается по дедлайну ctx
+func (s *Storage) SetLatency(latency time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.latency = latency
+}
+
+func (s *Storage) GetDriverPrice(ctx context.Context, driverId string) (money.Money, error) {
+	ctx, span := startSpan(ctx, "GetDriverPrice")
+	defer span.End()
+
+	if err := s.wait(ctx); err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return money.Money{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	price, ok := s.prices[driverId]
+	if !ok {
+		return money.Money{}, fmt.Errorf("%w: %s", pricespg.ErrDriverNotFound, driverId)
+	}
+	return price, nil
+}
+
+func (s *Storage) GetDriverDiscounts(ctx context.Context, driverId string) ([]int, error) {
+	ctx, span := startSpan(ctx, "GetDriverDiscounts")
+	defer span.End()
+
+	if err := s.wait(ctx); err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]int(nil), s.discounts[driverId]...), nil
+}
+
+// wait ждёт latency или отмены ctx, как запрос к базе через lib/pq
+func (s *Storage) wait(ctx context.Context) error {
+	s.mu.Lock()
+	latency := s.latency
+	s.mu.Unlock()
+
+	if latency <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(latency)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// startSpan создаёт span запроса к "базе", как это делает otelsql для настоящей БД
+func startSpan(ctx context.Context, name string) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, "pricesmem."+name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.DBSystemKey.String("memory"), semconv.DBOperation("SELECT")),
+	)
+}
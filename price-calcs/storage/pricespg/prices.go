@@ -1,18 +1,33 @@
 package pricespg
 
 import (
+	"bytes"
 	"context"
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/XSAM/otelsql"
 	_ "github.com/lib/pq"
 	semconv "go.opentelemetry.io/otel/semconv/v1.22.0"
 	"math/rand"
+	"otel-jaeger-learn/pkg/money"
+	"price-calcs/pricing"
+	"price-calcs/rates"
 	"time"
 )
 
 const DRIVERS_COUNT = 100
 
+// NthDriver возвращает ID n-го водителя по кругу: 1, 2, ..., DRIVERS_COUNT, 1, ... Тестовые данные
+// заводятся для NthDriver(0) ... NthDriver(DRIVERS_COUNT-1), поэтому любой ID отсюда есть в таблице prices
+func NthDriver(n uint64) string {
+	return fmt.Sprint(n%DRIVERS_COUNT + 1)
+}
+
+// ErrDriverNotFound - у водителя нет цены, то есть такого водителя нет
+var ErrDriverNotFound = errors.New("driver not found")
+
 type Storage struct {
 	db *sql.DB
 }
@@ -52,20 +67,42 @@ func (s *Storage) mustInitTable() error {
 	if err != nil {
 		return fmt.Errorf("failed to create discounts table: %w", err)
 	}
+	// Валюта цены водителя, до её появления все цены были в рублях
+	_, err = s.db.Exec("ALTER TABLE prices ADD COLUMN IF NOT EXISTS currency TEXT NOT NULL DEFAULT 'RUB';")
+	if err != nil {
+		return fmt.Errorf("failed to add prices.currency column: %w", err)
+	}
+	// Правила расчёта цены, применяются по возрастанию position
+	_, err = s.db.Exec("CREATE TABLE IF NOT EXISTS pricing_rules (position INT PRIMARY KEY, rule JSONB NOT NULL);")
+	if err != nil {
+		return fmt.Errorf("failed to create pricing_rules table: %w", err)
+	}
+	// Курсы валют: курс пары действует с effective_from до следующего курса этой пары
+	_, err = s.db.Exec("CREATE TABLE IF NOT EXISTS currency_rates (from_currency TEXT NOT NULL, to_currency TEXT NOT NULL, rate NUMERIC(20, 10) NOT NULL CHECK (rate > 0), effective_from TIMESTAMP NOT NULL, PRIMARY KEY (from_currency, to_currency, effective_from));")
+	if err != nil {
+		return fmt.Errorf("failed to create currency_rates table: %w", err)
+	}
+	_, err = s.db.Exec(`INSERT INTO currency_rates (from_currency, to_currency, rate, effective_from) VALUES
+		('RUB', 'USD', 0.0105, '2024-01-01'), ('RUB', 'EUR', 0.0098, '2024-01-01')
+		ON CONFLICT DO NOTHING`)
+	if err != nil {
+		return fmt.Errorf("failed to insert into currency_rates table: %w", err)
+	}
 
 	// Вставка тестовых данных
-	for i := 1; i <= DRIVERS_COUNT; i++ {
+	for i := uint64(0); i < DRIVERS_COUNT; i++ {
+		driverId := NthDriver(i)
 		price := rand.Float64() * 10000
 		time := time.Now()
 
-		_, err = s.db.Exec("INSERT INTO prices (price, time, driver_id) VALUES ($1, $2, $3)", price, time, i)
+		_, err = s.db.Exec("INSERT INTO prices (price, time, driver_id) VALUES ($1, $2, $3)", price, time, driverId)
 		if err != nil {
 			return fmt.Errorf("failed to insert into prices table: %w", err)
 		}
 
 		for j := 0; j < 3; j++ {
 			discount := rand.Intn(100)
-			_, err = s.db.Exec("INSERT INTO discounts (discount, driver_id) VALUES ($1, $2)", discount, i)
+			_, err = s.db.Exec("INSERT INTO discounts (discount, driver_id) VALUES ($1, $2)", discount, driverId)
 			if err != nil {
 				return fmt.Errorf("failed to insert into discounts table: %w", err)
 			}
@@ -75,22 +112,28 @@ func (s *Storage) mustInitTable() error {
 	return nil
 }
 
-func (s *Storage) GetDriverPrice(ctx context.Context, driverId string) (float64, error) {
-	var id float64
-	query := `SELECT price FROM prices WHERE driver_id = $1`
+func (s *Storage) GetDriverPrice(ctx context.Context, driverId string) (money.Money, error) {
+	var price money.Money
+	// Валюта читается до суммы, по ней money.Money разбирает DECIMAL
+	query := `SELECT currency, price FROM prices WHERE driver_id = $1`
 
 	// Важно передавать ctx в запрос, чтобы запрос был частью трейса
-	err := s.db.QueryRowContext(ctx, query, driverId).Scan(&id)
+	// и отменялся по дедлайну запроса (lib/pq отменяет выполняющийся запрос на сервере)
+	err := s.db.QueryRowContext(ctx, query, driverId).Scan(&price.Currency, &price)
+	if errors.Is(err, sql.ErrNoRows) {
+		return money.Money{}, fmt.Errorf("%w: %s", ErrDriverNotFound, driverId)
+	}
 	if err != nil {
-		return 0, err
+		return money.Money{}, err
 	}
-	return id, nil
+	return price, nil
 }
 
 func (s *Storage) GetDriverDiscounts(ctx context.Context, driverId string) ([]int, error) {
 	query := `SELECT discount FROM discounts WHERE driver_id = $1`
 
 	// Важно передавать ctx в запрос, чтобы запрос был частью трейса
+	// и отменялся по дедлайну запроса (lib/pq отменяет выполняющийся запрос на сервере)
 	rows, err := s.db.QueryContext(ctx, query, driverId)
 	if err != nil {
 		return nil, err
@@ -112,3 +155,46 @@ func (s *Storage) GetDriverDiscounts(ctx context.Context, driverId string) ([]in
 
 	return discounts, nil
 }
+
+// GetPricingRules возвращает правила расчёта цены из таблицы pricing_rules в порядке применения
+func (s *Storage) GetPricingRules(ctx context.Context) ([]pricing.RuleConfig, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT position, rule FROM pricing_rules ORDER BY position`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rules []pricing.RuleConfig
+	for rows.Next() {
+		var (
+			position int
+			raw      []byte
+			rule     pricing.RuleConfig
+		)
+		if err := rows.Scan(&position, &raw); err != nil {
+			return nil, err
+		}
+		// Неизвестные поля - ошибка, как и в pricing.LoadFile: опечатка не должна молча отключать условие правила
+		dec := json.NewDecoder(bytes.NewReader(raw))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&rule); err != nil {
+			return nil, fmt.Errorf("pricing rule at position %d: %w", position, err)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, rows.Err()
+}
+
+// GetRate возвращает последний курс from -> to из таблицы currency_rates, действующий на момент at
+func (s *Storage) GetRate(ctx context.Context, from, to string, at time.Time) (rates.Rate, error) {
+	rate := rates.Rate{From: from, To: to}
+	query := `SELECT rate, effective_from FROM currency_rates
+		WHERE from_currency = $1 AND to_currency = $2 AND effective_from <= $3
+		ORDER BY effective_from DESC LIMIT 1`
+	// Колонка TIMESTAMP без часового пояса, даты курсов хранятся в UTC
+	err := s.db.QueryRowContext(ctx, query, from, to, at.UTC()).Scan(&rate.Value, &rate.EffectiveFrom)
+	if errors.Is(err, sql.ErrNoRows) {
+		return rate, fmt.Errorf("%w from %s to %s at %s", rates.ErrNoRate, from, to, at.Format(time.RFC3339))
+	}
+	return rate, err
+}
@@ -3,7 +3,10 @@ package main
 import (
 	"github.com/gin-gonic/gin"
 	"log"
+	"otel-jaeger-learn/pkg/logging"
+	"otel-jaeger-learn/pkg/shedding"
 	"otel-jaeger-learn/pkg/tracing"
+	"otel-jaeger-learn/pkg/tracing/httpclient"
 	"web-entry/config"
 	"web-entry/handler"
 )
@@ -13,24 +16,38 @@ const ServiceName = "web-entry"
 func main() {
 	cfg := config.MustLoadConfig()
 
+	logging.InitLogging(cfg.LoggingCfg)
+
 	err := tracing.InitTracer(cfg.TracingCfg, ServiceName)
 	if err != nil {
 		log.Fatalf("failed to initialize logging: %v", err)
 	}
 
-	client := tracing.NewOtelHttpClient()
+	// Клиент с трейсингом, таймаутами, повторами и circuit breaker'ом
+	client, err := httpclient.New(cfg.HttpClientCfg)
+	if err != nil {
+		log.Fatalf("failed to create http client: %v", err)
+	}
 	bookingHandler := handler.NewBookingHnd(client, cfg)
 
 	router := gin.Default()
 
+	// Заголовок X-Debug-Trace превращается в baggage, до otel middleware, чтобы сэмплер его увидел
+	tracing.AddDebugHeaderMiddleware(router)
 	// Будет принимать из запроса или создавать новый трейс при каждом запросе
-	tracing.AddOtelMiddleware(router, ServiceName)
+	// и задавать бюджет времени, который передаётся в booking и price-calcs
+	tracing.AddOtelMiddleware(router, ServiceName, tracing.WithRequestBudget(cfg.RequestBudget))
+	// /metrics и страница /debug/tracing с состоянием экспорта span'ов
+	tracing.AddDebugRoutes(router)
+	// Ограничение одновременных запросов, /metrics и /debug/tracing зарегистрированы раньше и не ограничиваются
+	if err := shedding.AddMiddleware(router, cfg.SheddingCfg); err != nil {
+		log.Fatalf("failed to set up load shedding: %v", err)
+	}
 
-	router.POST("/bookings", func(c *gin.Context) { bookingHandler.AddBooking(c) })
-	router.GET("/bookings/:id", func(c *gin.Context) { bookingHandler.GetBookingByID(c) })
+	handler.RegisterRoutes(router, bookingHandler)
 
-	err = router.Run(":" + cfg.HTTPPort)
-	if err != nil {
-		log.Panicf("fail to run router: %v", err)
+	// По SIGINT/SIGTERM сервер останавливается и отправляет оставшиеся span'ы
+	if err := tracing.Serve(":"+cfg.HTTPPort, router); err != nil {
+		log.Fatalf("HTTP server stopped with error: %v", err)
 	}
 }
@@ -4,14 +4,23 @@ import (
 	"github.com/caarlos0/env/v11"
 	"log"
 	"otel-jaeger-learn/pkg/logging"
+	"otel-jaeger-learn/pkg/shedding"
 	"otel-jaeger-learn/pkg/tracing"
+	"otel-jaeger-learn/pkg/tracing/httpclient"
+	"time"
 )
 
 type Config struct {
-	HTTPPort    string `env:"HTTP_PORT" envDefault:"8080"`
-	BookingAddr string `env:"BOOKING_ADDR,required"`
-	LoggingCfg  logging.Config
-	TracingCfg  tracing.Config
+	HTTPPort       string        `env:"HTTP_PORT" envDefault:"8080"`
+	BookingAddr    string        `env:"BOOKING_ADDR,required"`
+	CalcPricesAddr string        `env:"CALC_PRICES_ADDR,required"`       // price-calcs, выдаёт предложения цены
+	RequestBudget  time.Duration `env:"REQUEST_BUDGET" envDefault:"10s"` // время на всю цепочку сервисов, остаток передаётся в X-Request-Budget-Ms
+	// Насколько вперёд можно бронировать, 0 - без ограничения
+	BookingHorizon time.Duration `env:"BOOKING_HORIZON" envDefault:"2160h"`
+	LoggingCfg     logging.Config
+	TracingCfg     tracing.Config
+	HttpClientCfg  httpclient.Config
+	SheddingCfg    shedding.Config
 }
 
 func MustLoadConfig() Config {
@@ -1,42 +1,72 @@
 package handler
 
 import (
-	"bytes"
-	"context"
 	"encoding/json"
+	"errors"
 	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
 	"log/slog"
-	"math/rand"
 	"net/http"
+	"net/url"
 	"otel-jaeger-learn/pkg/logging"
+	"otel-jaeger-learn/pkg/money"
 	"otel-jaeger-learn/pkg/tracing"
+	"otel-jaeger-learn/pkg/tracing/httpclient"
 	"time"
 	"web-entry/config"
 )
 
+// IdempotencyKeyHeader - ключ идемпотентности POST /bookings, передаётся в booking
+const IdempotencyKeyHeader = "Idempotency-Key"
+
 type bookingSchema struct {
-	ID   string `json:"id"`
-	Time string `json:"time"`
+	ID   string `json:"id" validate:"required"`
+	Time string `json:"time" validate:"required,rfc3339,future,horizon"`
+	// Водитель, время которого резервируется, на duration_minutes (по умолчанию BOOKING_SLOT_DURATION в booking).
+	// Если не задан, водителя выбирает price-calcs
+	DriverID        string `json:"driver_id,omitempty"`
+	DurationMinutes int    `json:"duration_minutes,omitempty" validate:"omitempty,min=15,max=720"`
+	// Токен из GET /quotes, бронируется цена из предложения; подпись и срок проверяет booking
+	QuoteToken string `json:"quote_token,omitempty"`
+	// Валюта цены, по умолчанию - валюта водителя. Без предложения цена переводится по текущему курсу
+	Currency string `json:"currency,omitempty" validate:"omitempty,currency"`
 }
 
-type BookingHnd struct {
-	client *http.Client
-	cfg    config.Config
+// bookingUpdateSchema - тело PATCH /bookings/:id, пустые поля не меняются. Статус и версию проверяет booking
+type bookingUpdateSchema struct {
+	Status  string `json:"status,omitempty"`
+	Time    string `json:"time,omitempty" validate:"omitempty,rfc3339,future,horizon"`
+	Version int    `json:"version,omitempty"`
 }
 
-func NewBookingHnd(client *http.Client, cfg config.Config) *BookingHnd {
-	return &BookingHnd{client: client, cfg: cfg}
+// bookingResponse - бронирование в ответе сервиса booking
+type bookingResponse struct {
+	ID             int         `json:"id"`
+	Time           time.Time   `json:"time"`
+	Price          money.Money `json:"price"`
+	OriginalPrice  money.Money `json:"original_price"`
+	Rate           float64     `json:"rate"`
+	PriceEstimated bool        `json:"price_estimated"`
+	Status         string      `json:"status"`
+	Version        int         `json:"version"`
+	DriverID       string      `json:"driver_id,omitempty"`
+	QuoteID        string      `json:"quote_id,omitempty"`
 }
 
-func (b *BookingHnd) sendRequest(ctx context.Context, method, url string, body []byte) (*http.Response, error) {
-	// Создаем запрос с контекстом в котором уже есть трейс, он будет обработан otelhttp transport'ом
-	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewBuffer(body))
-	if err != nil {
-		return nil, err
-	}
-	req.Header.Set("Content-Type", "application/json")
+// bookingListResponse - страница бронирований в ответе сервиса booking
+type bookingListResponse struct {
+	Bookings   []bookingResponse `json:"bookings"`
+	NextCursor string            `json:"next_cursor,omitempty"`
+}
 
-	return b.client.Do(req)
+type BookingHnd struct {
+	client    *httpclient.Client
+	cfg       config.Config
+	validator *validator.Validate
+}
+
+func NewBookingHnd(client *httpclient.Client, cfg config.Config) *BookingHnd {
+	return &BookingHnd{client: client, cfg: cfg, validator: newValidator(cfg.BookingHorizon)}
 }
 
 func (b *BookingHnd) AddBooking(c *gin.Context) {
@@ -59,54 +89,207 @@ func (b *BookingHnd) AddBooking(c *gin.Context) {
 		// Записываем ошибку в трейс
 		span.AddError("error in BindJSON", err)
 
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.JSON(http.StatusBadRequest, tracing.ErrorBody(ctx, err.Error()))
+		return
+	}
+	if fields := b.validate(&span, newBooking); len(fields) > 0 {
+		body := tracing.ErrorBody(ctx, "invalid booking")
+		body["fields"] = fields
+		c.JSON(http.StatusUnprocessableEntity, body)
 		return
 	}
 
-	requestBody, err := json.Marshal(newBooking)
+	// Отправляем запрос на сервис booking. POST без ключа идемпотентности не повторяется: бронирование могло
+	// уже создаться, с ключом booking вернёт на повтор тот же ответ
+	var opts []httpclient.CallOption
+	if key := c.GetHeader(IdempotencyKeyHeader); key != "" {
+		span.AddEvent("idempotency key received", slog.String("booking.idempotency_key", key))
+		opts = append(opts, httpclient.Idempotent(), httpclient.Header(IdempotencyKeyHeader, key))
+	}
+	var added struct {
+		ID       int    `json:"id"`
+		DriverID string `json:"driver_id"`
+		// Цена не от price-calcs, а из кэша или по умолчанию - клиент должен знать, что она оценочная
+		PriceEstimated bool `json:"price_estimated"`
+	}
+	err := b.client.DoJSON(ctx, http.MethodPost, b.cfg.BookingAddr+"/add-booking", newBooking, &added, opts...)
 	if err != nil {
-		span.AddError("marshaling booking JSON", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		// Записываем ошибку в трейс, ошибки клиента (например, ключ идемпотентности с другим телом) передаём как есть
+		writeDownstreamError(c, &span, err)
 		return
 	}
 
-	// Отправляем запрос на сервис booking
-	resp, err := b.sendRequest(ctx, "POST", b.cfg.BookingAddr+"/add-booking", requestBody)
+	// Возвращаем ответ от сервиса booking
+	c.JSON(http.StatusOK, gin.H{"message": "booking added successfully", "id": added.ID, "driver_id": added.DriverID, "price_estimated": added.PriceEstimated})
+}
+
+func (b *BookingHnd) GetBookingByID(c *gin.Context) {
+	// Создание контекста с трассировочным спаном
+	ctx, span := tracing.NewSpan(c.Request.Context(), "Handler.GetBookingByID")
+	defer span.End()
+
+	// Запрашиваем бронирование у сервиса booking
+	id := c.Param("id")
+	booking, err := httpclient.GetJSON[bookingResponse](ctx, b.client, b.cfg.BookingAddr+"/get-booking/"+url.PathEscape(id))
+	var statusErr *httpclient.StatusError
+	if errors.As(err, &statusErr) {
+		status := downstreamStatus(statusErr)
+		switch status {
+		case http.StatusNotFound:
+			span.AddEvent("booking not found", slog.String("booking.id", id))
+			c.JSON(status, tracing.ErrorBody(ctx, "booking not found"))
+		case http.StatusBadRequest:
+			span.AddError("invalid booking id", err)
+			c.JSON(status, tracing.ErrorBody(ctx, "invalid booking id"))
+		default:
+			span.AddError("unexpected status code from booking service", err)
+			tracing.TraceLogger(ctx).
+				Warn("unexpected status code from booking service", slog.Int("status", statusErr.StatusCode))
+			c.JSON(tracing.ErrorStatus(ctx, status), tracing.ErrorBody(ctx, "internal server error"))
+		}
+		return
+	}
 	if err != nil {
-		// Записываем ошибку в трейс
 		span.AddError("sending request", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		c.JSON(tracing.ErrorStatus(ctx, http.StatusInternalServerError), tracing.ErrorBody(ctx, "internal server error"))
 		return
 	}
-	defer resp.Body.Close()
 
-	// Проверяем код ответа от сервиса booking
-	if resp.StatusCode != http.StatusOK {
-		// Записываем ошибку в трейс
-		span.AddError("unexpected status code from booking service", nil)
-		// Пример лога с traceID
-		tracing.TraceLogger(ctx).
-			Warn("unexpected status code from booking service", slog.Int("status", resp.StatusCode))
+	span.AddEvent("booking retrieved")
+	c.JSON(http.StatusOK, booking)
+}
+
+// ListBookings отдаёт страницу бронирований, фильтры, сортировка и курсор передаются в booking как есть
+func (b *BookingHnd) ListBookings(c *gin.Context) {
+	ctx, span := tracing.NewSpan(c.Request.Context(), "Handler.ListBookings")
+	defer span.End()
 
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+	list, err := httpclient.GetJSON[bookingListResponse](ctx, b.client, b.cfg.BookingAddr+"/list-bookings?"+c.Request.URL.RawQuery)
+	if err != nil {
+		writeDownstreamError(c, &span, err)
 		return
 	}
 
-	// Возвращаем ответ от сервиса booking
-	c.JSON(http.StatusOK, gin.H{"message": "booking added successfully"})
+	span.AddEvent("bookings listed", slog.Int("booking.list.count", len(list.Bookings)))
+	c.JSON(http.StatusOK, list)
 }
 
-func (b *BookingHnd) GetBookingByID(c *gin.Context) {
-	// Создание контекста с трассировочным спаном
-	_, span := tracing.NewSpan(c.Request.Context(), "Handler.GetBookingByID")
+// UpdateBooking меняет статус или время бронирования. Новое время проверяется по тем же правилам, что и в POST /bookings
+func (b *BookingHnd) UpdateBooking(c *gin.Context) {
+	ctx, span := tracing.NewSpan(c.Request.Context(), "Handler.UpdateBooking")
+	defer span.End()
+
+	var upd bookingUpdateSchema
+	if err := c.BindJSON(&upd); err != nil {
+		span.AddError("error in BindJSON", err)
+		c.JSON(http.StatusBadRequest, tracing.ErrorBody(ctx, err.Error()))
+		return
+	}
+	if fields := b.validate(&span, upd); len(fields) > 0 {
+		body := tracing.ErrorBody(ctx, "invalid booking update")
+		body["fields"] = fields
+		c.JSON(http.StatusUnprocessableEntity, body)
+		return
+	}
+
+	var booking bookingResponse
+	err := b.client.DoJSON(ctx, http.MethodPatch, b.cfg.BookingAddr+"/update-booking/"+url.PathEscape(c.Param("id")), upd, &booking)
+	if err != nil {
+		writeDownstreamError(c, &span, err)
+		return
+	}
+	span.AddEvent("booking updated", slog.String("booking.status", booking.Status), slog.Int("booking.version", booking.Version))
+	c.JSON(http.StatusOK, booking)
+}
+
+// CancelBooking отменяет бронирование. DELETE идемпотентен, поэтому httpclient повторяет его при сбоях
+func (b *BookingHnd) CancelBooking(c *gin.Context) {
+	ctx, span := tracing.NewSpan(c.Request.Context(), "Handler.CancelBooking")
 	defer span.End()
 
-	booking := bookingSchema{ID: "123", Time: time.Now().Format(time.DateTime)}
-	found := rand.Intn(5) == 0
-	if !found {
-		span.AddEvent("booking not found")
-		c.JSON(http.StatusNotFound, gin.H{"error": "booking not found"})
+	target := b.cfg.BookingAddr + "/cancel-booking/" + url.PathEscape(c.Param("id"))
+	if version := c.Query("version"); version != "" {
+		target += "?version=" + url.QueryEscape(version)
+	}
+	var booking bookingResponse
+	if err := b.client.DoJSON(ctx, http.MethodDelete, target, nil, &booking); err != nil {
+		writeDownstreamError(c, &span, err)
 		return
 	}
+	span.AddEvent("booking cancelled", slog.Int("booking.version", booking.Version))
 	c.JSON(http.StatusOK, booking)
 }
+
+// GetQuote выдаёт подписанное предложение цены водителя (driver_id, если не задан - его выбирает price-calcs)
+// на время бронирования time в валюте currency (по умолчанию - валюта водителя), его token передаётся в POST /bookings как quote_token
+func (b *BookingHnd) GetQuote(c *gin.Context) {
+	ctx, span := tracing.NewSpan(c.Request.Context(), "Handler.GetQuote")
+	defer span.End()
+
+	query := url.Values{}
+	for _, key := range []string{"driver_id", "time", "currency"} {
+		if value := c.Query(key); value != "" {
+			query.Set(key, value)
+		}
+	}
+	target := b.cfg.CalcPricesAddr + "/booking-quote?" + query.Encode()
+	var quote json.RawMessage
+	if err := b.client.DoJSON(ctx, http.MethodGet, target, nil, &quote); err != nil {
+		writeDownstreamError(c, &span, err)
+		return
+	}
+	span.AddEvent("quote received")
+	c.Data(http.StatusOK, gin.MIMEJSON, quote)
+}
+
+// DriverAvailability отдаёт свободное время водителя между from и to
+func (b *BookingHnd) DriverAvailability(c *gin.Context) {
+	ctx, span := tracing.NewSpan(c.Request.Context(), "Handler.DriverAvailability")
+	defer span.End()
+
+	query := url.Values{"from": {c.Query("from")}, "to": {c.Query("to")}}
+	target := b.cfg.BookingAddr + "/driver-availability/" + url.PathEscape(c.Param("id")) + "?" + query.Encode()
+	var availability json.RawMessage
+	if err := b.client.DoJSON(ctx, http.MethodGet, target, nil, &availability); err != nil {
+		writeDownstreamError(c, &span, err)
+		return
+	}
+	c.Data(http.StatusOK, gin.MIMEJSON, availability)
+}
+
+// writeDownstreamError отвечает клиенту по ошибке запроса к booking или price-calcs: ошибки клиента передаются
+// с телом ответа сервиса (в нём причина и те же trace_id и request_id), остальные - 500 или 504
+func writeDownstreamError(c *gin.Context, span *tracing.Span, err error) {
+	ctx := c.Request.Context()
+	var statusErr *httpclient.StatusError
+	if !errors.As(err, &statusErr) {
+		span.AddError("sending request", err)
+		c.JSON(tracing.ErrorStatus(ctx, http.StatusInternalServerError), tracing.ErrorBody(ctx, "internal server error"))
+		return
+	}
+
+	status := downstreamStatus(statusErr)
+	if status < http.StatusInternalServerError {
+		span.AddError("downstream service rejected request", err)
+		c.Data(status, "application/json", statusErr.Body)
+		return
+	}
+	span.AddError("unexpected status code from downstream service", err)
+	tracing.TraceLogger(ctx).
+		Warn("unexpected status code from downstream service", slog.Int("status", statusErr.StatusCode))
+	c.JSON(tracing.ErrorStatus(ctx, status), tracing.ErrorBody(ctx, "internal server error"))
+}
+
+// downstreamStatus выбирает статус ответа клиенту по ошибке сервиса booking:
+// ошибки клиента (400, 404, 409, 422) и таймаут передаются как есть, остальное - 500
+func downstreamStatus(err *httpclient.StatusError) int {
+	switch err.StatusCode {
+	case http.StatusBadRequest, http.StatusNotFound, http.StatusConflict, http.StatusUnprocessableEntity:
+		return err.StatusCode
+	case http.StatusGatewayTimeout:
+		// Бюджет запроса закончился в одном из следующих сервисов
+		return http.StatusGatewayTimeout
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,14 @@
+package handler
+
+import "github.com/gin-gonic/gin"
+
+// RegisterRoutes регистрирует публичные маршруты web-entry
+func RegisterRoutes(router gin.IRouter, bookingHandler *BookingHnd) {
+	router.POST("/bookings", func(c *gin.Context) { bookingHandler.AddBooking(c) })
+	router.GET("/bookings", func(c *gin.Context) { bookingHandler.ListBookings(c) })
+	router.GET("/bookings/:id", func(c *gin.Context) { bookingHandler.GetBookingByID(c) })
+	router.PATCH("/bookings/:id", func(c *gin.Context) { bookingHandler.UpdateBooking(c) })
+	router.DELETE("/bookings/:id", func(c *gin.Context) { bookingHandler.CancelBooking(c) })
+	router.GET("/quotes", func(c *gin.Context) { bookingHandler.GetQuote(c) })
+	router.GET("/drivers/:id/availability", func(c *gin.Context) { bookingHandler.DriverAvailability(c) })
+}
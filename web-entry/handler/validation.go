@@ -0,0 +1,93 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"github.com/go-playground/validator/v10"
+	"log/slog"
+	"otel-jaeger-learn/pkg/money"
+	"otel-jaeger-learn/pkg/tracing"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// fieldError - ошибка одного поля в ответе 422
+type fieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// newValidator создаёт валидатор тегов validate со своими правилами для строк со временем:
+// rfc3339 - время в формате RFC3339, future - в будущем, horizon - не дальше horizon от текущего момента (0 - без ограничения),
+// и для кода валюты currency - ISO 4217, как его понимает price-calcs
+func newValidator(horizon time.Duration) *validator.Validate {
+	v := validator.New(validator.WithRequiredStructEnabled())
+	// В ошибках поля называются как в JSON
+	v.RegisterTagNameFunc(func(field reflect.StructField) string {
+		return strings.SplitN(field.Tag.Get("json"), ",", 2)[0]
+	})
+
+	rules := map[string]func(t time.Time) bool{
+		"rfc3339": func(time.Time) bool { return true },
+		"future":  func(t time.Time) bool { return t.After(time.Now()) },
+		"horizon": func(t time.Time) bool { return horizon <= 0 || !t.After(time.Now().Add(horizon)) },
+	}
+	for tag, rule := range rules {
+		rule := rule
+		err := v.RegisterValidation(tag, func(fl validator.FieldLevel) bool {
+			t, err := time.Parse(time.RFC3339, fl.Field().String())
+			return err == nil && rule(t)
+		})
+		if err != nil {
+			panic(err) // только при неверном имени тега
+		}
+	}
+	err := v.RegisterValidation("currency", func(fl validator.FieldLevel) bool {
+		return money.ValidateCurrency(fl.Field().String()) == nil
+	})
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
+
+func ruleMessage(e validator.FieldError, horizon time.Duration) string {
+	switch rule := e.Tag(); rule {
+	case "required":
+		return "field is required"
+	case "rfc3339":
+		return "must be RFC3339 time, e.g. 2030-01-01T10:00:00Z"
+	case "future":
+		return "must be in the future"
+	case "horizon":
+		return fmt.Sprintf("must be within %s from now", horizon)
+	case "min":
+		return "must be at least " + e.Param()
+	case "max":
+		return "must be at most " + e.Param()
+	case "currency":
+		return "must be ISO 4217 currency code, e.g. USD"
+	default:
+		return "must satisfy " + rule
+	}
+}
+
+// validate проверяет s и возвращает ошибки по полям, каждая записывается в span событием "validation failed"
+func (b *BookingHnd) validate(span *tracing.Span, s any) []fieldError {
+	err := b.validator.Struct(s)
+	var errs validator.ValidationErrors
+	if !errors.As(err, &errs) {
+		return nil
+	}
+
+	fields := make([]fieldError, 0, len(errs))
+	for _, e := range errs {
+		fields = append(fields, fieldError{Field: e.Field(), Rule: e.Tag(), Message: ruleMessage(e, b.cfg.BookingHorizon)})
+		span.AddEvent("validation failed",
+			slog.String("validation.field", e.Field()),
+			slog.String("validation.rule", e.Tag()))
+	}
+	return fields
+}